@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "gocache/api/groupcachepb"
+	service "gocache/internal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// node 到一个节点的 GroupCache 和 Admin 服务的连接，写请求通过 Admin 服务发送
+type node struct {
+	addr  string
+	conn  *grpc.ClientConn
+	cache pb.GroupCacheClient
+	admin pb.AdminClient
+}
+
+// options 一次压测的参数
+type options struct {
+	group       string
+	keys        []string
+	dist        distribution
+	writes      float64 // 写请求的比例
+	valueMin    int
+	valueMax    int
+	concurrency int
+	duration    time.Duration
+	route       string // owner 把读请求发给 key 的负责节点，random 随机发给一个节点；写请求总是发给负责节点
+	seed        int64
+	timeout     time.Duration
+}
+
+// bench 对一组节点发起压测
+type bench struct {
+	nodes []*node
+	ring  *service.ConsistentHash
+	index map[string]int // 节点地址 -> nodes 中的下标
+}
+
+// newBench 连接 addrs 中的每个节点，按与节点相同的哈希环计算 key 的负责节点，opts 追加到每个连接的选项中
+func newBench(addrs []string, opts ...grpc.DialOption) (*bench, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no cache node")
+	}
+	addrs = append([]string(nil), addrs...)
+	sort.Strings(addrs)
+	b := &bench{ring: service.NewPeerRing(addrs), index: make(map[string]int, len(addrs))}
+	for i, a := range addrs {
+		conn, err := grpc.NewClient(a, append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)...)
+		if err != nil {
+			b.Close()
+			return nil, err
+		}
+		b.nodes = append(b.nodes, &node{addr: a, conn: conn, cache: pb.NewGroupCacheClient(conn), admin: pb.NewAdminClient(conn)})
+		b.index[a] = i
+	}
+	return b, nil
+}
+
+func (b *bench) Close() {
+	for _, n := range b.nodes {
+		n.conn.Close()
+	}
+}
+
+// op 请求类型
+type op int
+
+const (
+	opGet op = iota
+	opSet
+	numOps
+)
+
+var opNames = [numOps]string{"get", "set"}
+
+// recorder 一个 worker 的统计，压测结束后合并
+type recorder struct {
+	latencies [numOps][]time.Duration
+	errors    [numOps]int64
+	notFound  int64
+	perNode   []int64
+}
+
+/*
+worker 循环发送请求直到 deadline 或者 ctx 取消
+  - 按 writes 的比例发送 Set，其余发送 Get；codes.NotFound 是正常结果，单独计数
+  - ctx 取消时正在进行的请求不计入统计
+*/
+func (b *bench) worker(ctx context.Context, o options, r *rand.Rand, keys keyChooser, deadline time.Time, rec *recorder) {
+	value := make([]byte, o.valueMax)
+	r.Read(value)
+
+	var err error
+	for time.Now().Before(deadline) && ctx.Err() == nil {
+		key := o.keys[keys.next()]
+		kind, target := opGet, b.index[b.ring.GetTruthNode(key)]
+		if r.Float64() < o.writes {
+			kind = opSet
+		} else if o.route == "random" {
+			target = r.Intn(len(b.nodes))
+		}
+		n := b.nodes[target]
+
+		reqCtx, cancel := context.WithTimeout(ctx, o.timeout)
+		start := time.Now()
+		if kind == opSet {
+			_, err = n.admin.Set(reqCtx, &pb.SetRequest{Group: o.group, Key: key, Value: value[:valueSize(r, o.valueMin, o.valueMax)]})
+		} else {
+			_, err = n.cache.Get(reqCtx, &pb.GetRequest{Group: o.group, Key: key})
+		}
+		elapsed := time.Since(start)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		rec.perNode[target]++
+		rec.latencies[kind] = append(rec.latencies[kind], elapsed)
+		switch {
+		case status.Code(err) == codes.NotFound:
+			rec.notFound++
+		case err != nil:
+			rec.errors[kind]++
+		}
+	}
+}
+
+// statsTimeout 压测前后读取节点统计的超时
+const statsTimeout = 5 * time.Second
+
+// checkWrites 压测前确认每个节点都接受 Admin 请求，否则所有写请求都会失败
+func (b *bench) checkWrites(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, statsTimeout)
+	defer cancel()
+	for _, n := range b.nodes {
+		_, err := n.admin.Ring(ctx, &pb.RingRequest{})
+		switch status.Code(err) {
+		case codes.OK:
+		case codes.Unimplemented:
+			return fmt.Errorf("-writes needs the admin service, enable admin.enable on %s", n.addr)
+		case codes.Unauthenticated:
+			return fmt.Errorf("-writes needs the admin token of %s, pass it with -token", n.addr)
+		default:
+			return fmt.Errorf("%s: %v", n.addr, err)
+		}
+	}
+	return nil
+}
+
+// groupStats 读取每个节点上 group 的统计，不依赖默认关闭的 Admin 服务，出错时对应位置为 nil
+func (b *bench) groupStats(ctx context.Context, group string) []*pb.GroupStats {
+	ctx, cancel := context.WithTimeout(ctx, statsTimeout)
+	defer cancel()
+	stats := make([]*pb.GroupStats, len(b.nodes))
+	for i, n := range b.nodes {
+		resp, err := n.cache.Stats(ctx, &pb.StatsRequest{Group: group})
+		if err == nil && len(resp.Groups) == 1 {
+			stats[i] = resp.Groups[0]
+		}
+	}
+	return stats
+}
+
+// opReport 一种请求的统计，延迟单位为纳秒
+type opReport struct {
+	Op         string        `json:"op"`
+	Requests   int64         `json:"requests"`
+	Errors     int64         `json:"errors"`
+	Throughput float64       `json:"throughput"` // 每秒请求数
+	P50        time.Duration `json:"p50_ns"`
+	P90        time.Duration `json:"p90_ns"`
+	P99        time.Duration `json:"p99_ns"`
+	P999       time.Duration `json:"p999_ns"`
+	Max        time.Duration `json:"max_ns"`
+}
+
+// nodeReport 一个节点的请求分布，Gets 之后的字段来自节点统计在压测前后的差值，包含节点之间互相转发的请求
+type nodeReport struct {
+	Addr       string  `json:"addr"`
+	Requests   int64   `json:"requests"` // 压测工具直接发给该节点的请求数
+	Share      float64 `json:"share"`
+	Stats      bool    `json:"stats"` // 是否取到了节点统计
+	Gets       int64   `json:"gets"`
+	Hits       int64   `json:"hits"`
+	HitRatio   float64 `json:"hit_ratio"`
+	PeerLoads  int64   `json:"peer_loads"`
+	LocalLoads int64   `json:"local_loads"`
+}
+
+/*
+report 压测结果
+  - HitRatio 为 Get 中不需要回源到数据源的比例，即 1 - 所有节点 LocalLoads 之和 / Get 请求数，
+    节点之间转发的请求会在两个节点上各计一次 Gets，所以不使用节点的命中次数计算
+  - 取不到任何节点的统计时 HitRatio 为 -1
+*/
+type report struct {
+	Group        string        `json:"group"`
+	Distribution string        `json:"distribution"`
+	Keys         int           `json:"keys"`
+	Concurrency  int           `json:"concurrency"`
+	Writes       float64       `json:"writes"`
+	Route        string        `json:"route"`
+	Seed         int64         `json:"seed"`
+	Elapsed      time.Duration `json:"elapsed_ns"`
+	Ops          []opReport    `json:"ops"` // 每种请求和汇总
+	NotFound     int64         `json:"not_found"`
+	HitRatio     float64       `json:"hit_ratio"`
+	Nodes        []nodeReport  `json:"nodes"`
+}
+
+// run 按 o 压测，结束后汇总所有 worker 的统计和节点统计的变化
+func (b *bench) run(ctx context.Context, o options) (*report, error) {
+	if len(o.keys) == 0 {
+		return nil, errors.New("no keys")
+	}
+	if o.concurrency <= 0 {
+		return nil, errors.New("concurrency must be positive")
+	}
+	// 第 i 个 worker 使用种子 seed+i，种子相同时每个 worker 的请求序列相同
+	rands := make([]*rand.Rand, o.concurrency)
+	choosers := make([]keyChooser, o.concurrency)
+	for i := range rands {
+		rands[i] = rand.New(rand.NewSource(o.seed + int64(i)))
+		var err error
+		if choosers[i], err = newKeyChooser(o.dist, len(o.keys), rands[i], i, o.concurrency); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.writes > 0 {
+		if err := b.checkWrites(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	before := b.groupStats(ctx, o.group)
+	recs := make([]*recorder, o.concurrency)
+	start := time.Now()
+	deadline := start.Add(o.duration)
+	var wg sync.WaitGroup
+	for i := range recs {
+		recs[i] = &recorder{perNode: make([]int64, len(b.nodes))}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			b.worker(ctx, o, rands[i], choosers[i], deadline, recs[i])
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	after := b.groupStats(context.WithoutCancel(ctx), o.group)
+
+	rep := &report{
+		Group:        o.group,
+		Distribution: o.dist.name,
+		Keys:         len(o.keys),
+		Concurrency:  o.concurrency,
+		Writes:       o.writes,
+		Route:        o.route,
+		Seed:         o.seed,
+		Elapsed:      elapsed,
+		HitRatio:     -1,
+	}
+	var all []time.Duration
+	var allErrors int64
+	for kind := op(0); kind < numOps; kind++ {
+		var latencies []time.Duration
+		var errs int64
+		for _, rec := range recs {
+			latencies = append(latencies, rec.latencies[kind]...)
+			errs += rec.errors[kind]
+		}
+		rep.Ops = append(rep.Ops, summarize(opNames[kind], latencies, errs, elapsed))
+		all = append(all, latencies...)
+		allErrors += errs
+	}
+	rep.Ops = append(rep.Ops, summarize("total", all, allErrors, elapsed))
+
+	var total, localLoads int64
+	var withStats bool
+	for i, n := range b.nodes {
+		nr := nodeReport{Addr: n.addr}
+		for _, rec := range recs {
+			nr.Requests += rec.perNode[i]
+		}
+		total += nr.Requests
+		if before[i] != nil && after[i] != nil {
+			nr.Stats = true
+			nr.Gets = after[i].Gets - before[i].Gets
+			nr.Hits = after[i].Hits - before[i].Hits
+			nr.PeerLoads = after[i].PeerLoads - before[i].PeerLoads
+			nr.LocalLoads = after[i].LocalLoads - before[i].LocalLoads
+			if nr.Gets > 0 {
+				nr.HitRatio = float64(nr.Hits) / float64(nr.Gets)
+			}
+			localLoads += nr.LocalLoads
+			withStats = true
+		}
+		rep.Nodes = append(rep.Nodes, nr)
+	}
+	for i := range rep.Nodes {
+		if total > 0 {
+			rep.Nodes[i].Share = float64(rep.Nodes[i].Requests) / float64(total)
+		}
+	}
+	for _, rec := range recs {
+		rep.NotFound += rec.notFound
+	}
+	if gets := rep.Ops[opGet].Requests; withStats && gets > 0 {
+		rep.HitRatio = math.Max(0, 1-float64(localLoads)/float64(gets))
+	}
+	return rep, nil
+}
+
+// summarize 计算吞吐量和延迟分位数，会对 latencies 排序
+func summarize(name string, latencies []time.Duration, errs int64, elapsed time.Duration) opReport {
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	r := opReport{Op: name, Requests: int64(len(latencies)), Errors: errs}
+	if elapsed > 0 {
+		r.Throughput = float64(len(latencies)) / elapsed.Seconds()
+	}
+	r.P50 = percentile(latencies, 0.5)
+	r.P90 = percentile(latencies, 0.9)
+	r.P99 = percentile(latencies, 0.99)
+	r.P999 = percentile(latencies, 0.999)
+	r.Max = percentile(latencies, 1)
+	return r
+}
+
+// percentile 返回已排序的 sorted 中第 p 分位的值，使用最近秩法
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
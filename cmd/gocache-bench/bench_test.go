@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	pb "gocache/api/groupcachepb"
+	service "gocache/internal"
+	"google.golang.org/grpc"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// counts 用 chooser 选择 draws 次，返回每个下标被选中的次数
+func counts(t *testing.T, d distribution, n, draws int) []int {
+	c, err := newKeyChooser(d, n, rand.New(rand.NewSource(1)), 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]int, n)
+	for i := 0; i < draws; i++ {
+		got[c.next()]++
+	}
+	return got
+}
+
+func TestKeyChoosers(t *testing.T) {
+	uniform := counts(t, distribution{name: "uniform"}, 10, 10000)
+	for i, c := range uniform {
+		if c < 800 || c > 1200 {
+			t.Fatalf("uniform key %d chosen %d times, expect about 1000", i, c)
+		}
+	}
+
+	z := counts(t, distribution{name: "zipf", zipfS: 1.5}, 100, 10000)
+	if z[0] < z[1] || z[1] < z[10] || z[0] < 3000 {
+		t.Fatalf("zipf counts should fall with the rank: %v", z[:11])
+	}
+
+	hot := counts(t, distribution{name: "hotspot", hotFraction: 0.1, hotRatio: 0.9}, 100, 10000)
+	sum := 0
+	for _, c := range hot[:10] {
+		sum += c
+	}
+	if sum < 8800 || sum > 9200 {
+		t.Fatalf("hot keys chosen %d times, expect about 9000", sum)
+	}
+
+	// scan 的各个 worker 从错开的位置开始顺序访问
+	c, err := newKeyChooser(distribution{name: "scan"}, 10, nil, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seq []int
+	for i := 0; i < 7; i++ {
+		seq = append(seq, c.next())
+	}
+	if want := []int{5, 6, 7, 8, 9, 0, 1}; !equalInts(seq, want) {
+		t.Fatalf("scan = %v, want %v", seq, want)
+	}
+
+	for _, d := range []distribution{{name: "zipf", zipfS: 1}, {name: "hotspot"}, {name: "gaussian"}} {
+		if _, err := newKeyChooser(d, 10, rand.New(rand.NewSource(1)), 0, 1); err == nil {
+			t.Fatalf("%+v should be rejected", d)
+		}
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseRange(t *testing.T) {
+	for _, tc := range []struct {
+		s      string
+		lo, hi int
+		ok     bool
+	}{
+		{"64", 64, 64, true},
+		{"64-1024", 64, 1024, true},
+		{"0", 0, 0, true},
+		{"1024-64", 0, 0, false},
+		{"-1", 0, 0, false},
+		{"abc", 0, 0, false},
+	} {
+		lo, hi, err := parseRange(tc.s)
+		if (err == nil) != tc.ok || lo != tc.lo || hi != tc.hi {
+			t.Fatalf("parseRange(%q) = %d, %d, %v", tc.s, lo, hi, err)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 1000; i++ {
+		latencies = append(latencies, time.Duration(i))
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	for p, want := range map[float64]time.Duration{0.5: 500, 0.9: 900, 0.99: 990, 0.999: 999, 1: 1000} {
+		if got := percentile(latencies, p); got != want {
+			t.Fatalf("percentile(%v) = %d, want %d", p, got, want)
+		}
+	}
+	if percentile(nil, 0.5) != 0 {
+		t.Fatal("percentile of no latencies should be 0")
+	}
+}
+
+/*
+startNode 在随机端口上启动一个只有 GroupCache 和 Admin 服务的节点，不注册到 etcd，返回节点地址
+  - admin 为 false 时不注册 Admin 服务，opts 为 gRPC 服务器的选项
+*/
+func startNode(t *testing.T, admin bool, opts ...grpc.ServerOption) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &service.Server{Addr: lis.Addr().String()}
+	gs := grpc.NewServer(opts...)
+	pb.RegisterGroupCacheServer(gs, s)
+	if admin {
+		pb.RegisterAdminServer(gs, service.NewAdmin(s))
+	}
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+	return lis.Addr().String()
+}
+
+func TestBenchRun(t *testing.T) {
+	service.NewGroup("bench-run", "lru", 0, service.RetrieveFunc(func(key string) ([]byte, error) {
+		if strings.HasSuffix(key, "9") {
+			return nil, service.ErrNotFound
+		}
+		return []byte("value-" + key), nil
+	}), service.WithTTL(time.Minute))
+	b, err := newBench([]string{startNode(t, true), startNode(t, true)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	r, err := b.run(context.Background(), options{
+		group:       "bench-run",
+		keys:        generateKeys("k", 100),
+		dist:        distribution{name: "zipf", zipfS: 1.2},
+		writes:      0.2,
+		valueMin:    8,
+		valueMax:    64,
+		concurrency: 4,
+		duration:    200 * time.Millisecond,
+		route:       "owner",
+		seed:        1,
+		timeout:     time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get, set, total := r.Ops[opGet], r.Ops[opSet], r.Ops[numOps]
+	if get.Requests == 0 || set.Requests == 0 || total.Requests != get.Requests+set.Requests {
+		t.Fatalf("ops = %+v", r.Ops)
+	}
+	if total.Errors != 0 || r.NotFound == 0 {
+		t.Fatalf("errors = %d, not found = %d, expect only not found keys", total.Errors, r.NotFound)
+	}
+	if total.P50 <= 0 || total.P50 > total.P99 || total.P99 > total.Max || total.Throughput <= 0 {
+		t.Fatalf("total = %+v", total)
+	}
+	if r.HitRatio < 0.5 || r.HitRatio > 1 {
+		t.Fatalf("hit ratio = %v, expect most gets of 100 zipf keys to hit", r.HitRatio)
+	}
+	var requests int64
+	var share float64
+	for _, n := range r.Nodes {
+		if !n.Stats || n.Requests == 0 {
+			t.Fatalf("node = %+v", n)
+		}
+		requests += n.Requests
+		share += n.Share
+	}
+	if requests != total.Requests || share < 0.999 || share > 1.001 {
+		t.Fatalf("nodes = %+v", r.Nodes)
+	}
+
+	var out strings.Builder
+	if err := printReport(&out, r); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"zipf distribution", "P99.9 MS", "hit ratio: ", b.nodes[0].addr} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("report should contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestBenchWritesNeedAdmin(t *testing.T) {
+	service.NewGroup("bench-writes", "lru", 0, service.RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	}))
+	o := options{
+		group:       "bench-writes",
+		keys:        generateKeys("k", 10),
+		dist:        distribution{name: "uniform"},
+		writes:      0.5,
+		valueMin:    8,
+		valueMax:    8,
+		concurrency: 1,
+		duration:    50 * time.Millisecond,
+		route:       "owner",
+		timeout:     time.Second,
+	}
+	secured := startNode(t, true, service.AdminAuth("secret"))
+	for _, tc := range []struct {
+		addr string
+		opts []grpc.DialOption
+		want string
+	}{
+		{startNode(t, false), nil, "enable admin.enable"},
+		{secured, nil, "pass it with -token"},
+		{secured, []grpc.DialOption{service.AdminCredentials("secret")}, ""},
+	} {
+		b, err := newBench([]string{tc.addr}, tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := b.run(context.Background(), o)
+		b.Close()
+		if tc.want == "" {
+			if err != nil || r.Ops[opSet].Requests == 0 || r.Ops[opSet].Errors != 0 {
+				t.Fatalf("run with the token = %+v, %v", r, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("err = %v, expect %q", err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"gocache/config"
+	"gocache/discovery"
+	service "gocache/internal"
+	"gocache/utils/logger"
+	"google.golang.org/grpc"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+/*
+gocache-bench 对缓存集群压测，输出吞吐量、延迟分位数、命中率和各节点的请求分布
+  - 默认压测 -addr 中逗号分隔的节点；指定 -etcd 时从 etcd 发现所有节点
+  - key 为 -prefix 加上 0 到 -keys-1 的编号，或者 -key-file 中每行一个 key
+  - -seed 相同时每个 worker 的请求序列相同，便于对比不同版本或配置
+  - -writes 大于 0 时写请求通过 Admin 服务发送，节点需要开启 Admin，配置了 token 时使用 -token 指定
+
+	go run ./cmd/gocache-bench -addr localhost:9999,localhost:10000 -dist zipf -duration 30s
+	go run ./cmd/gocache-bench -etcd localhost:2379 -group scores -key-file names.txt -writes 0.1 -token secret -o json
+*/
+
+var (
+	addr        = flag.String("addr", "localhost:9999", "comma separated cache node addresses, ignored when -etcd is set")
+	etcd        = flag.String("etcd", "", "comma separated etcd endpoints, discover every cache node instead of using -addr")
+	name        = flag.String("service", service.CacheServiceName, "service name registered in etcd")
+	group       = flag.String("group", "scores", "group to benchmark")
+	numKeys     = flag.Int("keys", 10000, "number of distinct keys")
+	prefix      = flag.String("prefix", "", "prefix of generated keys")
+	keyFile     = flag.String("key-file", "", "file with one key per line, replaces -keys and -prefix")
+	dist        = flag.String("dist", "uniform", "key distribution: uniform, zipf, hotspot or scan")
+	zipfS       = flag.Float64("zipf-s", 1.1, "exponent of the zipf distribution, > 1")
+	hotFraction = flag.Float64("hot-fraction", 0.2, "fraction of keys that are hot in the hotspot distribution")
+	hotRatio    = flag.Float64("hot-ratio", 0.8, "fraction of requests sent to hot keys in the hotspot distribution")
+	writes      = flag.Float64("writes", 0, "fraction of requests that are writes, 0 to 1")
+	values      = flag.String("value-size", "64", "value size in bytes of writes, a fixed size or a range like 64-1024")
+	concurrency = flag.Int("c", 16, "number of concurrent workers")
+	duration    = flag.Duration("duration", 10*time.Second, "how long to run")
+	route       = flag.String("route", "random", "where reads go: random node, or the key's owner")
+	seed        = flag.Int64("seed", 1, "random seed, worker i uses seed+i")
+	timeout     = flag.Duration("timeout", time.Second, "timeout of each request")
+	token       = flag.String("token", "", "token of the admin service, writes go through the admin service")
+	output      = flag.String("o", "table", "output format, table or json")
+)
+
+// loadKeys 读取 key 文件，跳过空行
+func loadKeys(r io.Reader) ([]string, error) {
+	var keys []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if key := strings.TrimSpace(scanner.Text()); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys, scanner.Err()
+}
+
+// generateKeys 生成 prefix0 到 prefix{n-1}
+func generateKeys(prefix string, n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = prefix + strconv.Itoa(i)
+	}
+	return keys
+}
+
+func ms(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// printReport 以表格输出压测结果
+func printReport(out io.Writer, r *report) error {
+	fmt.Fprintf(out, "group %s, %d keys, %s distribution, %d workers, %.0f%% writes, reads to %s node, seed %d, %s\n\n",
+		r.Group, r.Keys, r.Distribution, r.Concurrency, r.Writes*100, r.Route, r.Seed, r.Elapsed.Round(time.Millisecond))
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "OP\tREQUESTS\tERRORS\tREQ/S\tP50 MS\tP90 MS\tP99 MS\tP99.9 MS\tMAX MS\n")
+	for _, o := range r.Ops {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\t%s\n",
+			o.Op, o.Requests, o.Errors, o.Throughput, ms(o.P50), ms(o.P90), ms(o.P99), ms(o.P999), ms(o.Max))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "\nnot found: %d\n", r.NotFound)
+	if r.HitRatio >= 0 {
+		fmt.Fprintf(out, "hit ratio: %.4f (gets not loaded from the data source)\n", r.HitRatio)
+	} else {
+		fmt.Fprintf(out, "hit ratio: unknown, no node returned stats for group %s\n", r.Group)
+	}
+
+	fmt.Fprintln(out)
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "NODE\tREQUESTS\tSHARE\tGETS\tHITS\tHIT RATIO\tPEER LOADS\tLOCAL LOADS\n")
+	for _, n := range r.Nodes {
+		if !n.Stats {
+			fmt.Fprintf(w, "%s\t%d\t%.2f%%\t-\t-\t-\t-\t-\n", n.Addr, n.Requests, n.Share*100)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%d\t%.2f%%\t%d\t%d\t%.4f\t%d\t%d\n",
+			n.Addr, n.Requests, n.Share*100, n.Gets, n.Hits, n.HitRatio, n.PeerLoads, n.LocalLoads)
+	}
+	return w.Flush()
+}
+
+func fail(code int, err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(code)
+}
+
+func main() {
+	flag.Parse()
+	if *output != "table" && *output != "json" {
+		fail(2, fmt.Errorf("unknown output format %q, expect table or json", *output))
+	}
+	if *route != "random" && *route != "owner" {
+		fail(2, fmt.Errorf("unknown route %q, expect random or owner", *route))
+	}
+	if *writes < 0 || *writes > 1 {
+		fail(2, fmt.Errorf("-writes must be between 0 and 1"))
+	}
+	valueMin, valueMax, err := parseRange(*values)
+	if err != nil {
+		fail(2, err)
+	}
+	logger.LogrusObj.SetOutput(os.Stderr)
+	logger.LogrusObj.SetLevel(logrus.WarnLevel)
+
+	keys := generateKeys(*prefix, *numKeys)
+	if *keyFile != "" {
+		f, err := os.Open(*keyFile)
+		if err != nil {
+			fail(1, err)
+		}
+		keys, err = loadKeys(f)
+		f.Close()
+		if err != nil {
+			fail(1, fmt.Errorf("read %s failed: %v", *keyFile, err))
+		}
+	}
+
+	addrs := strings.Split(*addr, ",")
+	if *etcd != "" {
+		config.DefaultEtcdConfig = clientv3.Config{Endpoints: strings.Split(*etcd, ","), DialTimeout: 5 * time.Second}
+		if addrs, err = discovery.ListServicePeers(*name); err != nil {
+			fail(1, err)
+		}
+	}
+	var opts []grpc.DialOption
+	if *token != "" {
+		opts = append(opts, service.AdminCredentials(*token))
+	}
+	b, err := newBench(addrs, opts...)
+	if err != nil {
+		fail(1, err)
+	}
+	defer b.Close()
+
+	// Ctrl-C 提前结束压测，仍然输出已完成请求的统计
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	r, err := b.run(ctx, options{
+		group: *group,
+		keys:  keys,
+		dist: distribution{
+			name:        *dist,
+			zipfS:       *zipfS,
+			hotFraction: *hotFraction,
+			hotRatio:    *hotRatio,
+		},
+		writes:      *writes,
+		valueMin:    valueMin,
+		valueMax:    valueMax,
+		concurrency: *concurrency,
+		duration:    *duration,
+		route:       *route,
+		seed:        *seed,
+		timeout:     *timeout,
+	})
+	if err != nil {
+		b.Close()
+		fail(2, err)
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(r)
+	} else {
+		err = printReport(os.Stdout, r)
+	}
+	if err != nil {
+		b.Close()
+		fail(1, err)
+	}
+}
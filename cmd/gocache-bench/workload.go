@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// keyChooser 按分布选择下一个 key 的下标，每个 worker 各自持有一个，不需要加锁
+type keyChooser interface {
+	next() int
+}
+
+// uniform 均匀分布
+type uniform struct {
+	r *rand.Rand
+	n int
+}
+
+func (u *uniform) next() int {
+	return u.r.Intn(u.n)
+}
+
+// zipf Zipf 分布，下标越小越热
+type zipf struct {
+	z *rand.Zipf
+}
+
+func (z *zipf) next() int {
+	return int(z.z.Uint64())
+}
+
+// hotspot 比例为 ratio 的请求落在前 hot 个 key 上，其余请求均匀落在剩下的 key 上
+type hotspot struct {
+	r     *rand.Rand
+	n     int
+	hot   int
+	ratio float64
+}
+
+func (h *hotspot) next() int {
+	if h.hot == h.n || h.r.Float64() < h.ratio {
+		return h.r.Intn(h.hot)
+	}
+	return h.hot + h.r.Intn(h.n-h.hot)
+}
+
+// scan 顺序扫描，到末尾后从头开始
+type scan struct {
+	i int
+	n int
+}
+
+func (s *scan) next() int {
+	i := s.i
+	s.i = (s.i + 1) % s.n
+	return i
+}
+
+// distribution key 分布的参数
+type distribution struct {
+	name        string
+	zipfS       float64 // Zipf 分布的指数，必须大于 1，越大越集中
+	hotFraction float64 // hotspot 中热点 key 占 key 总数的比例
+	hotRatio    float64 // hotspot 中访问热点 key 的请求比例
+}
+
+/*
+newKeyChooser 为第 worker 个 worker 创建 key 选择器，n 为 key 的总数
+  - 随机分布使用 worker 自己的 r，种子固定时结果可以复现
+  - scan 的各个 worker 从均匀错开的位置开始，避免所有 worker 同时请求同一个 key
+*/
+func newKeyChooser(d distribution, n int, r *rand.Rand, worker, workers int) (keyChooser, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("no keys")
+	}
+	switch d.name {
+	case "uniform":
+		return &uniform{r: r, n: n}, nil
+	case "zipf":
+		z := rand.NewZipf(r, d.zipfS, 1, uint64(n-1))
+		if z == nil {
+			return nil, fmt.Errorf("invalid zipf exponent %v, expect > 1", d.zipfS)
+		}
+		return &zipf{z: z}, nil
+	case "hotspot":
+		if d.hotFraction <= 0 || d.hotFraction > 1 || d.hotRatio < 0 || d.hotRatio > 1 {
+			return nil, fmt.Errorf("invalid hotspot fraction %v or ratio %v, expect (0, 1] and [0, 1]", d.hotFraction, d.hotRatio)
+		}
+		hot := max(1, int(float64(n)*d.hotFraction))
+		return &hotspot{r: r, n: n, hot: hot, ratio: d.hotRatio}, nil
+	case "scan":
+		return &scan{i: worker * n / max(1, workers), n: n}, nil
+	}
+	return nil, fmt.Errorf("unknown distribution %q, expect uniform, zipf, hotspot or scan", d.name)
+}
+
+// parseRange 解析 value 大小，例如 64 或者 64-1024
+func parseRange(s string) (lo, hi int, err error) {
+	from, to, ok := strings.Cut(s, "-")
+	if lo, err = strconv.Atoi(strings.TrimSpace(from)); err != nil {
+		return 0, 0, fmt.Errorf("invalid size %q", s)
+	}
+	hi = lo
+	if ok {
+		if hi, err = strconv.Atoi(strings.TrimSpace(to)); err != nil {
+			return 0, 0, fmt.Errorf("invalid size %q", s)
+		}
+	}
+	if lo < 0 || hi < lo {
+		return 0, 0, fmt.Errorf("invalid size %q", s)
+	}
+	return lo, hi, nil
+}
+
+// valueSize 在 [lo, hi] 中均匀选择一个 value 大小
+func valueSize(r *rand.Rand, lo, hi int) int {
+	if hi == lo {
+		return lo
+	}
+	return lo + r.Intn(hi-lo+1)
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	pb "gocache/api/groupcachepb"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+func init() {
+	commands["groups"] = command{usage: "groups", help: "list groups and their config", run: listGroups}
+	commands["stats"] = command{usage: "stats [group]", help: "show stats of one or all groups and peer latencies", run: stats}
+	commands["hotkeys"] = command{usage: "hotkeys [-limit n] [group]", help: "show the hottest keys of one or all groups", run: hotKeys}
+	commands["peek"] = command{usage: "peek <group> <key>", help: "show an entry cached on the owner without touching it", run: peek}
+	commands["keys"] = command{usage: "keys [-prefix p] [-limit n] [-after key] <group>", help: "list cached keys page by page", run: keys}
+	commands["purge"] = command{usage: "purge <group>", help: "drop every entry of a group", run: purge}
+	commands["evict"] = command{usage: "evict <group> <key>", help: "drop one key, including hot key replicas", run: evict}
+	commands["ring"] = command{usage: "ring", help: "show the hash ring and peer latencies", run: ring}
+	commands["snapshot"] = command{usage: "snapshot [group]", help: "write one or all groups to the snapshot directory", run: snapshot}
+}
+
+func table(out io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+}
+
+// duration 把纳秒格式化为时长，0 显示为 -
+func duration(nanos int64) string {
+	if nanos == 0 {
+		return "-"
+	}
+	return time.Duration(nanos).String()
+}
+
+// timestamp 把 UnixNano 格式化为时间和剩余时长，0 显示为 -
+func timestamp(nanos int64) string {
+	if nanos == 0 {
+		return "-"
+	}
+	t := time.Unix(0, nanos)
+	return fmt.Sprintf("%s (in %s)", t.Format(time.RFC3339), time.Until(t).Round(time.Second))
+}
+
+// optionalGroup 解析可选的 group 参数
+func optionalGroup(args []string) (string, error) {
+	switch len(args) {
+	case 0:
+		return "", nil
+	case 1:
+		return args[0], nil
+	}
+	return "", errUsage
+}
+
+func listGroups(ctx context.Context, c *client, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	return c.each(ctx, func(ctx context.Context, n *node) (result, error) {
+		resp, err := n.admin.ListGroups(ctx, &pb.ListGroupsRequest{})
+		if err != nil {
+			return result{}, err
+		}
+		return result{resp, func(out io.Writer) error {
+			w := table(out)
+			fmt.Fprintf(w, "GROUP\tPOLICY\tMAX BYTES\tITEMS\tBYTES\tTTL\tSOFT TTL\tGRACE\tNEGATIVE TTL\tBLOOM\tLEASE\tBATCH\tHOT KEYS\n")
+			for _, g := range resp.Groups {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\t%t\t%s\t%s\t%d\n",
+					g.Name, g.Policy, g.MaxBytes, g.Items, g.Bytes,
+					duration(g.TtlNanos), duration(g.SoftTtlNanos), duration(g.GraceNanos), duration(g.NegativeTtlNanos),
+					g.BloomFilter, duration(g.LoadLeaseNanos), duration(g.BatchWindowNanos), g.HotKeys)
+			}
+			return w.Flush()
+		}}, nil
+	})
+}
+
+func stats(ctx context.Context, c *client, args []string) error {
+	group, err := optionalGroup(args)
+	if err != nil {
+		return err
+	}
+	return c.each(ctx, func(ctx context.Context, n *node) (result, error) {
+		resp, err := n.cache.Stats(ctx, &pb.StatsRequest{Group: group})
+		if err != nil {
+			return result{}, err
+		}
+		return result{resp, func(out io.Writer) error {
+			w := table(out)
+			fmt.Fprintf(w, "GROUP\tGETS\tHITS\tHIT RATIO\tMISSES\tLOADS\tPEER LOADS\tLOCAL LOADS\tERRORS\tEVICTIONS\tEXPIRATIONS\tITEMS\tBYTES\n")
+			for _, g := range resp.Groups {
+				ratio := 0.0
+				if g.Gets > 0 {
+					ratio = float64(g.Hits) / float64(g.Gets)
+				}
+				fmt.Fprintf(w, "%s\t%d\t%d\t%.4f\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
+					g.Name, g.Gets, g.Hits, ratio, g.Misses, g.Loads, g.PeerLoads, g.LocalLoads,
+					g.PeerErrors+g.LocalLoadErrors, g.Evictions, g.Expirations, g.Items, g.Bytes)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			return peers(out, resp.Peers)
+		}}, nil
+	})
+}
+
+// peers 打印访问各远程节点的统计，没有远程节点时不打印
+func peers(out io.Writer, stats []*pb.PeerStats) error {
+	if len(stats) == 0 {
+		return nil
+	}
+	fmt.Fprintln(out)
+	w := table(out)
+	fmt.Fprintf(w, "PEER\tFETCHES\tERRORS\tAVG LATENCY\tMAX LATENCY\n")
+	for _, p := range stats {
+		avg := int64(0)
+		if p.Fetches > 0 {
+			avg = p.TotalNanos / p.Fetches
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", p.Addr, p.Fetches, p.Errors, duration(avg), duration(p.MaxNanos))
+	}
+	return w.Flush()
+}
+
+func hotKeys(ctx context.Context, c *client, args []string) error {
+	fs := flag.NewFlagSet("hotkeys", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	limit := fs.Int("limit", 10, "keys per group, 0 for all tracked keys")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	group, err := optionalGroup(fs.Args())
+	if err != nil {
+		return err
+	}
+	return c.each(ctx, func(ctx context.Context, n *node) (result, error) {
+		resp, err := n.cache.HotKeys(ctx, &pb.HotKeysRequest{Group: group, Limit: int32(*limit)})
+		if err != nil {
+			return result{}, err
+		}
+		return result{resp, func(out io.Writer) error {
+			w := table(out)
+			fmt.Fprintf(w, "GROUP\tKEY\tCOUNT\n")
+			for _, g := range resp.Groups {
+				for _, k := range g.Keys {
+					fmt.Fprintf(w, "%s\t%s\t%d\n", g.Name, k.Key, k.Count)
+				}
+			}
+			return w.Flush()
+		}}, nil
+	})
+}
+
+// peekEntry peek 的 JSON 输出
+type peekEntry struct {
+	Group      string `json:"group"`
+	Key        string `json:"key"`
+	Node       string `json:"node"`
+	Value      string `json:"value"`
+	Negative   bool   `json:"negative"`
+	Replica    bool   `json:"replica"`
+	FreshUntil int64  `json:"fresh_until_unix_nanos"`
+	ExpireAt   int64  `json:"expire_at_unix_nanos"`
+}
+
+func peek(ctx context.Context, c *client, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	n := c.owner(args[1])
+	resp, err := n.admin.Peek(ctx, &pb.PeekRequest{Group: args[0], Key: args[1]})
+	if err != nil {
+		return err
+	}
+	if !resp.Found {
+		return fmt.Errorf("%s/%s is not cached on %s", args[0], args[1], n.addr)
+	}
+	e := peekEntry{args[0], args[1], n.addr, string(resp.Value), resp.Negative, resp.Replica, resp.FreshUntilUnixNanos, resp.ExpireAtUnixNanos}
+	return c.print(result{e, func(out io.Writer) error {
+		w := table(out)
+		fmt.Fprintf(w, "node\t%s\n", e.Node)
+		fmt.Fprintf(w, "value\t%s\n", strconv.Quote(e.Value))
+		fmt.Fprintf(w, "negative\t%t\n", e.Negative)
+		fmt.Fprintf(w, "replica\t%t\n", e.Replica)
+		fmt.Fprintf(w, "fresh until\t%s\n", timestamp(e.FreshUntil))
+		fmt.Fprintf(w, "expire at\t%s\n", timestamp(e.ExpireAt))
+		return w.Flush()
+	}})
+}
+
+func keys(ctx context.Context, c *client, args []string) error {
+	fs := flag.NewFlagSet("keys", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	prefix := fs.String("prefix", "", "only keys with this prefix")
+	limit := fs.Int("limit", 100, "keys per page")
+	after := fs.String("after", "", "list keys after this one, the next page hint of the previous call")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+	return c.each(ctx, func(ctx context.Context, n *node) (result, error) {
+		resp, err := n.admin.ListKeys(ctx, &pb.ListKeysRequest{Group: fs.Arg(0), Prefix: *prefix, PageToken: *after, PageSize: int32(*limit)})
+		if err != nil {
+			return result{}, err
+		}
+		return result{resp, func(out io.Writer) error {
+			for _, key := range resp.Keys {
+				fmt.Fprintln(out, key)
+			}
+			if resp.NextPageToken != "" {
+				fmt.Fprintf(out, "-- more keys, next page: -after %s\n", strconv.Quote(resp.NextPageToken))
+			}
+			return nil
+		}}, nil
+	})
+}
+
+func purge(ctx context.Context, c *client, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	return c.each(ctx, func(ctx context.Context, n *node) (result, error) {
+		resp, err := n.admin.Purge(ctx, &pb.PurgeRequest{Group: args[0]})
+		if err != nil {
+			return result{}, err
+		}
+		return result{resp, func(out io.Writer) error {
+			_, err := fmt.Fprintf(out, "purged %d entries of %s on %s\n", resp.Removed, args[0], n.addr)
+			return err
+		}}, nil
+	})
+}
+
+// evict 在每个节点上删除 key，非负责节点上可能有热点副本
+func evict(ctx context.Context, c *client, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	return c.each(ctx, func(ctx context.Context, n *node) (result, error) {
+		resp, err := n.admin.Evict(ctx, &pb.EvictRequest{Group: args[0], Key: args[1]})
+		if err != nil {
+			return result{}, err
+		}
+		return result{resp, func(out io.Writer) error {
+			if !resp.Removed {
+				_, err := fmt.Fprintf(out, "%s/%s is not cached on %s\n", args[0], args[1], n.addr)
+				return err
+			}
+			_, err := fmt.Fprintf(out, "evicted %s/%s on %s\n", args[0], args[1], n.addr)
+			return err
+		}}, nil
+	})
+}
+
+func ring(ctx context.Context, c *client, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	return c.each(ctx, func(ctx context.Context, n *node) (result, error) {
+		resp, err := n.admin.Ring(ctx, &pb.RingRequest{})
+		if err != nil {
+			return result{}, err
+		}
+		return result{resp, func(out io.Writer) error {
+			w := table(out)
+			fmt.Fprintf(w, "NODE\tVIRTUAL NODES\tSHARE\t\n")
+			for _, rn := range resp.Nodes {
+				self := ""
+				if rn.Self {
+					self = "(self)"
+				}
+				fmt.Fprintf(w, "%s\t%d\t%.2f%%\t%s\n", rn.Addr, rn.VirtualNodes, rn.Share*100, self)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			return peers(out, resp.Peers)
+		}}, nil
+	})
+}
+
+func snapshot(ctx context.Context, c *client, args []string) error {
+	group, err := optionalGroup(args)
+	if err != nil {
+		return err
+	}
+	return c.each(ctx, func(ctx context.Context, n *node) (result, error) {
+		resp, err := n.admin.Snapshot(ctx, &pb.SnapshotRequest{Group: group})
+		if err != nil {
+			return result{}, err
+		}
+		return result{resp, func(out io.Writer) error {
+			w := table(out)
+			fmt.Fprintf(w, "GROUP\tENTRIES\tPATH\n")
+			for _, s := range resp.Snapshots {
+				fmt.Fprintf(w, "%s\t%d\t%s\n", s.Group, s.Entries, s.Path)
+			}
+			return w.Flush()
+		}}, nil
+	})
+}
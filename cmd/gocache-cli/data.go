@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	pb "gocache/api/groupcachepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	commands["get"] = command{usage: "get <group> <key>", help: "read a key through its owner, loading it on a miss", run: get}
+	commands["set"] = command{usage: "set <group> <key> <value>", help: "write a key on its owner", run: set}
+	commands["del"] = command{usage: "del <group> <key>", help: "delete a key on its owner", run: del}
+	commands["mget"] = command{usage: "mget <group> <key>...", help: "read several keys in parallel", run: mget}
+	commands["watch"] = command{usage: "watch [-types t1,t2] <group>", help: "stream changes of a group until interrupted", run: watch, stream: true}
+}
+
+// entry get 和 mget 的 JSON 输出，value 按字符串输出
+type entry struct {
+	Group string `json:"group"`
+	Key   string `json:"key"`
+	Node  string `json:"node"`
+	Found bool   `json:"found"`
+	Value string `json:"value,omitempty"`
+	Stale bool   `json:"stale,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// fetch 从 key 的负责节点读取，key 不存在时 found 为 false 而不是返回错误
+func (c *client) fetch(ctx context.Context, group, key string) (entry, error) {
+	n := c.owner(key)
+	e := entry{Group: group, Key: key, Node: n.addr}
+	resp, err := n.cache.Get(ctx, &pb.GetRequest{Group: group, Key: key})
+	if status.Code(err) == codes.NotFound {
+		return e, nil
+	}
+	if err != nil {
+		return e, err
+	}
+	e.Found, e.Value, e.Stale = true, string(resp.Value), resp.Stale
+	return e, nil
+}
+
+func get(ctx context.Context, c *client, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	e, err := c.fetch(ctx, args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if !e.Found {
+		return fmt.Errorf("%s/%s not found", args[0], args[1])
+	}
+	return c.print(result{e, func(out io.Writer) error {
+		if e.Stale {
+			_, err := fmt.Fprintf(out, "%s (stale)\n", e.Value)
+			return err
+		}
+		_, err := fmt.Fprintln(out, e.Value)
+		return err
+	}})
+}
+
+func set(ctx context.Context, c *client, args []string) error {
+	if len(args) != 3 {
+		return errUsage
+	}
+	n := c.owner(args[1])
+	if _, err := n.admin.Set(ctx, &pb.SetRequest{Group: args[0], Key: args[1], Value: []byte(args[2])}); err != nil {
+		return err
+	}
+	e := entry{Group: args[0], Key: args[1], Node: n.addr, Found: true, Value: args[2]}
+	return c.print(result{e, func(out io.Writer) error {
+		_, err := fmt.Fprintf(out, "set %s/%s on %s\n", e.Group, e.Key, e.Node)
+		return err
+	}})
+}
+
+// del 在负责节点上删除 key，其他节点上的热点副本在副本 TTL 之后过期，需要立即删除时使用 evict
+func del(ctx context.Context, c *client, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	n := c.owner(args[1])
+	resp, err := n.admin.Delete(ctx, &pb.DeleteRequest{Group: args[0], Key: args[1]})
+	if err != nil {
+		return err
+	}
+	e := entry{Group: args[0], Key: args[1], Node: n.addr, Found: resp.Removed}
+	return c.print(result{e, func(out io.Writer) error {
+		if !e.Found {
+			_, err := fmt.Fprintf(out, "%s/%s is not cached on %s\n", e.Group, e.Key, e.Node)
+			return err
+		}
+		_, err := fmt.Fprintf(out, "deleted %s/%s on %s\n", e.Group, e.Key, e.Node)
+		return err
+	}})
+}
+
+// mget 并发读取多个 key，单个 key 出错时记录在结果中，不影响其他 key
+func mget(ctx context.Context, c *client, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	group, keys := args[0], args[1:]
+	entries := make([]entry, len(keys))
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+			e, err := c.fetch(ctx, group, key)
+			if err != nil {
+				e.Error = status.Convert(err).Message()
+			}
+			entries[i] = e
+		}(i, key)
+	}
+	wg.Wait()
+
+	return c.print(result{entries, func(out io.Writer) error {
+		w := table(out)
+		fmt.Fprintf(w, "KEY\tVALUE\tNODE\n")
+		for _, e := range entries {
+			value := strconv.Quote(e.Value)
+			switch {
+			case e.Error != "":
+				value = "(error: " + e.Error + ")"
+			case !e.Found:
+				value = "(not found)"
+			case e.Stale:
+				value += " (stale)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", e.Key, value, e.Node)
+		}
+		return w.Flush()
+	}})
+}
+
+// change watch 的 JSON 输出，每个事件一行
+type change struct {
+	Node    string `json:"node"`
+	Group   string `json:"group"`
+	Key     string `json:"key"`
+	Type    string `json:"type"`
+	Value   string `json:"value,omitempty"`
+	Time    string `json:"time"`
+	Dropped int64  `json:"dropped,omitempty"`
+}
+
+// parseEventTypes 解析逗号分隔的事件类型，不区分大小写，例如 set,deleted
+func parseEventTypes(s string) ([]pb.EventType, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var types []pb.EventType
+	for _, name := range strings.Split(s, ",") {
+		t, ok := pb.EventType_value[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok || t == 0 {
+			return nil, fmt.Errorf("unknown event type %q", name)
+		}
+		types = append(types, pb.EventType(t))
+	}
+	return types, nil
+}
+
+/*
+watch 订阅每个节点上 group 的变更事件，合并之后逐行输出，直到 ctx 取消
+  - 事件只在发生变更的节点上产生，所以需要订阅所有节点
+  - 服务端因为读取跟不上丢弃事件时，输出累计丢弃数
+*/
+func watch(ctx context.Context, c *client, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	typeNames := fs.String("types", "", "comma separated event types, e.g. set,deleted, empty for all")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+	types, err := parseEventTypes(*typeNames)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	changes := make(chan change)
+	errs := make(chan error, len(c.nodes))
+	for _, n := range c.nodes {
+		stream, err := n.cache.Watch(ctx, &pb.WatchRequest{Group: fs.Arg(0), Types: types})
+		if err != nil {
+			return fmt.Errorf("%s: %w", n.addr, err)
+		}
+		go func(n *node, stream pb.GroupCache_WatchClient) {
+			for {
+				e, err := stream.Recv()
+				if err != nil {
+					errs <- fmt.Errorf("%s: %w", n.addr, err)
+					return
+				}
+				ch := change{
+					Node:    n.addr,
+					Group:   e.Group,
+					Key:     e.Key,
+					Type:    e.Type.String(),
+					Value:   string(e.Value),
+					Time:    time.Unix(0, e.UnixNanos).Format(time.RFC3339Nano),
+					Dropped: e.Dropped,
+				}
+				select {
+				case changes <- ch:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(n, stream)
+	}
+
+	enc := json.NewEncoder(c.out)
+	dropped := make(map[string]int64, len(c.nodes))
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errs:
+			if ctx.Err() != nil || errors.Is(err, context.Canceled) || status.Code(err) == codes.Canceled {
+				return nil
+			}
+			return err
+		case ch := <-changes:
+			if c.json {
+				if err := enc.Encode(ch); err != nil {
+					return err
+				}
+				continue
+			}
+			if ch.Dropped > dropped[ch.Node] {
+				fmt.Fprintf(c.out, "-- %s dropped %d events, resync if needed\n", ch.Node, ch.Dropped-dropped[ch.Node])
+				dropped[ch.Node] = ch.Dropped
+			}
+			fmt.Fprintf(c.out, "%s  %s  %-21s  %s  %s\n", ch.Time, ch.Node, ch.Type, ch.Key, strconv.Quote(ch.Value))
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	pb "gocache/api/groupcachepb"
+	"gocache/config"
+	"gocache/discovery"
+	service "gocache/internal"
+	"gocache/utils/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+/*
+gocache-cli 缓存节点的命令行客户端
+  - 默认连接 -addr 指定的节点；指定 -etcd 时从 etcd 发现所有节点
+  - get、set、del、mget、peek 按一致性哈希直接发给 key 的负责节点，其他命令在每个节点上执行
+  - 不带命令或者使用 repl 命令时进入交互模式
+  - set、del 和管理命令需要节点开启 Admin 服务，节点配置了 token 时使用 -token 指定
+
+	go run ./cmd/gocache-cli -addr localhost:9999 get scores 张三
+	go run ./cmd/gocache-cli -etcd localhost:2379 -o json stats scores
+	go run ./cmd/gocache-cli -etcd localhost:2379 watch -types set,deleted scores
+	go run ./cmd/gocache-cli -addr localhost:9999
+	go run ./cmd/gocache-cli -addr localhost:9999 -token secret purge scores
+*/
+
+var (
+	addr    = flag.String("addr", "localhost:9999", "cache node address, ignored when -etcd is set")
+	etcd    = flag.String("etcd", "", "comma separated etcd endpoints, discover every cache node instead of using -addr")
+	name    = flag.String("service", service.CacheServiceName, "service name registered in etcd")
+	output  = flag.String("o", "table", "output format, table or json")
+	timeout = flag.Duration("timeout", 5*time.Second, "timeout of each request, watch is not limited")
+	token   = flag.String("token", "", "token of the admin service, admin.token in config.yml")
+)
+
+// node 到一个节点的 GroupCache 和 Admin 服务的连接
+type node struct {
+	addr  string
+	conn  *grpc.ClientConn
+	cache pb.GroupCacheClient
+	admin pb.AdminClient
+}
+
+// client 命令作用的节点集合，ring 与节点上的哈希环相同，用来找到 key 的负责节点
+type client struct {
+	nodes []*node
+	ring  *service.ConsistentHash
+	out   io.Writer
+	json  bool
+}
+
+// newClient 连接 addrs 中的每个节点，opts 追加到每个连接的选项中
+func newClient(addrs []string, out io.Writer, asJSON bool, opts ...grpc.DialOption) (*client, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no cache node")
+	}
+	addrs = append([]string(nil), addrs...)
+	sort.Strings(addrs)
+	c := &client{ring: service.NewPeerRing(addrs), out: out, json: asJSON}
+	for _, a := range addrs {
+		conn, err := grpc.NewClient(a, append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithChainUnaryInterceptor(adminHint)}, opts...)...)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.nodes = append(c.nodes, &node{addr: a, conn: conn, cache: pb.NewGroupCacheClient(conn), admin: pb.NewAdminClient(conn)})
+	}
+	return c, nil
+}
+
+// adminHint 说明 Admin 请求失败的原因：节点没有开启 Admin 服务，或者 token 不正确
+func adminHint(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if !strings.HasPrefix(method, "/"+pb.Admin_ServiceDesc.ServiceName+"/") {
+		return err
+	}
+	switch status.Code(err) {
+	case codes.Unimplemented:
+		return fmt.Errorf("admin service is disabled on %s, set admin.enable in its config.yml: %w", cc.Target(), err)
+	case codes.Unauthenticated:
+		return fmt.Errorf("admin token rejected by %s, pass the node's admin.token with -token: %w", cc.Target(), err)
+	}
+	return err
+}
+
+func (c *client) Close() {
+	for _, n := range c.nodes {
+		n.conn.Close()
+	}
+}
+
+// owner 返回 key 的负责节点
+func (c *client) owner(key string) *node {
+	addr := c.ring.GetTruthNode(key)
+	for _, n := range c.nodes {
+		if n.addr == addr {
+			return n
+		}
+	}
+	return c.nodes[0]
+}
+
+// result 命令的输出，JSON 格式输出 value，表格格式调用 table
+type result struct {
+	value any
+	table func(w io.Writer) error
+}
+
+// marshal 把 value 编码为 JSON，protobuf 消息按 protojson 编码并输出零值字段
+func marshal(value any) (json.RawMessage, error) {
+	if m, ok := value.(proto.Message); ok {
+		return protojson.MarshalOptions{EmitUnpopulated: true, UseProtoNames: true}.Marshal(m)
+	}
+	return json.Marshal(value)
+}
+
+// writeJSON 缩进输出 JSON
+func writeJSON(out io.Writer, raw json.RawMessage) error {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, raw, "", "  "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := buf.WriteTo(out)
+	return err
+}
+
+func (c *client) print(r result) error {
+	if !c.json {
+		return r.table(c.out)
+	}
+	raw, err := marshal(r.value)
+	if err != nil {
+		return err
+	}
+	return writeJSON(c.out, raw)
+}
+
+/*
+each 在每个节点上执行 fn 并输出结果
+  - 表格格式在多个节点的结果之前打印节点地址
+  - JSON 格式只有一个节点时直接输出结果，多个节点时输出以节点地址为键的对象
+*/
+func (c *client) each(ctx context.Context, fn func(ctx context.Context, n *node) (result, error)) error {
+	if len(c.nodes) == 1 {
+		r, err := fn(ctx, c.nodes[0])
+		if err != nil {
+			return err
+		}
+		return c.print(r)
+	}
+
+	all := make(map[string]json.RawMessage, len(c.nodes))
+	for i, n := range c.nodes {
+		r, err := fn(ctx, n)
+		if err != nil {
+			return fmt.Errorf("%s: %w", n.addr, err)
+		}
+		if c.json {
+			if all[n.addr], err = marshal(r.value); err != nil {
+				return err
+			}
+			continue
+		}
+		if i > 0 {
+			fmt.Fprintln(c.out)
+		}
+		fmt.Fprintf(c.out, "== %s ==\n", n.addr)
+		if err := r.table(c.out); err != nil {
+			return err
+		}
+	}
+	if !c.json {
+		return nil
+	}
+	raw, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	return writeJSON(c.out, raw)
+}
+
+// command 一个子命令，args 为子命令名之后的参数；stream 为 true 的命令一直运行到取消，不受 -timeout 限制
+type command struct {
+	usage  string
+	help   string
+	run    func(ctx context.Context, c *client, args []string) error
+	stream bool
+}
+
+var commands = map[string]command{}
+
+// errUsage 参数错误，打印子命令的用法
+var errUsage = errors.New("invalid arguments")
+
+// printCommands 按名称顺序打印所有子命令的用法
+func printCommands(out io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-48s %s\n", commands[name].usage, commands[name].help)
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: gocache-cli [flags] [command [args]]\n\ncommands:\n")
+	printCommands(out)
+	fmt.Fprintf(out, "\nwithout a command gocache-cli starts an interactive shell\n\nflags:\n")
+	flag.PrintDefaults()
+}
+
+// execute 执行一个子命令
+func execute(ctx context.Context, c *client, args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	if !cmd.stream {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	err := cmd.run(ctx, c, args[1:])
+	if errors.Is(err, errUsage) {
+		return fmt.Errorf("usage: %s", cmd.usage)
+	}
+	return err
+}
+
+/*
+repl 逐行读取并执行命令，直到 exit、quit 或者输入结束
+  - 参数按空白切分，单引号或双引号中的空白属于同一个参数
+  - 命令出错时打印错误并继续；执行中按 Ctrl-C 只取消当前命令，例如 watch
+*/
+func repl(ctx context.Context, c *client, in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(c.out, "gocache> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(c.out)
+			return scanner.Err()
+		}
+		args, err := splitArgs(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(c.out, "error: %v\n", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		switch args[0] {
+		case "exit", "quit":
+			return nil
+		case "help":
+			printCommands(c.out)
+			continue
+		case "repl":
+			continue
+		}
+		cmdCtx, stop := signal.NotifyContext(ctx, os.Interrupt)
+		err = execute(cmdCtx, c, args)
+		stop()
+		if err != nil {
+			fmt.Fprintf(c.out, "error: %v\n", err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// splitArgs 按空白切分一行命令，单引号或双引号中的内容作为参数的一部分
+func splitArgs(line string) ([]string, error) {
+	var (
+		args  []string
+		arg   strings.Builder
+		quote rune
+		inArg bool
+	)
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// discover 从 etcd 中列出 service 注册的所有节点
+func discover(endpoints, service string) ([]string, error) {
+	config.DefaultEtcdConfig = clientv3.Config{
+		Endpoints:   strings.Split(endpoints, ","),
+		DialTimeout: 5 * time.Second,
+	}
+	return discovery.ListServicePeers(service)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "unknown output format %q, expect table or json\n", *output)
+		os.Exit(2)
+	}
+	// 日志输出到标准错误并且只输出警告，避免混入命令的输出
+	logger.LogrusObj.SetOutput(os.Stderr)
+	logger.LogrusObj.SetLevel(logrus.WarnLevel)
+
+	addrs := []string{*addr}
+	if *etcd != "" {
+		var err error
+		if addrs, err = discover(*etcd, *name); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	var opts []grpc.DialOption
+	if *token != "" {
+		opts = append(opts, service.AdminCredentials(*token))
+	}
+	c, err := newClient(addrs, os.Stdout, *output == "json", opts...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer c.Close()
+
+	if flag.NArg() == 0 || flag.Arg(0) == "repl" {
+		err = repl(context.Background(), c, os.Stdin)
+	} else {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err = execute(ctx, c, flag.Args())
+		stop()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		c.Close()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	pb "gocache/api/groupcachepb"
+	service "gocache/internal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startNode 在随机端口上启动一个只有 GroupCache 和 Admin 服务的节点，不注册到 etcd，返回节点地址
+func startNode(t *testing.T, opts ...grpc.ServerOption) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &service.Server{Addr: lis.Addr().String()}
+	s.SetSnapshotDir(t.TempDir())
+	gs := grpc.NewServer(opts...)
+	pb.RegisterGroupCacheServer(gs, s)
+	pb.RegisterAdminServer(gs, service.NewAdmin(s))
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+	return lis.Addr().String()
+}
+
+// connect 连接 addrs 中的节点
+func connect(t *testing.T, addrs ...string) *client {
+	c, err := newClient(addrs, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// run 执行命令并返回输出
+func run(t *testing.T, c *client, args ...string) (string, error) {
+	var out bytes.Buffer
+	c.out = &out
+	err := execute(context.Background(), c, args)
+	return out.String(), err
+}
+
+func TestAdminCommands(t *testing.T) {
+	g := service.NewGroup("cli-admin", "lru", 0, service.RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte("value-" + key), nil
+	}), service.WithTTL(time.Minute), service.WithHotKeys(10, time.Minute))
+	for _, key := range []string{"a", "b", "c", "a"} {
+		g.Get(key)
+	}
+	c := connect(t, startNode(t))
+
+	for _, tc := range []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"groups"}, []string{"cli-admin", "lru", "1m0s"}},
+		{[]string{"stats", "cli-admin"}, []string{"cli-admin  4     1     0.2500"}},
+		{[]string{"hotkeys", "-limit", "1", "cli-admin"}, []string{"cli-admin  a    2"}},
+		{[]string{"peek", "cli-admin", "b"}, []string{`"value-b"`, "expire at"}},
+		{[]string{"keys", "-limit", "2", "cli-admin"}, []string{"a\nb\n", `-after "b"`}},
+		{[]string{"keys", "-after", "b", "cli-admin"}, []string{"c\n"}},
+		{[]string{"snapshot", "cli-admin"}, []string{"cli-admin  3", "cli-admin.snapshot"}},
+		{[]string{"evict", "cli-admin", "a"}, []string{"evicted cli-admin/a"}},
+		{[]string{"purge", "cli-admin"}, []string{"purged 2 entries"}},
+		{[]string{"ring"}, []string{"NODE"}},
+	} {
+		out, err := run(t, c, tc.args...)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.args, err)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(out, want) {
+				t.Fatalf("%v output should contain %q:\n%s", tc.args, want, out)
+			}
+		}
+	}
+
+	if _, err := run(t, c, "peek", "cli-admin", "a"); err == nil {
+		t.Fatal("peek of a purged key should fail")
+	}
+	if _, err := run(t, c, "peek", "cli-admin"); err == nil || !strings.Contains(err.Error(), "usage: peek") {
+		t.Fatalf("err = %v, expect usage", err)
+	}
+	if _, err := run(t, c, "no-such-command"); err == nil {
+		t.Fatal("unknown command should fail")
+	}
+}
+
+func TestAdminToken(t *testing.T) {
+	service.NewGroup("cli-token", "lru", 0, service.RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte("value-" + key), nil
+	}))
+	addr := startNode(t, service.AdminAuth("secret"))
+
+	// 没有 token 时只能访问 GroupCache 服务
+	c := connect(t, addr)
+	if _, err := run(t, c, "groups"); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("err = %v, expect Unauthenticated without a token", err)
+	}
+	if out, err := run(t, c, "get", "cli-token", "k"); err != nil || out != "value-k\n" {
+		t.Fatalf("get = %q, %v, data commands should not need the token", out, err)
+	}
+	if _, err := run(t, c, "stats", "cli-token"); err != nil {
+		t.Fatalf("stats should not need the token: %v", err)
+	}
+	// 写入和删除属于 Admin 服务，同样需要 token
+	for _, args := range [][]string{{"set", "cli-token", "k", "v"}, {"del", "cli-token", "k"}} {
+		if _, err := run(t, c, args...); status.Code(err) != codes.Unauthenticated || !strings.Contains(err.Error(), "-token") {
+			t.Fatalf("%v: %v, expect Unauthenticated with a hint", args, err)
+		}
+	}
+
+	for token, code := range map[string]codes.Code{"wrong": codes.Unauthenticated, "secret": codes.OK} {
+		c, err := newClient([]string{addr}, nil, false, service.AdminCredentials(token))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := run(t, c, "purge", "cli-token"); status.Code(err) != code {
+			t.Fatalf("purge with token %q: %v, expect %v", token, err, code)
+		}
+		c.Close()
+	}
+}
+
+func TestDataCommands(t *testing.T) {
+	service.NewGroup("cli-data", "lru", 0, service.RetrieveFunc(func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, service.ErrNotFound
+		}
+		return []byte("value-" + key), nil
+	}), service.WithTTL(time.Minute))
+	c := connect(t, startNode(t), startNode(t))
+	owner := c.owner("k1").addr
+
+	for _, tc := range []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"set", "cli-data", "k1", "v1"}, []string{"set cli-data/k1 on " + owner}},
+		{[]string{"get", "cli-data", "k1"}, []string{"v1\n"}},
+		{[]string{"mget", "cli-data", "k1", "x", "missing"}, []string{`"v1"`, `"value-x"`, "(not found)"}},
+		{[]string{"del", "cli-data", "k1"}, []string{"deleted cli-data/k1 on " + owner}},
+		{[]string{"del", "cli-data", "k1"}, []string{"is not cached"}},
+		{[]string{"stats", "cli-data"}, []string{"== " + c.nodes[0].addr + " ==", "== " + c.nodes[1].addr + " =="}},
+	} {
+		out, err := run(t, c, tc.args...)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.args, err)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(out, want) {
+				t.Fatalf("%v output should contain %q:\n%s", tc.args, want, out)
+			}
+		}
+	}
+	if _, err := run(t, c, "get", "cli-data", "missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("err = %v, expect not found", err)
+	}
+
+	c.json = true
+	out, err := run(t, c, "get", "cli-data", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e entry
+	if err := json.Unmarshal([]byte(out), &e); err != nil {
+		t.Fatalf("%v:\n%s", err, out)
+	}
+	if !e.Found || e.Value != "value-x" || e.Node != c.owner("x").addr {
+		t.Fatalf("get -o json = %+v", e)
+	}
+
+	// 多个节点的结果以节点地址为键，protobuf 消息输出零值字段
+	out, err = run(t, c, "stats", "cli-data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var perNode map[string]struct {
+		Groups []map[string]any `json:"groups"`
+	}
+	if err := json.Unmarshal([]byte(out), &perNode); err != nil {
+		t.Fatalf("%v:\n%s", err, out)
+	}
+	if len(perNode) != 2 || len(perNode[owner].Groups) != 1 || perNode[owner].Groups[0]["stale_hits"] != "0" {
+		t.Fatalf("stats -o json = %s", out)
+	}
+}
+
+// syncBuffer 可以并发读写的输出
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWatchCommand(t *testing.T) {
+	g := service.NewGroup("cli-watch", "lru", 0, service.RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte("value-" + key), nil
+	}))
+	c := connect(t, startNode(t))
+	out := &syncBuffer{}
+	c.out = out
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- execute(ctx, c, []string{"watch", "-types", "set", "cli-watch"}) }()
+
+	// 订阅建立之前的写入不会推送，重复写入直到收到事件
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(out.String(), "SET") {
+		if time.Now().After(deadline) {
+			t.Fatalf("no event received:\n%s", out.String())
+		}
+		g.Set("k", []byte("v"))
+		g.Delete("other")
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, `k  "v"`) || strings.Contains(got, "DELETED") {
+		t.Fatalf("watch output:\n%s", got)
+	}
+
+	if _, err := run(t, c, "watch", "-types", "nope", "cli-watch"); err == nil {
+		t.Fatal("unknown event type should fail")
+	}
+}
+
+func TestRepl(t *testing.T) {
+	service.NewGroup("cli-repl", "lru", 0, service.RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte("value-" + key), nil
+	}))
+	c := connect(t, startNode(t))
+	var out bytes.Buffer
+	c.out = &out
+
+	in := strings.NewReader("set cli-repl k 'hello world'\n\nget cli-repl k\nbogus\nget cli-repl\nexit\nget cli-repl never\n")
+	if err := repl(context.Background(), c, in); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	for _, want := range []string{"hello world\n", `error: unknown command "bogus"`, "error: usage: get"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("repl output should contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "value-never") {
+		t.Fatalf("commands after exit should not run:\n%s", got)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"  get  scores 张三 ", []string{"get", "scores", "张三"}},
+		{`set g k "a b" 'c "d"'`, []string{"set", "g", "k", "a b", `c "d"`}},
+		{`set g k ""`, []string{"set", "g", "k", ""}},
+	} {
+		got, err := splitArgs(tc.line)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.line, err)
+		}
+		if strings.Join(got, "|") != strings.Join(tc.want, "|") || len(got) != len(tc.want) {
+			t.Fatalf("splitArgs(%q) = %q, want %q", tc.line, got, tc.want)
+		}
+	}
+	if _, err := splitArgs(`get "unterminated`); err == nil {
+		t.Fatal("unterminated quote should fail")
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gocache/internal/policy"
+	"gocache/internal/policy/interfaces"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+/*
+policysim 回放访问轨迹，统计每种淘汰策略在不同缓存容量下的命中率
+
+	go run ./cmd/policysim -trace P1.lis -format arc -sizes 1048576,16777216
+	go run ./cmd/policysim -trace keys.log -format keys -policies lru,lfu
+*/
+
+var (
+	tracePath = flag.String("trace", "", "access trace file")
+	format    = flag.String("format", "keys", "trace format: arc, lirs or keys")
+	policies  = flag.String("policies", strings.Join(policy.Names(), ","), "comma separated policies to simulate")
+	sizes     = flag.String("sizes", "1048576", "comma separated cache sizes in bytes")
+	valueSize = flag.Int("value-size", 4096, "value size in bytes when the trace does not carry one")
+	overhead  = flag.Bool("overhead", false, "count per-entry structural overhead of each policy toward the cache size")
+)
+
+type value int
+
+func (v value) Len() int {
+	return int(v)
+}
+
+type result struct {
+	policy   string
+	maxBytes int64
+	hits     int
+	misses   int
+}
+
+func (r result) hitRatio() float64 {
+	if r.hits+r.misses == 0 {
+		return 0
+	}
+	return float64(r.hits) / float64(r.hits+r.misses)
+}
+
+// simulate 用指定策略回放轨迹：命中则计数，未命中则模拟回源并写入缓存
+func simulate(name string, maxBytes int64, trace []access, opts ...interfaces.Option) (result, error) {
+	strategy := policy.New(name, maxBytes, nil, opts...)
+	if strategy == nil {
+		return result{}, fmt.Errorf("unknown policy %q", name)
+	}
+
+	r := result{policy: name, maxBytes: maxBytes}
+	for _, a := range trace {
+		if _, _, ok := strategy.Get(a.key); ok {
+			r.hits++
+			continue
+		}
+		r.misses++
+		strategy.Add(a.key, value(a.size))
+	}
+	return r, nil
+}
+
+func main() {
+	flag.Parse()
+
+	if *tracePath == "" {
+		fmt.Fprintln(os.Stderr, "-trace is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(*tracePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	trace, err := readTrace(f, *format, *valueSize)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read trace %s failed: %v\n", *tracePath, err)
+		os.Exit(1)
+	}
+
+	var cacheSizes []int64
+	for _, s := range strings.Split(*sizes, ",") {
+		size, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil || size <= 0 {
+			fmt.Fprintf(os.Stderr, "invalid cache size %q\n", s)
+			os.Exit(2)
+		}
+		cacheSizes = append(cacheSizes, size)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "POLICY\tSIZE\tREQUESTS\tHITS\tHIT RATIO\n")
+	for _, name := range strings.Split(*policies, ",") {
+		for _, size := range cacheSizes {
+			name = strings.TrimSpace(name)
+			var opts []interfaces.Option
+			if *overhead {
+				opts = append(opts, interfaces.WithSizer(policy.OverheadSizer(name)))
+			}
+			r, err := simulate(name, size, trace, opts...)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.4f\n", r.policy, r.maxBytes, r.hits+r.misses, r.hits, r.hitRatio())
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*
+access 访问轨迹中的一次访问
+  - key：访问的 key
+  - size：该 key 对应缓存值的字节数，轨迹中没有给出时使用 -value-size
+*/
+type access struct {
+	key  string
+	size int
+}
+
+/*
+readTrace 按格式解析访问轨迹，支持三种格式：
+  - arc：ARC 论文使用的块轨迹，每行 "起始块号 块数 忽略字段 请求序号"，展开为连续的块访问
+  - lirs：LIRS 论文使用的块轨迹，每行一个块号，'*' 开头的行为分隔标记
+  - keys：gocache 自己的 key 日志，每行 "key [size]"
+*/
+func readTrace(r io.Reader, format string, valueSize int) ([]access, error) {
+	var parse func(fields []string) ([]access, error)
+	switch format {
+	case "arc":
+		parse = func(fields []string) ([]access, error) {
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("arc trace expects at least 2 fields, got %d", len(fields))
+			}
+			start, err := strconv.ParseInt(fields[0], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			n, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			accesses := make([]access, 0, n)
+			for i := int64(0); i < n; i++ {
+				accesses = append(accesses, access{key: strconv.FormatInt(start+i, 10), size: valueSize})
+			}
+			return accesses, nil
+		}
+	case "lirs":
+		parse = func(fields []string) ([]access, error) {
+			if strings.HasPrefix(fields[0], "*") {
+				return nil, nil
+			}
+			if _, err := strconv.ParseInt(fields[0], 10, 64); err != nil {
+				return nil, err
+			}
+			return []access{{key: fields[0], size: valueSize}}, nil
+		}
+	case "keys":
+		parse = func(fields []string) ([]access, error) {
+			size := valueSize
+			if len(fields) > 1 {
+				s, err := strconv.Atoi(fields[1])
+				if err != nil {
+					return nil, err
+				}
+				size = s
+			}
+			return []access{{key: fields[0], size: size}}, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown trace format %q, expect arc, lirs or keys", format)
+	}
+
+	var trace []access
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		accesses, err := parse(fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		trace = append(trace, accesses...)
+	}
+	return trace, scanner.Err()
+}
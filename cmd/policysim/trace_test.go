@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadTrace(t *testing.T) {
+	tests := []struct {
+		format string
+		input  string
+		expect []access
+	}{
+		{"arc", "10 3 0 1\n20 1 0 2\n", []access{{"10", 8}, {"11", 8}, {"12", 8}, {"20", 8}}},
+		{"lirs", "5\n*\n7\n", []access{{"5", 8}, {"7", 8}}},
+		{"keys", "# comment\n张三\n李四 100\n", []access{{"张三", 8}, {"李四", 100}}},
+	}
+
+	for _, tt := range tests {
+		trace, err := readTrace(strings.NewReader(tt.input), tt.format, 8)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if !reflect.DeepEqual(trace, tt.expect) {
+			t.Fatalf("%s: trace = %v, expect %v", tt.format, trace, tt.expect)
+		}
+	}
+
+	if _, err := readTrace(strings.NewReader("x\n"), "lirs", 8); err == nil {
+		t.Fatal("expect error for invalid lirs block number")
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	trace := []access{{"a", 1}, {"b", 1}, {"a", 1}, {"a", 1}}
+	r, err := simulate("lru", 0, trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.hits != 2 || r.misses != 2 {
+		t.Fatalf("hits = %d, misses = %d, expect 2 and 2", r.hits, r.misses)
+	}
+}
@@ -16,10 +16,18 @@ var DefaultEtcdConfig clientv3.Config //etcd客户端配置
 var once sync.Once
 
 type Config struct {
-	Mysql    *MySQL              `yaml:"mysql"`
-	Etcd     *Etcd               `yaml:"etcd"`
-	Services map[string]*Service `yaml:"services"`
-	Domain   map[string]*Domain  `yaml:"domain"`
+	Mysql       *MySQL              `yaml:"mysql"`
+	Etcd        *Etcd               `yaml:"etcd"`
+	Services    map[string]*Service `yaml:"services"`
+	Domain      map[string]*Domain  `yaml:"domain"`
+	Groups      map[string]*Group   `yaml:"groups"`
+	Memory      *Memory             `yaml:"memory"`
+	TimingWheel *TimingWheel        `yaml:"timingWheel"`
+	Metrics     *Metrics            `yaml:"metrics"`
+	Tracing     *Tracing            `yaml:"tracing"`
+	Logger      *Logger             `yaml:"logger"`
+	Snapshot    *Snapshot           `yaml:"snapshot"`
+	Admin       *Admin              `yaml:"admin"`
 }
 
 type MySQL struct {
@@ -43,6 +51,102 @@ type Service struct {
 	TTL          int      `yaml:"ttl"`
 }
 
+// Group 缓存命名空间的配置，未配置的 group 使用默认值
+type Group struct {
+	Policy      string `yaml:"policy"`      // 淘汰策略：lru、lfu、fifo
+	MaxBytes    int64  `yaml:"maxBytes"`    // 缓存容量（字节）
+	MaxEntries  int    `yaml:"maxEntries"`  // 条目数量上限，0 表示不限制
+	Accounting  string `yaml:"accounting"`  // 容量统计方式：overhead（计入结构开销，默认）、bytes（只统计 key 和 value）
+	TTL         int    `yaml:"ttl"`         // 条目存活时间（秒），0 表示使用 services.groupcache.ttl
+	SoftTTL     int    `yaml:"softTTL"`     // 软 TTL（秒），超过后返回旧值并在后台刷新，0 表示关闭
+	NegativeTTL int    `yaml:"negativeTTL"` // 数据源中不存在的 key 的负缓存时间（秒），0 表示默认 5 秒
+	Grace       int    `yaml:"grace"`       // 硬 TTL 之后保留旧值的时间（秒），回源失败时返回，0 表示关闭
+
+	TTLJitter float64 `yaml:"ttlJitter"` // TTL 随机缩短的比例（0~1），打散同一时刻写入的条目的过期时间
+	EarlyBeta float64 `yaml:"earlyBeta"` // 概率提前过期（XFetch）的 beta，0 表示关闭，通常取 1
+
+	BloomFilter   bool    `yaml:"bloomFilter"`   // 是否开启布隆过滤器，拦截数据库中不存在的 key
+	BloomExpected int     `yaml:"bloomExpected"` // 预计的 key 数量
+	BloomFPRate   float64 `yaml:"bloomFPRate"`   // 期望误判率，0 表示默认 0.01
+	BloomRebuild  int     `yaml:"bloomRebuild"`  // 定期重建的间隔（秒），0 表示只在启动时构建
+
+	RefreshAhead       int `yaml:"refreshAhead"`       // 热点 key 在过期前多少秒提前刷新，0 表示关闭
+	RefreshHits        int `yaml:"refreshHits"`        // 最近两个 TTL 周期内命中多少次视为热点
+	RefreshConcurrency int `yaml:"refreshConcurrency"` // 同时进行的提前刷新数量上限
+
+	FlightTTL     int `yaml:"flightTTL"`     // SingleFlight 缓存回源结果的时间（秒），0 表示默认 10 秒，负数表示关闭
+	FlightEntries int `yaml:"flightEntries"` // SingleFlight 缓存的结果数量上限，0 表示默认 1024
+	LoadLease     int `yaml:"loadLease"`     // 回源租约的有效期（秒），开启后整个集群同一时刻只有一个节点为同一个 key 查询数据库，0 表示关闭
+
+	BatchWindow  int `yaml:"batchWindow"`  // 合并回源的时间窗口（毫秒），窗口内的未命中合并为一次批量查询，0 表示关闭
+	BatchSize    int `yaml:"batchSize"`    // 每个批次的 key 数量上限，0 表示不限制
+	BatchTimeout int `yaml:"batchTimeout"` // 一次批量查询的超时（毫秒），0 表示使用默认的 5 秒
+
+	HotKeys            int   `yaml:"hotKeys"`            // 统计访问最多的 key 的数量，0 表示关闭
+	HotKeyDecay        int   `yaml:"hotKeyDecay"`        // 热点计数减半的周期（秒），0 表示默认 60 秒
+	HotReplicaMinCount int64 `yaml:"hotReplicaMinCount"` // 估计访问次数达到多少的热点 key 从负责节点复制到本地
+	HotReplicaBytes    int64 `yaml:"hotReplicaBytes"`    // 热点副本的缓存容量（字节），0 表示不复制
+	HotReplicaTTL      int   `yaml:"hotReplicaTTL"`      // 热点副本的存活时间（秒）
+}
+
+// Memory 进程级内存预算配置，Budget 为 0 时各 group 独立使用自己的 maxBytes
+type Memory struct {
+	Budget           int64   `yaml:"budget"`           // 所有 group 共享的总字节数
+	MinGroupBytes    int64   `yaml:"minGroupBytes"`    // 每个 group 的保底容量
+	Interval         int     `yaml:"interval"`         // 再平衡周期（秒）
+	MemoryLimitRatio float64 `yaml:"memoryLimitRatio"` // 跟随 GOMEMLIMIT 时可用于缓存的比例，0 表示不跟随
+}
+
+// TimingWheel 所有缓存共享的过期时间轮，精度越高后台推进越频繁
+type TimingWheel struct {
+	Tick      int `yaml:"tick"`      // 时间精度（毫秒）
+	WheelSize int `yaml:"wheelSize"` // 每层的槽数
+}
+
+// Metrics Prometheus 指标监听配置，同一台机器上的多个节点按各自的服务端口加上偏移量监听
+type Metrics struct {
+	Enable     bool `yaml:"enable"`     // 是否开启 HTTP 指标监听
+	PortOffset int  `yaml:"portOffset"` // 指标端口 = 服务端口 + portOffset
+}
+
+// Tracing OpenTelemetry 链路追踪配置，exporter 为 none、stdout、file 或 otlp
+type Tracing struct {
+	Exporter    string  `yaml:"exporter"`    // 导出器，默认 none 只传播上下文不导出
+	Endpoint    string  `yaml:"endpoint"`    // otlp 收集器的 gRPC 地址
+	File        string  `yaml:"file"`        // file 导出器写入的文件
+	SampleRatio float64 `yaml:"sampleRatio"` // 根 span 采样比例，0 表示全部采样
+	ServiceName string  `yaml:"serviceName"` // 上报的服务名，默认 gocache
+}
+
+// Logger 日志配置，热路径日志（命中、选点、淘汰等）只在 debug 级别按采样输出
+type Logger struct {
+	Level    string       `yaml:"level"`    // trace、debug、info、warn、error
+	Format   string       `yaml:"format"`   // text 或 json
+	Output   string       `yaml:"output"`   // stdout、file 或 both
+	Dir      string       `yaml:"dir"`      // 日志目录，默认工作目录下的 logs，按天切分
+	MaxAge   int          `yaml:"maxAge"`   // 日志保留天数，0 表示不清理
+	Sampling *LogSampling `yaml:"sampling"` // 热路径日志采样
+}
+
+// LogSampling 每个 tick 内同一条热路径日志先输出 initial 条，之后每 thereafter 条输出一条
+type LogSampling struct {
+	Tick       int `yaml:"tick"` // millisecond
+	Initial    int `yaml:"initial"`
+	Thereafter int `yaml:"thereafter"`
+}
+
+// Snapshot 缓存快照配置，快照由 Admin.Snapshot 触发写入
+type Snapshot struct {
+	Dir            string `yaml:"dir"`            // 快照目录，每个 group 一个 <group>.snapshot 文件
+	RestoreOnStart bool   `yaml:"restoreOnStart"` // 启动时从快照恢复缓存，跳过已经过期的条目
+}
+
+// Admin 管理服务配置，默认关闭；开启后与缓存服务共用端口
+type Admin struct {
+	Enable bool   `yaml:"enable"`
+	Token  string `yaml:"token"` // 非空时客户端必须携带相同的 token，gocache-cli 使用 -token 指定
+}
+
 type Domain struct {
 	Name string `yaml:"name"`
 }
@@ -0,0 +1,390 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	pb "gocache/api/groupcachepb"
+	"gocache/utils/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSnapshotDir  = "snapshots"
+	defaultKeysPageSize = 100
+)
+
+/*
+GroupConfig Group 的配置
+  - Policy、MaxBytes 为当前值，可能已经被 SetPolicy、Resize 或内存管理器调整
+  - 其余为创建 Group 时的选项，0 表示未开启
+*/
+type GroupConfig struct {
+	Policy       string
+	MaxBytes     int64
+	MaxEntries   int
+	TTL          time.Duration
+	SoftTTL      time.Duration
+	Grace        time.Duration
+	NegativeTTL  time.Duration
+	BloomFilter  bool
+	RefreshAhead time.Duration
+	LoadLease    time.Duration
+	BatchWindow  time.Duration
+	HotKeys      int
+	ReplicaBytes int64
+}
+
+// Config 返回 Group 的配置
+func (g *Group) Config() GroupConfig {
+	o := g.options
+	policy, maxBytes := g.mainCache.settings()
+	return GroupConfig{
+		Policy:       policy,
+		MaxBytes:     maxBytes,
+		MaxEntries:   o.maxEntries,
+		TTL:          o.ttl,
+		SoftTTL:      o.softTTL,
+		Grace:        o.grace,
+		NegativeTTL:  o.negativeTTL,
+		BloomFilter:  g.keys != nil,
+		RefreshAhead: o.refreshAhead,
+		LoadLease:    o.loadLease,
+		BatchWindow:  o.batchWindow,
+		HotKeys:      o.hotKeys,
+		ReplicaBytes: o.replicaBytes,
+	}
+}
+
+/*
+EntryInfo 缓存中的一个条目
+  - Negative 为数据源中不存在的 key 的负缓存条目，没有值
+  - Replica 为从负责节点复制到本地的热点 key
+  - FreshUntil、ExpireAt 为软、硬过期时间，零值表示没有
+*/
+type EntryInfo struct {
+	Value      ByteView
+	Negative   bool
+	Replica    bool
+	FreshUntil time.Time
+	ExpireAt   time.Time
+}
+
+// Peek 查看本节点缓存中的条目，不计入统计，不改变条目在淘汰策略中的价值，也不会回源
+func (g *Group) Peek(key string) (EntryInfo, bool) {
+	it, ok := g.mainCache.peek(key)
+	replica := false
+	if !ok && g.replicas != nil {
+		it, ok = g.replicas.peek(key)
+		replica = ok
+	}
+	if !ok {
+		return EntryInfo{}, false
+	}
+	return EntryInfo{Value: it.view, Negative: it.negative, Replica: replica, FreshUntil: it.freshUntil, ExpireAt: it.expireAt}, true
+}
+
+/*
+Keys 按字典序分页列出本节点缓存中以 prefix 开头的 key（不包括热点副本）
+  - 返回大于 after 的最多 limit 个 key，limit <= 0 时返回全部
+  - 还有更多 key 时 next 为本页最后一个 key，作为下一页的 after；否则为空
+  - 每次调用都会复制并排序所有条目，只用于排查问题
+*/
+func (g *Group) Keys(prefix string, after string, limit int) (keys []string, next string) {
+	for _, e := range g.mainCache.entries() {
+		if strings.HasPrefix(e.Key, prefix) && e.Key > after {
+			keys = append(keys, e.Key)
+		}
+	}
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+		next = keys[limit-1]
+	}
+	return keys, next
+}
+
+/*
+Purge 清空本节点上的缓存，返回清空的条目数
+  - 同时清空热点副本和 SingleFlight 缓存的结果，不计入淘汰统计
+  - 发布一个 EventPurged 事件，而不是每个条目一个事件
+*/
+func (g *Group) Purge() int {
+	g.flight.InvalidateAll()
+	n := g.mainCache.purge()
+	if g.replicas != nil {
+		n += g.replicas.purge()
+	}
+	g.events.publish(EventPurged, "", ByteView{})
+	return n
+}
+
+// RingNode 哈希环上的一个节点
+type RingNode struct {
+	Addr         string
+	VirtualNodes int
+	Share        float64 // 负责的哈希空间比例
+	Self         bool
+}
+
+// Ring 返回当前哈希环上的节点，按地址排序；服务停止后返回空
+func (s *Server) Ring() []RingNode {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.consHash == nil {
+		return nil
+	}
+	shares, vnodes := s.consHash.Shares()
+	nodes := make([]RingNode, 0, len(shares))
+	for addr, share := range shares {
+		nodes = append(nodes, RingNode{Addr: addr, VirtualNodes: vnodes[addr], Share: share, Self: addr == s.Addr})
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Addr < nodes[j].Addr
+	})
+	return nodes
+}
+
+// SetSnapshotDir 设置 Admin.Snapshot 写入快照的目录，默认为工作目录下的 snapshots
+func (s *Server) SetSnapshotDir(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshotDir = dir
+}
+
+/*
+Admin 节点的管理服务，开启 WithAdmin 时与 GroupCache 服务注册在同一个 gRPC 服务器上
+  - 所有操作只作用于提供服务的节点，查看或清空整个集群需要分别访问每个节点
+  - Set、Delete、Purge 等操作可以改写或清空缓存，默认不注册；配置 token 时请求必须携带 AdminCredentials
+*/
+type Admin struct {
+	pb.UnimplementedAdminServer
+
+	server *Server
+}
+
+// NewAdmin 创建节点 s 的管理服务，Server 开启 WithAdmin 时自动注册
+func NewAdmin(s *Server) *Admin {
+	return &Admin{server: s}
+}
+
+// adminMethodPrefix Admin 服务方法的完整名称前缀
+var adminMethodPrefix = "/" + pb.Admin_ServiceDesc.ServiceName + "/"
+
+/*
+AdminAuth 返回检查 Admin 请求 token 的 gRPC 服务器选项
+  - 请求的 authorization 元数据必须为 "Bearer <token>"，否则返回 Unauthenticated
+  - 只检查 Admin 服务的方法，GroupCache 服务不受影响
+*/
+func AdminAuth(token string) grpc.ServerOption {
+	want := []byte("Bearer " + token)
+	return grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !strings.HasPrefix(info.FullMethod, adminMethodPrefix) {
+			return handler(ctx, req)
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, v := range md.Get("authorization") {
+			if subtle.ConstantTimeCompare([]byte(v), want) == 1 {
+				return handler(ctx, req)
+			}
+		}
+		return nil, status.Error(codes.Unauthenticated, "admin token is required")
+	})
+}
+
+// adminCredentials 在每个请求中携带 Admin 的 token
+type adminCredentials string
+
+func (c adminCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(c)}, nil
+}
+
+// RequireTransportSecurity 节点之间没有启用 TLS，token 允许通过明文连接发送
+func (c adminCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// AdminCredentials 返回携带 token 访问 Admin 服务的连接选项，与节点的 AdminAuth 对应
+func AdminCredentials(token string) grpc.DialOption {
+	return grpc.WithPerRPCCredentials(adminCredentials(token))
+}
+
+// group 返回请求中的 group，名称为空或不存在时返回对应的 gRPC 错误
+func (a *Admin) group(name string) (*Group, error) {
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "group name is required")
+	}
+	g := a.server.group(name)
+	if g == nil {
+		return nil, status.Errorf(codes.NotFound, "group %s not found", name)
+	}
+	return g, nil
+}
+
+// ListGroups 返回所有 group 的配置和缓存占用，按名称排序
+func (a *Admin) ListGroups(ctx context.Context, req *pb.ListGroupsRequest) (*pb.ListGroupsResponse, error) {
+	resp := &pb.ListGroupsResponse{}
+	groups, _ := a.server.requestedGroups("")
+	for _, g := range groups {
+		c := g.Config()
+		items, bytes := g.mainCache.usage()
+		resp.Groups = append(resp.Groups, &pb.GroupInfo{
+			Name:              g.name,
+			Policy:            c.Policy,
+			MaxBytes:          c.MaxBytes,
+			MaxEntries:        int64(c.MaxEntries),
+			TtlNanos:          int64(c.TTL),
+			SoftTtlNanos:      int64(c.SoftTTL),
+			GraceNanos:        int64(c.Grace),
+			NegativeTtlNanos:  int64(c.NegativeTTL),
+			BloomFilter:       c.BloomFilter,
+			RefreshAheadNanos: int64(c.RefreshAhead),
+			LoadLeaseNanos:    int64(c.LoadLease),
+			BatchWindowNanos:  int64(c.BatchWindow),
+			HotKeys:           int64(c.HotKeys),
+			ReplicaBytes:      c.ReplicaBytes,
+			Items:             int64(items),
+			Bytes:             bytes,
+		})
+	}
+	return resp, nil
+}
+
+// Stats 与 GroupCache.Stats 相同
+func (a *Admin) Stats(ctx context.Context, req *pb.StatsRequest) (*pb.StatsResponse, error) {
+	return a.server.Stats(ctx, req)
+}
+
+// Peek 查看条目，不影响淘汰顺序；条目不存在时 found 为 false，而不是返回错误
+func (a *Admin) Peek(ctx context.Context, req *pb.PeekRequest) (*pb.PeekResponse, error) {
+	g, err := a.group(req.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	e, ok := g.Peek(req.GetKey())
+	if !ok {
+		return &pb.PeekResponse{}, nil
+	}
+	return &pb.PeekResponse{
+		Found:               true,
+		Value:               e.Value.ByteSlice(),
+		Negative:            e.Negative,
+		Replica:             e.Replica,
+		FreshUntilUnixNanos: unixNano(e.FreshUntil),
+		ExpireAtUnixNanos:   unixNano(e.ExpireAt),
+	}, nil
+}
+
+// ListKeys 按字典序分页列出以 prefix 开头的 key
+func (a *Admin) ListKeys(ctx context.Context, req *pb.ListKeysRequest) (*pb.ListKeysResponse, error) {
+	g, err := a.group(req.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	size := int(req.GetPageSize())
+	if size <= 0 {
+		size = defaultKeysPageSize
+	}
+	keys, next := g.Keys(req.GetPrefix(), req.GetPageToken(), size)
+	return &pb.ListKeysResponse{Keys: keys, NextPageToken: next}, nil
+}
+
+// Purge 清空 group 在本节点上的缓存
+func (a *Admin) Purge(ctx context.Context, req *pb.PurgeRequest) (*pb.PurgeResponse, error) {
+	g, err := a.group(req.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.PurgeResponse{Removed: int64(g.Purge())}, nil
+}
+
+// Evict 删除本节点上的一个 key，与 Group.Delete 相同
+func (a *Admin) Evict(ctx context.Context, req *pb.EvictRequest) (*pb.EvictResponse, error) {
+	g, err := a.group(req.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	if req.GetKey() == "" {
+		return nil, status.Error(codes.InvalidArgument, "key is required")
+	}
+	return &pb.EvictResponse{Removed: g.Delete(req.GetKey())}, nil
+}
+
+/*
+Set 在本节点上写入 key 的最新值，与 Group.Set 相同只作用于当前节点
+  - 客户端应当按 NewPeerRing 把请求发给 key 的负责节点，其他节点之后从负责节点读到新值
+*/
+func (a *Admin) Set(ctx context.Context, req *pb.SetRequest) (*pb.SetResponse, error) {
+	logger.SampledDebugf("[Groupcache server %s] Recv Set - (%s)/(%s)", a.server.Addr, req.GetGroup(), req.GetKey())
+	g, err := a.group(req.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	if req.GetKey() == "" {
+		return nil, status.Error(codes.InvalidArgument, "key is required")
+	}
+	return &pb.SetResponse{}, g.Set(req.GetKey(), req.GetValue())
+}
+
+/*
+Delete 在本节点上删除 key，与 Group.Delete 相同只作用于当前节点
+  - 其他节点上的热点副本在副本 TTL 之后过期
+*/
+func (a *Admin) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	logger.SampledDebugf("[Groupcache server %s] Recv Delete - (%s)/(%s)", a.server.Addr, req.GetGroup(), req.GetKey())
+	g, err := a.group(req.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	if req.GetKey() == "" {
+		return nil, status.Error(codes.InvalidArgument, "key is required")
+	}
+	return &pb.DeleteResponse{Removed: g.Delete(req.GetKey())}, nil
+}
+
+// Ring 返回本节点看到的哈希环和访问各远程节点的统计
+func (a *Admin) Ring(ctx context.Context, req *pb.RingRequest) (*pb.RingResponse, error) {
+	resp := &pb.RingResponse{Self: a.server.Addr}
+	for _, n := range a.server.Ring() {
+		resp.Nodes = append(resp.Nodes, &pb.RingNode{Addr: n.Addr, VirtualNodes: int64(n.VirtualNodes), Share: n.Share, Self: n.Self})
+	}
+	for _, p := range a.server.PeerStats() {
+		resp.Peers = append(resp.Peers, &pb.PeerStats{
+			Addr:       p.Addr,
+			Fetches:    p.Fetches,
+			Errors:     p.Errors,
+			TotalNanos: int64(p.TotalLatency),
+			MaxNanos:   int64(p.MaxLatency),
+		})
+	}
+	return resp, nil
+}
+
+// Snapshot 把 group 的缓存写入快照目录，请求中 group 为空时写入所有 group
+func (a *Admin) Snapshot(ctx context.Context, req *pb.SnapshotRequest) (*pb.SnapshotResponse, error) {
+	groups, err := a.server.requestedGroups(req.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	a.server.mu.Lock()
+	dir := a.server.snapshotDir
+	a.server.mu.Unlock()
+	if dir == "" {
+		dir = defaultSnapshotDir
+	}
+
+	resp := &pb.SnapshotResponse{}
+	for _, g := range groups {
+		path, n, err := g.SnapshotFile(dir)
+		if err != nil {
+			return resp, status.Errorf(codes.Internal, "snapshot group %s: %v", g.name, err)
+		}
+		resp.Snapshots = append(resp.Snapshots, &pb.SnapshotResult{Group: g.name, Path: path, Entries: int64(n)})
+	}
+	return resp, nil
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	pb "gocache/api/groupcachepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestGroupPeek(t *testing.T) {
+	g := NewGroup("admin-peek", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, ErrNotFound
+		}
+		return []byte("value-" + key), nil
+	}), WithMaxEntries(3), WithTTL(time.Minute), WithNegativeTTL(time.Minute))
+	g.Get("a")
+	g.Get("b")
+	gets := g.Stats().Gets
+
+	e, ok := g.Peek("a")
+	if !ok || e.Value.String() != "value-a" || e.Negative || e.ExpireAt.IsZero() {
+		t.Fatalf("Peek(a) = %+v, %v", e, ok)
+	}
+	if _, ok := g.Peek("c"); ok {
+		t.Fatal("Peek should not load missing keys")
+	}
+	if g.Stats().Gets != gets {
+		t.Fatal("Peek should not count as a get")
+	}
+	// Peek 不改变 LRU 顺序，a 仍然最先被淘汰
+	g.Get("missing")
+	g.Get("d")
+	if _, ok := g.Peek("a"); ok {
+		t.Fatal("peeked key should still be the least recently used")
+	}
+	if e, ok := g.Peek("missing"); !ok || !e.Negative {
+		t.Fatalf("Peek(missing) = %+v, %v, expect a negative entry", e, ok)
+	}
+}
+
+func TestGroupKeysAndPurge(t *testing.T) {
+	g := NewGroup("admin-keys", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	}))
+	for _, key := range []string{"user:3", "user:1", "other", "user:2", "user:4"} {
+		g.Set(key, []byte("value"))
+	}
+
+	var pages [][]string
+	after := ""
+	for {
+		keys, next := g.Keys("user:", after, 3)
+		pages = append(pages, keys)
+		if next == "" {
+			break
+		}
+		after = next
+	}
+	want := [][]string{{"user:1", "user:2", "user:3"}, {"user:4"}}
+	if !reflect.DeepEqual(pages, want) {
+		t.Fatalf("pages = %v, expect %v", pages, want)
+	}
+	if keys, _ := g.Keys("", "", 0); len(keys) != 5 {
+		t.Fatalf("all keys = %v, expect 5", keys)
+	}
+
+	sub := g.Subscribe(1, EventPurged)
+	defer sub.Close()
+	if n := g.Purge(); n != 5 {
+		t.Fatalf("purged %d entries, expect 5", n)
+	}
+	if st := g.Stats(); st.Items != 0 || st.Bytes != 0 || st.Evictions != 0 {
+		t.Fatalf("stats after purge = %+v", st)
+	}
+	if e := nextEvent(t, sub); e.Type != EventPurged {
+		t.Fatalf("got %s, expect purged", e.Type)
+	}
+}
+
+func TestGroupSnapshotRestore(t *testing.T) {
+	src := NewGroup("snapshot-src", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}), WithStaleWhileRevalidate(time.Minute, time.Hour), WithNegativeTTL(time.Minute))
+	src.Set("a", []byte("1"))
+	src.Set("b", []byte("2"))
+	src.Set("c", []byte{})
+	src.Get("missing")
+
+	var buf bytes.Buffer
+	n, err := src.Snapshot(&buf)
+	if err != nil || n != 3 {
+		t.Fatalf("Snapshot = %d, %v, expect 3 entries without the negative one", n, err)
+	}
+
+	dst := NewGroup("snapshot-dst", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}), WithMaxEntries(2))
+	if n, err := dst.Restore(bytes.NewReader(buf.Bytes())); err != nil || n != 3 {
+		t.Fatalf("Restore = %d, %v", n, err)
+	}
+	// 按价值从低到高恢复，容量不足时淘汰的是快照中价值最低的 a
+	if _, ok := dst.Peek("a"); ok {
+		t.Fatal("least valuable entry should be evicted when the restored cache is smaller")
+	}
+	for _, key := range []string{"b", "c"} {
+		want, _ := src.Peek(key)
+		got, ok := dst.Peek(key)
+		if !ok || got.Value.String() != want.Value.String() || !got.ExpireAt.Equal(want.ExpireAt) || !got.FreshUntil.Equal(want.FreshUntil) {
+			t.Fatalf("restored %s = %+v, expect %+v", key, got, want)
+		}
+	}
+
+	if _, err := dst.Restore(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); err == nil {
+		t.Fatal("truncated snapshot should fail")
+	}
+	if _, err := dst.Restore(bytes.NewReader([]byte("not a snapshot"))); err == nil {
+		t.Fatal("invalid snapshot should fail")
+	}
+
+	dir := t.TempDir()
+	if _, n, err := src.SnapshotFile(dir); err != nil || n != 3 {
+		t.Fatalf("SnapshotFile = %d, %v", n, err)
+	}
+	if n, err := dst.RestoreFile(dir); err != nil || n != 0 {
+		t.Fatalf("RestoreFile without a snapshot of its own = %d, %v", n, err)
+	}
+}
+
+func TestRestoreCorruptedLength(t *testing.T) {
+	g := NewGroup("snapshot-corrupted", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}))
+	// key 的长度声明为 512MB，实际只有几个字节
+	data := binary.AppendUvarint([]byte(snapshotMagic), 1<<29)
+	data = append(data, "abc"...)
+	dir := t.TempDir()
+	if err := os.WriteFile(snapshotFile(dir, "snapshot-corrupted"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, restore := range map[string]func() (int, error){
+		"sized":   func() (int, error) { return g.Restore(bytes.NewReader(data)) },
+		"unsized": func() (int, error) { return g.Restore(io.MultiReader(bytes.NewReader(data))) },
+		"file":    func() (int, error) { return g.RestoreFile(dir) },
+	} {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		n, err := restore()
+		runtime.ReadMemStats(&after)
+		if err == nil || n != 0 {
+			t.Fatalf("%s: Restore = %d, %v, expect an error", name, n, err)
+		}
+		if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 64<<20 {
+			t.Fatalf("%s: allocated %d bytes for a corrupted length", name, alloc)
+		}
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	g := NewGroup("admin-service", "lfu", 1<<20, RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	}), WithTTL(time.Minute), WithHotKeys(10, time.Minute))
+	g.Set("key", []byte("value"))
+
+	s := &Server{Addr: "localhost:9999", consHash: NewConsistentHash(defaultReplicas, nil), snapshotDir: t.TempDir()}
+	s.consHash.AddTruthNode([]string{"localhost:9999", "localhost:10000"})
+	admin := NewAdmin(s)
+	ctx := context.Background()
+
+	groups, err := admin.ListGroups(ctx, &pb.ListGroupsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, info := range groups.Groups {
+		if info.Name == "admin-service" {
+			found = true
+			if info.Policy != "lfu" || info.MaxBytes != 1<<20 || info.TtlNanos != int64(time.Minute) || info.HotKeys != 10 || info.Items != 1 {
+				t.Fatalf("group info = %v", info)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("ListGroups should contain admin-service")
+	}
+
+	peek, err := admin.Peek(ctx, &pb.PeekRequest{Group: "admin-service", Key: "key"})
+	if err != nil || !peek.Found || string(peek.Value) != "value" || peek.ExpireAtUnixNanos == 0 {
+		t.Fatalf("Peek = %v, %v", peek, err)
+	}
+	keys, err := admin.ListKeys(ctx, &pb.ListKeysRequest{Group: "admin-service"})
+	if err != nil || !reflect.DeepEqual(keys.Keys, []string{"key"}) || keys.NextPageToken != "" {
+		t.Fatalf("ListKeys = %v, %v", keys, err)
+	}
+
+	snap, err := admin.Snapshot(ctx, &pb.SnapshotRequest{Group: "admin-service"})
+	if err != nil || len(snap.Snapshots) != 1 || snap.Snapshots[0].Entries != 1 {
+		t.Fatalf("Snapshot = %v, %v", snap, err)
+	}
+
+	evict, err := admin.Evict(ctx, &pb.EvictRequest{Group: "admin-service", Key: "key"})
+	if err != nil || !evict.Removed {
+		t.Fatalf("Evict = %v, %v", evict, err)
+	}
+	if peek, _ := admin.Peek(ctx, &pb.PeekRequest{Group: "admin-service", Key: "key"}); peek.Found {
+		t.Fatal("evicted key should not be found")
+	}
+	if n, err := g.RestoreFile(s.snapshotDir); err != nil || n != 1 {
+		t.Fatalf("RestoreFile = %d, %v", n, err)
+	}
+	purge, err := admin.Purge(ctx, &pb.PurgeRequest{Group: "admin-service"})
+	if err != nil || purge.Removed != 1 {
+		t.Fatalf("Purge = %v, %v", purge, err)
+	}
+
+	ring, err := admin.Ring(ctx, &pb.RingRequest{})
+	if err != nil || ring.Self != "localhost:9999" || len(ring.Nodes) != 2 {
+		t.Fatalf("Ring = %v, %v", ring, err)
+	}
+	total := 0.0
+	for _, n := range ring.Nodes {
+		total += n.Share
+		if n.VirtualNodes != defaultReplicas || n.Self != (n.Addr == "localhost:9999") {
+			t.Fatalf("ring node = %v", n)
+		}
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Fatalf("ring shares sum to %f", total)
+	}
+
+	if _, err := admin.Peek(ctx, &pb.PeekRequest{Group: "no-such-group"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("code = %v, expect NotFound", status.Code(err))
+	}
+	if _, err := admin.Purge(ctx, &pb.PurgeRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("code = %v, expect InvalidArgument", status.Code(err))
+	}
+}
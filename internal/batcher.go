@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+	"time"
+)
+
+/*
+batcher 把 window 内到达的多次回源合并为一次 RetrieveMany（DataLoader 模式），每个 Group 一个
+  - 第一个 key 到达时开启批次，window 之后或者攒够 maxSize 个 key 时提交
+  - 批次内重复的 key 只查询一次，结果分发给所有等待的调用方
+  - 每个 key 的回源已经经过 SingleFlight 和回源租约，这里只负责合并不同的 key
+  - 批次不随调用方取消而中断：调用方的 context 在 SingleFlight 中已经去掉了取消，取消的调用方由 DoContext 提前返回，
+    批次继续执行并把结果写入缓存；RetrieveMany 只受 timeout 限制
+  - RetrieveMany 继承第一个调用方的 trace 上下文，批次的 span 链接到所有调用方的 span
+*/
+type batcher struct {
+	retriever BatchRetriever
+	window    time.Duration
+	maxSize   int
+	timeout   time.Duration
+
+	mu      sync.Mutex
+	current *batch
+}
+
+// batch 尚未提交的批次
+type batch struct {
+	keys    []string
+	waiters map[string][]chan batchResult
+	ctxs    []context.Context // 每次 retrieve 调用方的 context，用于链接 span
+	timer   *time.Timer
+}
+
+type batchResult struct {
+	value []byte
+	err   error
+}
+
+// newBatcher 数据源不支持批量查询或未设置合并窗口时返回 nil，此时逐个 key 回源
+func newBatcher(retriever Retriever, window time.Duration, maxSize int, timeout time.Duration) *batcher {
+	br, ok := retriever.(BatchRetriever)
+	if !ok || window <= 0 {
+		return nil
+	}
+	return &batcher{
+		retriever: br,
+		window:    window,
+		maxSize:   maxSize,
+		timeout:   timeout,
+	}
+}
+
+// retrieve 把 key 加入当前批次并等待批次的结果
+func (b *batcher) retrieve(ctx context.Context, key string) ([]byte, error) {
+	ch := make(chan batchResult, 1)
+
+	b.mu.Lock()
+	bt := b.current
+	if bt == nil {
+		bt = &batch{waiters: make(map[string][]chan batchResult)}
+		b.current = bt
+		bt.timer = time.AfterFunc(b.window, func() {
+			if b.take(bt) {
+				b.run(bt)
+			}
+		})
+	}
+	if _, ok := bt.waiters[key]; !ok {
+		bt.keys = append(bt.keys, key)
+	}
+	bt.waiters[key] = append(bt.waiters[key], ch)
+	bt.ctxs = append(bt.ctxs, ctx)
+	full := b.maxSize > 0 && len(bt.keys) >= b.maxSize
+	if full {
+		b.current = nil
+		bt.timer.Stop()
+	}
+	b.mu.Unlock()
+
+	// 攒满的批次由最后加入的调用方直接提交
+	if full {
+		b.run(bt)
+	}
+	res := <-ch
+	return res.value, res.err
+}
+
+// take 从 batcher 上摘下到期的批次，已经因攒满而提交时返回 false
+func (b *batcher) take(bt *batch) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.current != bt {
+		return false
+	}
+	b.current = nil
+	return true
+}
+
+// run 提交批次并分发结果，RetrieveMany 中的 panic 作为错误返回给本批次的所有调用方
+func (b *batcher) run(bt *batch) {
+	ctx := context.WithoutCancel(bt.ctxs[0])
+	if b.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.timeout)
+		defer cancel()
+	}
+	links := make([]trace.Link, 0, len(bt.ctxs))
+	for _, c := range bt.ctxs {
+		if sc := trace.SpanContextFromContext(c); sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+	ctx, span := tracer.Start(ctx, "Retriever.retrieveMany", trace.WithLinks(links...),
+		trace.WithAttributes(attribute.Int("gocache.batch_keys", len(bt.keys)), attribute.Int("gocache.batch_callers", len(bt.ctxs))))
+
+	var values map[string][]byte
+	var err error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("batch retrieve panic: %v", r)
+			}
+		}()
+		values, err = b.retriever.RetrieveMany(ctx, bt.keys)
+	}()
+	endSpan(span, err)
+
+	for key, chans := range bt.waiters {
+		res := batchResult{err: err}
+		if err == nil {
+			if value, ok := values[key]; ok {
+				res.value = value
+			} else {
+				res.err = ErrNotFound
+			}
+		}
+		for _, ch := range chans {
+			ch <- res
+		}
+	}
+}
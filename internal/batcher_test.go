@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	pb "gocache/api/groupcachepb"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recordingRetriever 记录每次批量查询的 key，名字以 missing 开头的 key 不存在
+type recordingRetriever struct {
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (r *recordingRetriever) retrieve(key string) ([]byte, error) {
+	return nil, errors.New("single retrieve should not be used")
+}
+
+func (r *recordingRetriever) RetrieveMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	r.mu.Lock()
+	r.batches = append(r.batches, append([]string(nil), keys...))
+	r.mu.Unlock()
+	values := make(map[string][]byte)
+	for _, key := range keys {
+		if len(key) < 7 || key[:7] != "missing" {
+			values[key] = []byte("v-" + key)
+		}
+	}
+	return values, nil
+}
+
+func getConcurrently(t *testing.T, g *Group, keys []string) map[string]error {
+	var mu sync.Mutex
+	errs := make(map[string]error)
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			v, err := g.Get(key)
+			if err == nil && v.String() != "v-"+key {
+				t.Errorf("get %s = %s", key, v)
+			}
+			mu.Lock()
+			errs[key] = err
+			mu.Unlock()
+		}(key)
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestGroupBatching(t *testing.T) {
+	r := &recordingRetriever{}
+	g := NewGroup("batching", "lru", 0, r, WithBatching(time.Millisecond*20, 0), WithNegativeTTL(time.Minute))
+
+	keys := []string{"a", "b", "c", "missing"}
+	errs := getConcurrently(t, g, keys)
+	for _, key := range keys[:3] {
+		if errs[key] != nil {
+			t.Fatalf("get %s failed: %v", key, errs[key])
+		}
+	}
+	if !errors.Is(errs["missing"], ErrNotFound) {
+		t.Fatalf("key absent from the batch result should be ErrNotFound, got %v", errs["missing"])
+	}
+	if len(r.batches) != 1 {
+		t.Fatalf("retriever called %d times, expect one batch: %v", len(r.batches), r.batches)
+	}
+	got := append([]string(nil), r.batches[0]...)
+	sort.Strings(got)
+	if fmt.Sprint(got) != fmt.Sprint(keys) {
+		t.Fatalf("batch = %v, expect %v", got, keys)
+	}
+	// 结果写入缓存，包括负缓存
+	if _, err := g.Get("missing"); !errors.Is(err, ErrNotFound) || len(r.batches) != 1 {
+		t.Fatalf("missing key should hit the negative cache, err = %v", err)
+	}
+}
+
+func TestGroupBatchingMaxSize(t *testing.T) {
+	r := &recordingRetriever{}
+	g := NewGroup("batching-max-size", "lru", 0, r, WithBatching(time.Hour, 2))
+
+	// 窗口很长，攒满 2 个 key 立即提交
+	getConcurrently(t, g, []string{"a", "b", "c", "d"})
+	if len(r.batches) != 2 {
+		t.Fatalf("retriever called %d times, expect 2 full batches: %v", len(r.batches), r.batches)
+	}
+	for _, b := range r.batches {
+		if len(b) != 2 {
+			t.Fatalf("batch %v should hold 2 keys", b)
+		}
+	}
+}
+
+func TestBatcherError(t *testing.T) {
+	b := newBatcher(RetrieveManyFunc(func(ctx context.Context, keys []string) (map[string][]byte, error) {
+		if len(keys) > 1 {
+			panic("boom")
+		}
+		return nil, errors.New("db down")
+	}), time.Millisecond*10, 0, 0)
+
+	if _, err := b.retrieve(context.Background(), "a"); err == nil || err.Error() != "db down" {
+		t.Fatalf("batch error should reach the caller, got %v", err)
+	}
+	var wg sync.WaitGroup
+	for _, key := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			if _, err := b.retrieve(context.Background(), key); err == nil {
+				t.Errorf("panic in RetrieveMany should fail %s", key)
+			}
+		}(key)
+	}
+	wg.Wait()
+
+	if newBatcher(RetrieveFunc(func(string) ([]byte, error) { return nil, nil }), time.Millisecond, 0, 0) != nil {
+		t.Fatal("retriever without RetrieveMany should not be batched")
+	}
+}
+
+func TestBatcherSpanLinks(t *testing.T) {
+	ctxs := make(chan context.Context, 1)
+	b := newBatcher(RetrieveManyFunc(func(ctx context.Context, keys []string) (map[string][]byte, error) {
+		ctxs <- ctx
+		return map[string][]byte{}, nil
+	}), time.Millisecond*20, 0, time.Minute)
+
+	// 批次的 span 链接到每个调用方的 span，RetrieveMany 只受批次超时限制
+	first, firstSpan := otel.Tracer("test").Start(context.Background(), "first")
+	second, secondSpan := otel.Tracer("test").Start(context.Background(), "second")
+	start := time.Now()
+	var wg sync.WaitGroup
+	for key, ctx := range map[string]context.Context{"a": first, "b": second} {
+		wg.Add(1)
+		go func(ctx context.Context, key string) {
+			defer wg.Done()
+			b.retrieve(ctx, key)
+		}(ctx, key)
+	}
+	wg.Wait()
+	firstSpan.End()
+	secondSpan.End()
+	ctx := <-ctxs
+	if d, ok := ctx.Deadline(); !ok || d.Before(start.Add(time.Minute)) || d.After(time.Now().Add(time.Minute)) {
+		t.Fatalf("batch deadline = %v, %v, expect the batch timeout", d, ok)
+	}
+	var batch sdktrace.ReadOnlySpan
+	for _, s := range recorder.Ended() {
+		if s.SpanContext().SpanID() == trace.SpanContextFromContext(ctx).SpanID() {
+			batch = s
+		}
+	}
+	if batch == nil || batch.Name() != "Retriever.retrieveMany" {
+		t.Fatalf("RetrieveMany should run in the batch span, got %v", batch)
+	}
+	linked := map[trace.SpanID]bool{}
+	for _, l := range batch.Links() {
+		linked[l.SpanContext.SpanID()] = true
+	}
+	if len(linked) != 2 || !linked[firstSpan.SpanContext().SpanID()] || !linked[secondSpan.SpanContext().SpanID()] {
+		t.Fatalf("batch links = %v, expect both callers", batch.Links())
+	}
+}
+
+func TestGroupBatchingCanceledCaller(t *testing.T) {
+	started, release := make(chan context.Context, 1), make(chan struct{})
+	var batches atomic.Int64
+	g := NewGroup("batching-canceled", "lru", 0, RetrieveManyFunc(func(ctx context.Context, keys []string) (map[string][]byte, error) {
+		batches.Add(1)
+		started <- ctx
+		<-release
+		return map[string][]byte{"key": []byte("value")}, nil
+	}), WithBatching(time.Millisecond, 0), WithFlightCache(0, 0))
+	s := &Server{Addr: "localhost:9999"}
+
+	// 调用方取消后 Server.Get 立即返回，批次不受影响
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Get(ctx, &pb.GetRequest{Group: "batching-canceled", Key: "key"})
+		done <- err
+	}()
+	batchCtx := <-started
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, expect context.Canceled", err)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("canceled caller should not wait for the batch")
+	}
+	if batchCtx.Err() != nil {
+		t.Fatalf("batch context = %v, the batch should keep running", batchCtx.Err())
+	}
+
+	// 批次完成后结果写入缓存
+	close(release)
+	deadline := time.Now().Add(time.Second * 3)
+	for {
+		if _, ok := g.Peek("key"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the batch of a canceled caller should still populate the cache")
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	if v, err := g.Get("key"); err != nil || v.String() != "value" || batches.Load() != 1 {
+		t.Fatalf("Get = %q, %v after %d batches, expect one batch", v.String(), err, batches.Load())
+	}
+}
+
+func TestGroupBatchTimeout(t *testing.T) {
+	g := NewGroup("batching-timeout", "lru", 0, RetrieveManyFunc(func(ctx context.Context, keys []string) (map[string][]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}), WithBatching(time.Millisecond, 0), WithBatchTimeout(time.Millisecond*20))
+	if _, err := g.Get("key"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, expect the batch timeout", err)
+	}
+}
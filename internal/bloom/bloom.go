@@ -0,0 +1,84 @@
+package bloom
+
+import (
+	"hash/fnv"
+	"math"
+	"sync/atomic"
+)
+
+/*
+Filter 并发安全的布隆过滤器，记录一定存在的 key
+  - Test 返回 false 时 key 一定不存在，返回 true 时 key 可能存在（误判率约为 fpRate）
+  - 位数组按 uint64 分块，Add 和 Test 都是原子操作，不需要加锁
+  - k 个哈希值由两个 FNV 哈希组合得到（Kirsch-Mitzenmacher），每个 key 只计算两次哈希
+*/
+type Filter struct {
+	bits []atomic.Uint64
+	m    uint64 // 位数
+	k    uint64 // 哈希函数个数
+}
+
+/*
+New 按预计元素数量和期望误判率创建过滤器
+  - m = -n·ln(p) / (ln2)²，k = m/n·ln2
+  - 实际元素数量超过 n 时误判率会升高，但不会漏判
+*/
+func New(n int, fpRate float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	m = (m + 63) / 64 * 64
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &Filter{
+		bits: make([]atomic.Uint64, m/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+func hashes(key string) (uint64, uint64) {
+	h1 := fnv.New64a()
+	h1.Write([]byte(key))
+	h2 := fnv.New64()
+	h2.Write([]byte(key))
+	// h2 为奇数时与 m 互素的概率更高，k 个位置更分散
+	return h1.Sum64(), h2.Sum64() | 1
+}
+
+// Add 记录 key
+func (f *Filter) Add(key string) {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < f.k; i++ {
+		pos := (h1 + i*h2) % f.m
+		f.bits[pos/64].Or(1 << (pos % 64))
+	}
+}
+
+// Test 判断 key 是否可能存在
+func (f *Filter) Test(key string) bool {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < f.k; i++ {
+		pos := (h1 + i*h2) % f.m
+		if f.bits[pos/64].Load()&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Bits 返回位数组的大小（位）
+func (f *Filter) Bits() uint64 {
+	return f.m
+}
+
+// Hashes 返回哈希函数个数
+func (f *Filter) Hashes() uint64 {
+	return f.k
+}
@@ -0,0 +1,29 @@
+package bloom
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	const n = 10000
+	f := New(n, 0.01)
+	for i := 0; i < n; i++ {
+		f.Add(fmt.Sprintf("student%d", i))
+	}
+	for i := 0; i < n; i++ {
+		if !f.Test(fmt.Sprintf("student%d", i)) {
+			t.Fatalf("student%d added but reported missing", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if f.Test(fmt.Sprintf("missing%d", i)) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / n; rate > 0.02 {
+		t.Fatalf("false positive rate %.4f exceeds twice the expected 0.01", rate)
+	}
+}
@@ -1,49 +1,337 @@
 package service
 
 import (
+	"fmt"
 	"gocache/internal/policy"
 	"gocache/internal/policy/interfaces"
+	"gocache/internal/timingwheel"
 	"gocache/utils/logger"
+	"math"
+	"math/rand"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // lru上层并发上一层锁
 type cache struct {
 	mu         sync.Mutex
 	strategy   interfaces.CacheStrategy
+	policy     string
 	cacheBytes int64
+	sizer      func(strategy string) interfaces.Sizer
+	maxEntries int
+	ttl        time.Duration
+	softTTL    time.Duration
+	grace      time.Duration
+	jitter     float64
+	wheel      *timingwheel.TimingWheel
+
+	removing    bool         // Delete 期间为 true，主动删除不计入淘汰统计
+	evictions   atomic.Int64 // 容量不足淘汰的条目数
+	expirations atomic.Int64 // 到期删除的条目数
+
+	// notify 淘汰、过期事件的回调，持有 c.mu 时调用，可以为 nil
+	notify func(typ EventType, key string, value ByteView)
+}
+
+/*
+item 缓存中实际存储的值
+  - freshUntil：软过期时间，超过后条目仍然可以返回，但需要在后台刷新；零值表示一直新鲜
+  - expireAt：硬过期时间，到期后读取时只能阻塞回源；零值表示永不过期
+  - 策略登记的过期时间为 expireAt 加上宽限期，宽限期内的条目只在回源失败时返回
+  - negative：负缓存条目，表示数据源中不存在该 key，使用单独的 TTL，没有宽限期
+  - delta：回源加载该值的耗时，用于概率提前过期（XFetch），0 表示未知
+*/
+type item struct {
+	view       ByteView
+	freshUntil time.Time
+	expireAt   time.Time
+	negative   bool
+	delta      time.Duration
 }
 
-func newCache(strategy string, cacheSize int64) *cache {
-	onEvicted := func(key string, value interfaces.Value) {
-		logger.LogrusObj.Infof("缓存条目 [%s:%s] 被淘汰", key, value)
+func (it item) Len() int {
+	return it.view.Len()
+}
+
+func (it item) String() string {
+	return it.view.String()
+}
+
+// stale 判断条目是否已经超过软过期时间
+func (it item) stale() bool {
+	return !it.freshUntil.IsZero() && time.Now().After(it.freshUntil)
+}
+
+// expired 判断条目是否已经超过硬过期时间，只在宽限期内可能为 true
+func (it item) expired() bool {
+	return !it.expireAt.IsZero() && time.Now().After(it.expireAt)
+}
+
+/*
+earlyExpired 概率提前过期（XFetch）：now - delta·beta·ln(rand) >= expireAt 时提前重新加载
+  - 越接近过期时间、回源越慢，提前重新加载的概率越高，同一时刻只有少数请求触发重新加载
+  - beta 越大越倾向于提前，1 为论文中的推荐值；beta <= 0 或 delta 未知时关闭
+*/
+func (it item) earlyExpired(beta float64) bool {
+	if beta <= 0 || it.delta <= 0 || it.expireAt.IsZero() {
+		return false
 	}
+	// 1 - Float64() 落在 (0, 1]，避免 ln(0)
+	gap := float64(it.delta) * beta * -math.Log(1-rand.Float64())
+	return time.Now().Add(time.Duration(gap)).After(it.expireAt)
+}
 
-	return &cache{
+func newCache(strategy string, cacheSize int64, opts groupOptions) *cache {
+	c := &cache{
 		cacheBytes: cacheSize,
-		strategy:   policy.New(strategy, cacheSize, onEvicted),
+		policy:     strategy,
+		sizer:      opts.sizer,
+		maxEntries: opts.maxEntries,
+		ttl:        opts.ttl,
+		softTTL:    opts.softTTL,
+		grace:      opts.grace,
+		jitter:     opts.ttlJitter,
+		wheel:      timingwheel.Default(),
+	}
+	c.strategy = c.newStrategy(strategy, cacheSize)
+	return c
+}
+
+/*
+newStrategy 按缓存的 Sizer 和条目数上限创建策略实例，未注册的策略名返回 nil
+  - 每个条目的过期时间由 put 单独指定，过期任务登记在共享的时间轮上，触发时持有 c.mu，与读写请求互斥
+*/
+func (c *cache) newStrategy(strategy string, cacheSize int64) interfaces.CacheStrategy {
+	opts := []interfaces.Option{
+		interfaces.WithMaxEntries(c.maxEntries),
+		interfaces.WithTimingWheel(c.wheel, &c.mu),
+	}
+	if c.sizer != nil {
+		opts = append(opts, interfaces.WithSizer(c.sizer(strategy)))
+	}
+	return policy.New(strategy, cacheSize, c.onEvicted, opts...)
+}
+
+// onEvicted 条目被策略移除时回调，调用方持有 c.mu；已经到达策略过期时间的计为到期删除，其余计为淘汰
+func (c *cache) onEvicted(key string, value interfaces.Value) {
+	if c.removing {
+		return
+	}
+	it := value.(item)
+	typ := EventEvicted
+	if deadline := c.deadline(it); !deadline.IsZero() && !time.Now().Before(deadline) {
+		c.expirations.Add(1)
+		typ = EventExpired
+	} else {
+		c.evictions.Add(1)
+		logger.SampledDebugf("缓存条目 [%s:%s] 被淘汰", key, value)
+	}
+	if c.notify != nil && !it.negative {
+		c.notify(typ, key, it.view)
+	}
+}
+
+// deadline 返回策略登记的过期时间：硬过期时间加上宽限期，负缓存条目没有宽限期；零值表示永不过期
+func (c *cache) deadline(it item) time.Time {
+	if it.expireAt.IsZero() || it.negative {
+		return it.expireAt
 	}
+	return it.expireAt.Add(c.grace)
 }
+
+/*
+newItem 包装写入的值，记录硬过期时间，软 TTL 小于硬 TTL 时记录软过期时间
+  - 开启抖动时，软、硬 TTL 按同一个随机比例缩短到 [1-jitter, 1] 倍，
+    同一批预热写入的条目不会在同一时刻过期，且不会超过配置的 TTL
+*/
+func (c *cache) newItem(value ByteView, delta time.Duration) item {
+	it := item{view: value, delta: delta}
+	now := time.Now()
+	scale := 1.0
+	if c.jitter > 0 {
+		scale -= c.jitter * rand.Float64()
+	}
+	if c.ttl > 0 {
+		it.expireAt = now.Add(time.Duration(float64(c.ttl) * scale))
+	}
+	if c.softTTL > 0 && (c.ttl <= 0 || c.softTTL < c.ttl) {
+		it.freshUntil = now.Add(time.Duration(float64(c.softTTL) * scale))
+	}
+	return it
+}
+
+/*
+put 写入条目，调用方需持有 c.mu
+  - 策略登记的过期时间为硬过期时间加上宽限期，宽限期内的条目只在回源失败时返回
+*/
+func (c *cache) put(key string, it item) {
+	entry := interfaces.Entry{Key: key, Value: it}
+	if deadline := c.deadline(it); !deadline.IsZero() {
+		entry.ExpireAt = &deadline
+	}
+	c.strategy.AddEntry(entry)
+}
+
 func (c *cache) set(key string, value ByteView) {
 	c.mu.Lock()
-	c.strategy.Add(key, value)
+	c.put(key, c.newItem(value, 0))
 	c.mu.Unlock()
 }
 func (c *cache) add(key string, value ByteView) {
+	c.addLoaded(key, value, 0)
+}
+
+// addLoaded 写入回源加载的值，delta 为加载耗时
+func (c *cache) addLoaded(key string, value ByteView, delta time.Duration) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	logger.LogrusObj.Infof("存入数据库之后压入缓存, (key, value)=(%s, %s)", key, value)
-	c.strategy.Add(key, value)
+	logger.SampledDebugf("存入数据库之后压入缓存, (key, value)=(%s, %s)", key, value)
+	c.put(key, c.newItem(value, delta))
 }
 
+// remove 删除条目，条目不存在时返回 false
+func (c *cache) remove(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removing = true
+	defer func() { c.removing = false }()
+	return c.strategy.Delete(key)
+}
+
+/*
+addNegative 写入负缓存条目，ttl 之后过期
+  - 负缓存条目只用于拦截对不存在的 key 的重复回源，过期时间单独登记，不受 group TTL 和宽限期影响
+*/
+func (c *cache) addNegative(key string, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.put(key, item{negative: true, expireAt: time.Now().Add(ttl)})
+}
+
+// get 返回未过期的值，宽限期内的条目视为不存在
 func (c *cache) get(key string) (value ByteView, ok bool) {
+	it, ok := c.lookup(key)
+	if !ok || it.expired() {
+		return ByteView{}, false
+	}
+	return it.view, true
+}
+
+// peek 返回缓存的条目，不改变条目在淘汰策略中的价值
+func (c *cache) peek(key string) (it item, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.strategy.Peek(key); ok {
+		return e.Value.(item), true
+	}
+	return item{}, false
+}
+
+// entries 返回所有条目的拷贝，按价值从高到低排列
+func (c *cache) entries() []interfaces.Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.strategy.Entries()
+}
+
+// purge 清空缓存，返回清空的条目数，不计入淘汰统计
+func (c *cache) purge() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := c.strategy.Len()
+	c.strategy.Purge()
+	return n
+}
+
+// restore 写入快照中的条目，保留原有的软、硬过期时间
+func (c *cache) restore(key string, it item) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.put(key, it)
+}
+
+// lookup 返回缓存的条目（可能处于宽限期内），由调用方根据软、硬过期时间决定如何使用
+func (c *cache) lookup(key string) (it item, ok bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if v, _, ok := c.strategy.Get(key); ok {
-		return v.(ByteView), true
-	} else {
-		return ByteView{}, false
+		return v.(item), true
+	}
+	return item{}, false
+}
+
+/*
+migrate 使用新的策略名和容量创建策略实例，并把现有条目迁移过去，调用方需持有 c.mu
+  - 迁移期间持有锁，读写请求会短暂阻塞，但缓存内容不会丢失
+  - 新容量不足时，价值最低的条目被淘汰
+  - 条目保留原有的过期时间，旧实例上登记的过期任务随之取消
+*/
+func (c *cache) migrate(strategy string, cacheSize int64) error {
+	if cacheSize < 0 {
+		return fmt.Errorf("cache bytes must not be negative, got %d", cacheSize)
+	}
+	dst := c.newStrategy(strategy, cacheSize)
+	if dst == nil {
+		return fmt.Errorf("unknown cache policy %q, expect one of %v", strategy, policy.Names())
 	}
+
+	policy.Migrate(dst, c.strategy)
+	c.strategy.Purge()
+	c.strategy = dst
+	c.policy = strategy
+	c.cacheBytes = cacheSize
+	return nil
+}
+
+// resize 调整缓存容量，策略保持不变
+func (c *cache) resize(cacheSize int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.migrate(c.policy, cacheSize)
+}
+
+/*
+setCacheBytes 在当前策略实例上原地调整容量，不重建实例
+  - 供内存管理器周期性地小幅调整各 group 的容量使用，避免每次都迁移全部条目
+  - 缩容时由策略自身淘汰价值最低的条目
+*/
+func (c *cache) setCacheBytes(cacheSize int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.strategy.SetMaxBytes(cacheSize)
+	c.cacheBytes = cacheSize
+}
+
+// setPolicy 切换淘汰策略，容量保持不变
+func (c *cache) setPolicy(strategy string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.migrate(strategy, c.cacheBytes)
+}
+
+// bytes 返回当前已经使用的字节数
+func (c *cache) bytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.strategy.UsedBytes()
+}
+
+// usage 返回当前的条目数和已经使用的字节数
+func (c *cache) usage() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.strategy.Len(), c.strategy.UsedBytes()
+}
+
+// settings 返回当前的策略名和容量
+func (c *cache) settings() (string, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.policy, c.cacheBytes
 }
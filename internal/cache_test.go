@@ -0,0 +1,85 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCacheMigrate(t *testing.T) {
+	c := newCache("lru", 0, groupOptions{})
+	for i := 0; i < 5; i++ {
+		c.add(fmt.Sprintf("key%d", i), ByteView{b: []byte("value")})
+	}
+	c.get("key0")
+
+	if err := c.setPolicy("lfu"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.setPolicy("arc"); err == nil {
+		t.Fatal("expect error for unknown policy")
+	}
+	if err := c.resize(int64(2 * len("key0value"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.resize(-1); err == nil {
+		t.Fatal("expect error for negative cache bytes")
+	}
+
+	if strategy, maxBytes := c.settings(); strategy != "lfu" || maxBytes != int64(2*len("key0value")) {
+		t.Fatalf("settings = (%s, %d)", strategy, maxBytes)
+	}
+	// key0 最近被访问、key4 最后写入，缩容后应保留这两个条目
+	for _, key := range []string{"key0", "key4"} {
+		if v, ok := c.get(key); !ok || v.String() != "value" {
+			t.Fatalf("%s should survive migration", key)
+		}
+	}
+	if _, ok := c.get("key1"); ok {
+		t.Fatal("key1 should be evicted after resize")
+	}
+}
+
+func TestCacheTTLJitter(t *testing.T) {
+	ttl := time.Minute
+	c := newCache("lru", 0, groupOptions{ttl: ttl, softTTL: ttl / 2, ttlJitter: 0.2})
+
+	now := time.Now()
+	spread := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		it := c.newItem(ByteView{}, 0)
+		life, fresh := it.expireAt.Sub(now), it.freshUntil.Sub(now)
+		if life < time.Duration(float64(ttl)*0.8)-time.Second || life > ttl+time.Second {
+			t.Fatalf("ttl %v out of [0.8, 1] x %v", life, ttl)
+		}
+		if fresh >= life {
+			t.Fatalf("soft ttl %v should stay below hard ttl %v", fresh, life)
+		}
+		spread[life.Truncate(time.Second)] = true
+	}
+	if len(spread) < 5 {
+		t.Fatalf("expirations should be spread out, got %d distinct seconds", len(spread))
+	}
+}
+
+func TestItemEarlyExpired(t *testing.T) {
+	soon := item{expireAt: time.Now().Add(time.Millisecond), delta: time.Second}
+	later := item{expireAt: time.Now().Add(time.Hour), delta: time.Millisecond}
+
+	early := 0
+	for i := 0; i < 100; i++ {
+		if soon.earlyExpired(1) {
+			early++
+		}
+		if later.earlyExpired(1) {
+			t.Fatal("entry an hour away from expiry should not reload early")
+		}
+	}
+	// 距离过期 1ms、回源耗时 1s：P(-ln(rand) < 0.001) 约为 0.1%
+	if early < 95 {
+		t.Fatalf("entry about to expire with slow reload should almost always reload early, got %d/100", early)
+	}
+	if soon.earlyExpired(0) || (item{expireAt: soon.expireAt}).earlyExpired(1) {
+		t.Fatal("early expiration should be disabled without beta or measured delta")
+	}
+}
@@ -0,0 +1,425 @@
+/*
+Package clustertest 在一个进程中运行多个缓存节点，用 go test 覆盖选点、故障转移、哈希环重建和负责节点切换
+  - 节点之间通过 bufconn 通信，不占用端口；服务发现在内存中完成，不需要 etcd
+  - 每个节点有自己的 GroupRegistry，数据源使用 Source 等假实现，不需要 MySQL
+  - Kill、Restart、AddNode 模拟节点下线、重启和加入，Partition、Isolate、Heal 模拟网络分区
+*/
+package clustertest
+
+import (
+	"context"
+	"fmt"
+	service "gocache/internal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	bufSize     = 1 << 20
+	waitTimeout = 5 * time.Second
+)
+
+// GroupSpec 每个节点上创建的 group，Retriever 为节点 addr 创建数据源，例如 Source.Retriever
+type GroupSpec struct {
+	Name      string
+	Strategy  string // 为空时使用 lru
+	MaxBytes  int64
+	Retriever func(addr string) service.Retriever
+	Options   []service.GroupOption
+}
+
+// Node 集群中的一个节点，重启之后是一个新的 Node，缓存为空
+type Node struct {
+	Addr   string
+	Server *service.Server
+	Groups *service.GroupRegistry
+
+	lis     *bufconn.Listener
+	update  chan struct{}
+	done    chan struct{} // Serve 返回时关闭
+	running bool
+}
+
+// Group 返回节点上名为 name 的 group
+func (n *Node) Group(name string) *service.Group {
+	return n.Groups.Get(name)
+}
+
+// Get 通过节点上的 group 读取 key，与业务代码调用 Group.Get 相同
+func (n *Node) Get(group, key string) (string, error) {
+	g := n.Group(group)
+	if g == nil {
+		return "", fmt.Errorf("group %s not found on %s", group, n.Addr)
+	}
+	v, err := g.Get(key)
+	if err != nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+// link 从 from 到 to 的单向连接
+type link struct {
+	from, to string
+}
+
+// Cluster 在一个进程中运行的多个节点
+type Cluster struct {
+	t         testing.TB
+	groups    []GroupSpec
+	discovery *memDiscovery
+
+	mu     sync.Mutex
+	nodes  map[string]*Node // 包括已经停止的节点
+	cuts   map[link]bool
+	conns  map[link][]net.Conn
+	nextID int
+}
+
+// New 启动 n 个节点并等待哈希环收敛，测试结束时停止所有节点
+func New(t testing.TB, n int, groups ...GroupSpec) *Cluster {
+	t.Helper()
+	c := &Cluster{
+		t:         t,
+		groups:    groups,
+		discovery: newMemDiscovery(),
+		nodes:     make(map[string]*Node),
+		cuts:      make(map[link]bool),
+		conns:     make(map[link][]net.Conn),
+	}
+	t.Cleanup(c.Close)
+	for i := 0; i < n; i++ {
+		c.start(c.newAddr())
+	}
+	c.WaitConverged()
+	return c
+}
+
+// newAddr 为新节点分配地址，每个节点一个 IP，端口相同
+func (c *Cluster) newAddr() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	return fmt.Sprintf("10.0.0.%d:9999", c.nextID)
+}
+
+// start 在 addr 上启动一个新节点，返回时节点已经注册到服务发现
+func (c *Cluster) start(addr string) *Node {
+	c.t.Helper()
+	update := make(chan struct{}, 1)
+	groups := service.NewGroupRegistry()
+	srv, err := service.NewServer(update, addr,
+		service.WithGroupRegistry(groups),
+		service.WithDiscovery(c.discovery),
+		service.WithDialOptions(c.dialOptions(addr)...),
+	)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	for _, spec := range c.groups {
+		strategy := spec.Strategy
+		if strategy == "" {
+			strategy = "lru"
+		}
+		g := groups.NewGroup(spec.Name, strategy, spec.MaxBytes, spec.Retriever(addr), spec.Options...)
+		g.RegisterServer(srv)
+	}
+
+	n := &Node{Addr: addr, Server: srv, Groups: groups, lis: bufconn.Listen(bufSize), update: update, done: make(chan struct{}), running: true}
+	c.mu.Lock()
+	c.nodes[addr] = n
+	c.mu.Unlock()
+
+	c.discovery.watch(addr, update)
+	peers, _ := c.discovery.Peers(service.CacheServiceName)
+	srv.SetPeers(append(peers, addr))
+	go func() {
+		srv.Serve(n.lis)
+		close(n.done)
+	}()
+	c.waitFor(func() bool { return c.discovery.registered(addr) }, "%s to register", addr)
+	return n
+}
+
+// dialOptions 节点 from 连接其他节点使用的选项：经过 bufconn，受网络分区影响，快速重连
+func (c *Cluster) dialOptions(from string) []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, to string) (net.Conn, error) {
+			return c.dial(ctx, from, to)
+		}),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoff.Config{BaseDelay: 10 * time.Millisecond, Multiplier: 1.6, Jitter: 0.2, MaxDelay: 100 * time.Millisecond},
+			MinConnectTimeout: time.Second,
+		}),
+	}
+}
+
+// dial 建立从 from 到 to 的连接，from 为空表示测试代码本身，不受网络分区影响
+func (c *Cluster) dial(ctx context.Context, from, to string) (net.Conn, error) {
+	c.mu.Lock()
+	n := c.nodes[to]
+	if n == nil || !n.running || c.cuts[link{from, to}] {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("dial %s from %s: connection refused", to, from)
+	}
+	lis := n.lis
+	c.mu.Unlock()
+
+	conn, err := lis.DialContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// 建立连接期间发生了分区
+	if c.cuts[link{from, to}] {
+		conn.Close()
+		return nil, fmt.Errorf("dial %s from %s: connection refused", to, from)
+	}
+	c.conns[link{from, to}] = append(c.conns[link{from, to}], conn)
+	return conn, nil
+}
+
+// Node 返回地址为 addr 的节点，包括已经停止的节点
+func (c *Cluster) Node(addr string) *Node {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := c.nodes[addr]
+	if n == nil {
+		c.t.Fatalf("no node %s", addr)
+	}
+	return n
+}
+
+// Nodes 返回正在运行的节点，按地址排序
+func (c *Cluster) Nodes() []*Node {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var nodes []*Node
+	for _, n := range c.nodes {
+		if n.running {
+			nodes = append(nodes, n)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Addr < nodes[j].Addr })
+	return nodes
+}
+
+// Owner 返回正在运行的节点组成的哈希环上 key 的负责节点
+func (c *Cluster) Owner(key string) *Node {
+	var addrs []string
+	for _, n := range c.Nodes() {
+		addrs = append(addrs, n.Addr)
+	}
+	return c.Node(service.NewPeerRing(addrs).GetTruthNode(key))
+}
+
+// Conn 返回测试代码到节点 addr 的 gRPC 连接，测试结束时关闭
+func (c *Cluster) Conn(addr string) *grpc.ClientConn {
+	c.t.Helper()
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, to string) (net.Conn, error) {
+			return c.dial(ctx, "", to)
+		}),
+	)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// AddNode 启动一个新节点并等待所有节点的哈希环收敛
+func (c *Cluster) AddNode() *Node {
+	c.t.Helper()
+	n := c.start(c.newAddr())
+	c.WaitConverged()
+	return n
+}
+
+/*
+Kill 停止节点 addr 并等待其余节点的哈希环收敛
+  - 节点从服务发现中注销，到它的连接全部断开，缓存随节点丢弃
+*/
+func (c *Cluster) Kill(addr string) {
+	c.t.Helper()
+	n := c.Node(addr)
+	c.stop(n)
+	c.WaitConverged()
+}
+
+func (c *Cluster) stop(n *Node) {
+	c.mu.Lock()
+	if !n.running {
+		c.mu.Unlock()
+		return
+	}
+	n.running = false
+	c.mu.Unlock()
+	c.discovery.unwatch(n.Addr)
+	n.Server.Stop()
+	<-n.done
+}
+
+// Restart 在 addr 上启动一个缓存为空的新节点并等待哈希环收敛，addr 上的节点必须已经停止
+func (c *Cluster) Restart(addr string) *Node {
+	c.t.Helper()
+	if c.Node(addr).running {
+		c.t.Fatalf("node %s is still running", addr)
+	}
+	n := c.start(addr)
+	c.WaitConverged()
+	return n
+}
+
+/*
+Partition 断开 a 和 b 之间双向的网络，已有连接立即关闭，新连接被拒绝
+  - 服务发现不受影响，两个节点仍然在彼此的哈希环上，请求对方时失败并转为本地回源
+*/
+func (c *Cluster) Partition(a, b string) {
+	c.mu.Lock()
+	var conns []net.Conn
+	for _, l := range []link{{a, b}, {b, a}} {
+		c.cuts[l] = true
+		conns = append(conns, c.conns[l]...)
+		delete(c.conns, l)
+	}
+	c.mu.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+// Isolate 断开 addr 与其他所有节点之间的网络
+func (c *Cluster) Isolate(addr string) {
+	for _, n := range c.Nodes() {
+		if n.Addr != addr {
+			c.Partition(addr, n.Addr)
+		}
+	}
+}
+
+// Heal 恢复所有被断开的网络，节点在退避时间（最长 100ms）之后重新连接
+func (c *Cluster) Heal() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cuts = make(map[link]bool)
+}
+
+// WaitConverged 等待每个正在运行的节点的哈希环包含且只包含所有已注册的节点
+func (c *Cluster) WaitConverged() {
+	c.t.Helper()
+	c.waitFor(c.converged, "hash rings to converge")
+}
+
+func (c *Cluster) converged() bool {
+	peers, _ := c.discovery.Peers(service.CacheServiceName)
+	for _, n := range c.Nodes() {
+		ring := n.Server.Ring()
+		if len(ring) != len(peers) {
+			return false
+		}
+		for i, rn := range ring {
+			if rn.Addr != peers[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (c *Cluster) waitFor(cond func() bool, format string, args ...any) {
+	c.t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			c.t.Fatalf("timed out waiting for "+format, args...)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Close 停止所有节点，New 会在测试结束时调用
+func (c *Cluster) Close() {
+	for _, n := range c.Nodes() {
+		c.stop(n)
+	}
+}
+
+/*
+memDiscovery 内存中的服务发现，实现 service.Discovery
+  - 只有一个服务，忽略服务名称
+  - 节点注册或注销时通知所有节点重新构建哈希环，通知合并，不会阻塞
+*/
+// 测试 memDiscovery 是否实现了 Discovery 接口
+var _ service.Discovery = (*memDiscovery)(nil)
+
+type memDiscovery struct {
+	mu       sync.Mutex
+	peers    map[string]bool
+	watchers map[string]chan struct{}
+}
+
+func newMemDiscovery() *memDiscovery {
+	return &memDiscovery{peers: make(map[string]bool), watchers: make(map[string]chan struct{})}
+}
+
+func (d *memDiscovery) Register(service string, addr string, stop chan error) error {
+	d.set(addr, true)
+	err := <-stop
+	d.set(addr, false)
+	return err
+}
+
+func (d *memDiscovery) Peers(service string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	peers := make([]string, 0, len(d.peers))
+	for addr := range d.peers {
+		peers = append(peers, addr)
+	}
+	sort.Strings(peers)
+	return peers, nil
+}
+
+func (d *memDiscovery) registered(addr string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.peers[addr]
+}
+
+func (d *memDiscovery) set(addr string, registered bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if registered {
+		d.peers[addr] = true
+	} else {
+		delete(d.peers, addr)
+	}
+	for _, ch := range d.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (d *memDiscovery) watch(addr string, ch chan struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.watchers[addr] = ch
+}
+
+func (d *memDiscovery) unwatch(addr string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.watchers, addr)
+}
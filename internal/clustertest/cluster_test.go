@@ -0,0 +1,215 @@
+package clustertest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "gocache/api/groupcachepb"
+	service "gocache/internal"
+	"testing"
+	"time"
+)
+
+/*
+newCluster 启动 n 个节点，每个节点上有一个 scores group，数据源中有 k0 到 k99
+  - 关闭 SingleFlight 的结果缓存，请求节点不保留从负责节点取回的值，每次读取都经过负责节点
+*/
+func newCluster(t *testing.T, n int) (*Cluster, *Source) {
+	data := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		data[fmt.Sprintf("k%d", i)] = fmt.Sprintf("v%d", i)
+	}
+	src := NewSource(data)
+	c := New(t, n, GroupSpec{
+		Name:      "scores",
+		Retriever: src.Retriever,
+		Options:   []service.GroupOption{service.WithTTL(time.Minute), service.WithFlightCache(0, 0)},
+	})
+	return c, src
+}
+
+// mustGet 通过节点 n 读取 key 并检查值
+func mustGet(t *testing.T, n *Node, key string) {
+	t.Helper()
+	want := "v" + key[1:]
+	got, err := n.Get("scores", key)
+	if err != nil || got != want {
+		t.Fatalf("get %s on %s = %q, %v, want %q", key, n.Addr, got, err, want)
+	}
+}
+
+// keyOwnedBy 返回第一个负责节点为 addr 的 key
+func keyOwnedBy(t *testing.T, c *Cluster, addr string) string {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if c.Owner(key).Addr == addr {
+			return key
+		}
+	}
+	t.Fatalf("no key owned by %s", addr)
+	return ""
+}
+
+func TestPickLoadsOnOwner(t *testing.T) {
+	c, src := newCluster(t, 3)
+	nodes := c.Nodes()
+	if len(nodes) != 3 || len(nodes[0].Server.Ring()) != 3 {
+		t.Fatalf("nodes = %d, ring = %v", len(nodes), nodes[0].Server.Ring())
+	}
+
+	// 每个 key 从所有节点读取，只由负责节点回源一次
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("k%d", i)
+		for _, n := range nodes {
+			mustGet(t, n, key)
+		}
+		if loaded := src.LoadedBy(key); len(loaded) != 1 || loaded[0] != c.Owner(key).Addr {
+			t.Fatalf("%s loaded by %v, owner is %s", key, loaded, c.Owner(key).Addr)
+		}
+	}
+	for _, n := range nodes {
+		if src.Loads(n.Addr) == 0 {
+			t.Fatalf("node %s owns no key of 30", n.Addr)
+		}
+	}
+
+	// 数据源中不存在的 key 由负责节点确认，其他节点不再回源
+	if _, err := nodes[0].Get("scores", "missing"); !errors.Is(err, service.ErrNotFound) {
+		t.Fatalf("err = %v, expect ErrNotFound", err)
+	}
+	if loaded := src.LoadedBy("missing"); len(loaded) != 1 || loaded[0] != c.Owner("missing").Addr {
+		t.Fatalf("missing loaded by %v, owner is %s", loaded, c.Owner("missing").Addr)
+	}
+}
+
+func TestFailoverOnPartition(t *testing.T) {
+	c, src := newCluster(t, 3)
+	nodes := c.Nodes()
+	a, b := nodes[0], nodes[1]
+
+	// 分区期间负责节点不可达，请求方自己回源，哈希环不变
+	c.Partition(a.Addr, b.Addr)
+	key := keyOwnedBy(t, c, b.Addr)
+	mustGet(t, a, key)
+	if loaded := src.LoadedBy(key); len(loaded) != 1 || loaded[0] != a.Addr {
+		t.Fatalf("%s loaded by %v during partition, expect %s", key, loaded, a.Addr)
+	}
+	if len(a.Server.Ring()) != 3 {
+		t.Fatalf("partition should not change the ring: %v", a.Server.Ring())
+	}
+	if s := a.Group("scores").Stats(); s.PeerErrors == 0 {
+		t.Fatalf("stats = %+v, expect peer errors", s)
+	}
+
+	// 恢复之后在退避时间内重新连接负责节点，请求重新由负责节点回源
+	c.Heal()
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		a.Group("scores").Delete(key)
+		mustGet(t, a, key)
+		if loaded := src.LoadedBy(key); loaded[len(loaded)-1] == b.Addr {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s never loaded by the owner after healing: %v", key, src.LoadedBy(key))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestKillAndRestartRebuildRing(t *testing.T) {
+	c, src := newCluster(t, 3)
+	victim := c.Nodes()[1]
+	key := keyOwnedBy(t, c, victim.Addr)
+	for _, n := range c.Nodes() {
+		mustGet(t, n, key)
+	}
+
+	// 负责节点下线后哈希环只剩两个节点，key 由新的负责节点回源
+	c.Kill(victim.Addr)
+	nodes := c.Nodes()
+	if len(nodes) != 2 {
+		t.Fatalf("running nodes = %d, expect 2", len(nodes))
+	}
+	for _, n := range nodes {
+		if ring := n.Server.Ring(); len(ring) != 2 {
+			t.Fatalf("ring of %s = %v", n.Addr, ring)
+		}
+	}
+	newOwner := c.Owner(key)
+	if newOwner.Addr == victim.Addr {
+		t.Fatalf("killed node %s still owns %s", victim.Addr, key)
+	}
+	newOwner.Group("scores").Delete(key)
+	mustGet(t, nodes[0], key)
+	if loaded := src.LoadedBy(key); loaded[len(loaded)-1] != newOwner.Addr {
+		t.Fatalf("%s loaded by %v after kill, expect %s last", key, loaded, newOwner.Addr)
+	}
+
+	// 已经停止的节点不再接受连接
+	client := pb.NewGroupCacheClient(c.Conn(victim.Addr))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := client.Get(ctx, &pb.GetRequest{Group: "scores", Key: key}); err == nil {
+		t.Fatal("killed node should not serve requests")
+	}
+
+	// 重启后缓存为空，key 重新交还给它并由它回源
+	restarted := c.Restart(victim.Addr)
+	if restarted == victim || restarted.Group("scores").Stats().Items != 0 {
+		t.Fatal("restart should create a node with an empty cache")
+	}
+	if c.Owner(key) != restarted {
+		t.Fatalf("%s should be owned by the restarted node again", key)
+	}
+	before := src.Loads(restarted.Addr)
+	mustGet(t, nodes[0], key)
+	if src.Loads(restarted.Addr) != before+1 {
+		t.Fatalf("%s should be loaded by the restarted node", key)
+	}
+}
+
+func TestJoinHandsOffKeys(t *testing.T) {
+	c, src := newCluster(t, 2)
+	first := c.Nodes()[0]
+	for i := 0; i < 100; i++ {
+		mustGet(t, first, fmt.Sprintf("k%d", i))
+	}
+	owners := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("k%d", i)
+		owners[key] = c.Owner(key).Addr
+	}
+
+	// 新节点只接管一部分 key，这些 key 由它重新回源；其余 key 的负责节点不变，继续命中
+	joined := c.AddNode()
+	moved := 0
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("k%d", i)
+		owner := c.Owner(key)
+		if owner != joined && owner.Addr != owners[key] {
+			t.Fatalf("%s moved from %s to %s, not to the new node", key, owners[key], owner.Addr)
+		}
+		before := len(src.LoadedBy(key))
+		first.Group("scores").Delete(key) // 去掉请求节点的本地缓存，让请求到达负责节点
+		mustGet(t, first, key)
+		loaded := src.LoadedBy(key)
+		switch {
+		case owner == joined:
+			moved++
+			if len(loaded) != before+1 || loaded[len(loaded)-1] != joined.Addr {
+				t.Fatalf("%s should be loaded by the new owner %s, loaded by %v", key, joined.Addr, loaded)
+			}
+		case owner == first:
+			// 请求节点自己是负责节点，删除本地缓存后重新回源
+		default:
+			if len(loaded) != before {
+				t.Fatalf("%s kept its owner %s but was loaded again: %v", key, owner.Addr, loaded)
+			}
+		}
+	}
+	if moved == 0 || moved > 70 {
+		t.Fatalf("%d of 100 keys moved to the new node", moved)
+	}
+}
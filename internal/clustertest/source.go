@@ -0,0 +1,76 @@
+package clustertest
+
+import (
+	service "gocache/internal"
+	"sync"
+)
+
+/*
+Source 内存中的假数据源，所有节点共享，记录每个 key 由哪些节点回源
+  - 不存在的 key 返回 service.ErrNotFound
+  - Retriever 为每个节点创建一个 Retriever，可以直接作为 GroupSpec.Retriever
+*/
+type Source struct {
+	mu       sync.Mutex
+	data     map[string]string
+	loadedBy map[string][]string // key -> 按回源顺序排列的节点地址
+}
+
+// NewSource 创建包含 data 的数据源，data 会被复制
+func NewSource(data map[string]string) *Source {
+	s := &Source{data: make(map[string]string, len(data)), loadedBy: make(map[string][]string)}
+	for k, v := range data {
+		s.data[k] = v
+	}
+	return s
+}
+
+// Set 写入或者修改数据源中的 key
+func (s *Source) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = value
+}
+
+// Delete 从数据源中删除 key
+func (s *Source) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+}
+
+// Loads 返回节点 addr 回源的次数，addr 为空时返回所有节点的总次数
+func (s *Source) Loads(addr string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, nodes := range s.loadedBy {
+		for _, node := range nodes {
+			if addr == "" || node == addr {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// LoadedBy 返回为 key 回源的节点地址，按回源顺序排列
+func (s *Source) LoadedBy(key string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.loadedBy[key]...)
+}
+
+// Retriever 返回节点 addr 使用的 Retriever，回源时记录节点地址
+func (s *Source) Retriever(addr string) service.Retriever {
+	return service.RetrieveFunc(func(key string) ([]byte, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.loadedBy[key] = append(s.loadedBy[key], addr)
+		v, ok := s.data[key]
+		if !ok {
+			return nil, service.ErrNotFound
+		}
+		return []byte(v), nil
+	})
+}
@@ -68,11 +68,10 @@ func (m *ConsistentHash) GetTruthNode(key string) string {
 	idx := sort.Search(len(m.virtualNodes), func(i int) bool {
 		return m.virtualNodes[i] >= hash
 	})
-	logger.LogrusObj.Infof("计算出 key 的 hash: %d, 顺时针选择的虚拟节点下标 idx: %d", hash, idx)
-	//logger.LogrusObj.Infof("2322626082 2871910706 3693793700 4252452532")
-	logger.LogrusObj.Infof("选择的真实节点：%s", m.hashMap[m.virtualNodes[idx%len(m.virtualNodes)]])
 	//idx==len(m.virtualNodes)  应该选择m.virtualNodes[0]
-	return m.hashMap[m.virtualNodes[idx%len(m.virtualNodes)]]
+	node := m.hashMap[m.virtualNodes[idx%len(m.virtualNodes)]]
+	logger.SampledDebugf("计算出 key 的 hash: %d, 顺时针选择的虚拟节点下标 idx: %d, 真实节点：%s", hash, idx, node)
+	return node
 }
 
 func (m *ConsistentHash) RemovePeer(key string) {
@@ -80,7 +79,7 @@ func (m *ConsistentHash) RemovePeer(key string) {
 	// logger.LogrusObj.Warn("peers:", v)
 	virtualHash := []int{}
 	for key, v := range m.virtualNodes {
-		logger.LogrusObj.Warn("peers: ", v)
+		logger.LogrusObj.Debug("peers: ", v)
 		if v == key {
 			delete(m.hashMap, key)
 			virtualHash = append(virtualHash, key)
@@ -95,3 +94,31 @@ func (m *ConsistentHash) RemovePeer(key string) {
 		}
 	}
 }
+
+/*
+Shares 返回每个真实节点负责的哈希空间比例和虚拟节点数
+  - 落在 (前一个虚拟节点, 虚拟节点] 区间的 key 由该虚拟节点负责，第一个虚拟节点还负责环尾绕回的部分
+  - 所有比例之和为 1，环为空时返回空 map
+*/
+func (m *ConsistentHash) Shares() (shares map[string]float64, vnodes map[string]int) {
+	shares, vnodes = make(map[string]float64), make(map[string]int)
+	n := len(m.virtualNodes)
+	if n == 0 {
+		return
+	}
+	const space = float64(1 << 32)
+	for i, hash := range m.virtualNodes {
+		prev := m.virtualNodes[(i+n-1)%n]
+		arc := float64(hash - prev)
+		if i == 0 {
+			arc += space
+		}
+		if n == 1 {
+			arc = space
+		}
+		node := m.hashMap[hash]
+		shares[node] += arc / space
+		vnodes[node]++
+	}
+	return
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"gocache/config"
 	"gocache/utils/logger"
+	"math"
 	"testing"
 )
 
@@ -36,3 +37,26 @@ func TestConsistentHash(t *testing.T) {
 		t.Fatal("GetTruthNode 错误")
 	}
 }
+
+func TestConsistentHashShares(t *testing.T) {
+	ch := NewConsistentHash(2, nil)
+	if shares, _ := ch.Shares(); len(shares) != 0 {
+		t.Fatalf("empty ring shares = %v", shares)
+	}
+	// node2 的虚拟节点 1330857165 1447589260，node4 的虚拟节点 2788221432 3207319737
+	ch.AddTruthNode([]string{"2", "4"})
+	shares, vnodes := ch.Shares()
+	want := float64(3207319737-1447589260) / float64(1<<32)
+	if math.Abs(shares["4"]-want) > 1e-9 || math.Abs(shares["2"]+shares["4"]-1) > 1e-9 {
+		t.Fatalf("shares = %v, expect node 4 %.6f", shares, want)
+	}
+	if vnodes["2"] != 2 || vnodes["4"] != 2 {
+		t.Fatalf("virtual nodes = %v, expect 2 each", vnodes)
+	}
+
+	single := NewConsistentHash(1, nil)
+	single.AddTruthNode([]string{"only"})
+	if shares, _ := single.Shares(); shares["only"] != 1 {
+		t.Fatalf("single node share = %v, expect 1", shares)
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType 缓存变更事件的类型
+type EventType int
+
+const (
+	EventEvicted             EventType = iota + 1 // 容量不足被淘汰
+	EventExpired                                  // 到期被删除
+	EventSet                                      // 通过 Group.Set 写入
+	EventDeleted                                  // 通过 Group.Delete 删除
+	EventLoadedFromPeer                           // 从负责节点或持有租约的节点取回
+	EventLoadedFromRetriever                      // 查询数据源后写入缓存
+	EventPurged                                   // 通过 Group.Purge 清空，Key 为空
+)
+
+var eventTypeNames = map[EventType]string{
+	EventEvicted:             "evicted",
+	EventExpired:             "expired",
+	EventSet:                 "set",
+	EventDeleted:             "deleted",
+	EventLoadedFromPeer:      "loaded_from_peer",
+	EventLoadedFromRetriever: "loaded_from_retriever",
+	EventPurged:              "purged",
+}
+
+// Valid 返回 t 是否是已定义的事件类型
+func (t EventType) Valid() bool {
+	_, ok := eventTypeNames[t]
+	return ok
+}
+
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+/*
+Event 一次缓存变更
+  - Value 为写入或被移除的值，Deleted、Purged 事件没有值
+  - 负缓存条目（数据源中不存在的 key）不产生事件
+*/
+type Event struct {
+	Group string
+	Key   string
+	Type  EventType
+	Value ByteView
+	Time  time.Time
+}
+
+/*
+eventBus Group 的事件总线
+  - 没有订阅者时 publish 只读一次原子计数，不影响读写路径
+  - 发布不阻塞：订阅者的缓冲区已满时丢弃事件并计数，订阅者通过 Dropped 感知后自行重新同步
+  - publish 可能在持有 cache.mu 时调用（淘汰、过期回调），不能在其中访问缓存
+*/
+type eventBus struct {
+	group string
+	count atomic.Int32
+
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+func newEventBus(group string) *eventBus {
+	return &eventBus{group: group, subs: make(map[*Subscription]struct{})}
+}
+
+func (b *eventBus) publish(typ EventType, key string, value ByteView) {
+	if b.count.Load() == 0 {
+		return
+	}
+	e := Event{Group: b.group, Key: key, Type: typ, Value: value, Time: time.Now()}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		if sub.types != 0 && sub.types&(1<<typ) == 0 {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// Subscription 一个事件订阅，从 C 读取事件，不再需要时调用 Close
+type Subscription struct {
+	C <-chan Event
+
+	bus     *eventBus
+	ch      chan Event
+	types   uint64
+	dropped atomic.Int64
+	once    sync.Once
+}
+
+/*
+Subscribe 订阅 Group 的变更事件
+  - buffer 为缓冲区大小，小于 1 时按 1 处理；读取跟不上时新事件被丢弃，见 Subscription.Dropped
+  - types 为空时订阅所有类型的事件；未定义的类型不会出现，订阅后收不到对应事件
+  - 只包含本节点上的变更，其他节点的缓存需要分别订阅
+*/
+func (g *Group) Subscribe(buffer int, types ...EventType) *Subscription {
+	ch := make(chan Event, max(buffer, 1))
+	sub := &Subscription{C: ch, bus: g.events, ch: ch}
+	for _, t := range types {
+		if t.Valid() {
+			sub.types |= 1 << t
+		} else {
+			// 第 0 位不对应任何事件类型，只用来表示指定了过滤条件，避免只含未定义类型时变成订阅全部
+			sub.types |= 1
+		}
+	}
+	g.events.mu.Lock()
+	g.events.subs[sub] = struct{}{}
+	g.events.count.Add(1)
+	g.events.mu.Unlock()
+	return sub
+}
+
+// Close 取消订阅并关闭 C，可以重复调用
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.count.Add(-1)
+		s.bus.mu.Unlock()
+		close(s.ch)
+	})
+}
+
+// Dropped 返回因缓冲区已满被丢弃的事件数
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
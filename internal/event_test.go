@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	pb "gocache/api/groupcachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func nextEvent(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case e := <-sub.C:
+		return e
+	case <-time.After(time.Second * 3):
+		t.Fatal("no event received")
+		return Event{}
+	}
+}
+
+func TestGroupEvents(t *testing.T) {
+	g := NewGroup("events", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, ErrNotFound
+		}
+		return []byte("value-" + key), nil
+	}), WithMaxEntries(1), WithNegativeTTL(time.Minute))
+	sub := g.Subscribe(16)
+	defer sub.Close()
+
+	g.Get("a")
+	g.Get("b")
+	g.Get("missing")
+	g.Set("c", []byte("value-c"))
+	g.Delete("c")
+
+	// 负缓存条目不产生事件，但写入时会淘汰 b
+	for _, want := range []struct {
+		typ   EventType
+		key   string
+		value string
+	}{
+		{EventLoadedFromRetriever, "a", "value-a"},
+		{EventEvicted, "a", "value-a"},
+		{EventLoadedFromRetriever, "b", "value-b"},
+		{EventEvicted, "b", "value-b"},
+		{EventSet, "c", "value-c"},
+		{EventDeleted, "c", ""},
+	} {
+		e := nextEvent(t, sub)
+		if e.Group != "events" || e.Type != want.typ || e.Key != want.key || e.Value.String() != want.value {
+			t.Fatalf("got %s %s=%q, expect %s %s=%q", e.Type, e.Key, e.Value.String(), want.typ, want.key, want.value)
+		}
+	}
+	select {
+	case e := <-sub.C:
+		t.Fatalf("unexpected event %s %s", e.Type, e.Key)
+	default:
+	}
+}
+
+func TestGroupExpiredEvent(t *testing.T) {
+	g := NewGroup("events-expired", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	}), WithTTL(time.Millisecond*10))
+	sub := g.Subscribe(16, EventExpired)
+	defer sub.Close()
+
+	g.Get("key")
+	if e := nextEvent(t, sub); e.Type != EventExpired || e.Key != "key" {
+		t.Fatalf("got %s %s, expect expired key", e.Type, e.Key)
+	}
+}
+
+func TestSubscriptionDropped(t *testing.T) {
+	g := NewGroup("events-dropped", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	}))
+	sub := g.Subscribe(1, EventSet)
+	g.Get("loaded")
+	g.Set("a", []byte("1"))
+	g.Set("b", []byte("2"))
+
+	if e := nextEvent(t, sub); e.Key != "a" {
+		t.Fatalf("got %s %s, expect set a", e.Type, e.Key)
+	}
+	if n := sub.Dropped(); n != 1 {
+		t.Fatalf("dropped %d events, expect 1", n)
+	}
+	sub.Close()
+	sub.Close()
+	if _, ok := <-sub.C; ok {
+		t.Fatal("C should be closed")
+	}
+	g.Set("c", []byte("3"))
+}
+
+func TestSubscribeUnknownType(t *testing.T) {
+	g := NewGroup("events-unknown", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	}))
+	// 未定义的类型不会 panic，也不会变成订阅所有类型
+	sub := g.Subscribe(16, EventType(-1), EventType(64))
+	defer sub.Close()
+	g.Set("key", []byte("value"))
+	select {
+	case e := <-sub.C:
+		t.Fatalf("unexpected event %s %s", e.Type, e.Key)
+	default:
+	}
+}
+
+// watchStream 记录 Watch 推送的事件
+type watchStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	events chan *pb.Event
+}
+
+func (s *watchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *watchStream) Send(e *pb.Event) error {
+	s.events <- e
+	return nil
+}
+
+func TestServerWatch(t *testing.T) {
+	g := NewGroup("events-watch", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	}))
+	s := &Server{Addr: "localhost:9999"}
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &watchStream{ctx: ctx, events: make(chan *pb.Event, 16)}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Watch(&pb.WatchRequest{Group: "events-watch", Types: []pb.EventType{pb.EventType_SET}}, stream)
+	}()
+
+	// 等待订阅生效
+	for g.events.count.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	g.Get("loaded")
+	g.Set("key", []byte("new"))
+	select {
+	case e := <-stream.events:
+		if e.Type != pb.EventType_SET || e.Key != "key" || string(e.Value) != "new" || e.Dropped != 0 {
+			t.Fatalf("got %v, expect SET key=new", e)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("no event streamed")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Watch returned %v after cancel", err)
+	}
+	if n := g.events.count.Load(); n != 0 {
+		t.Fatalf("%d subscriptions left after Watch returned", n)
+	}
+	if err := s.Watch(&pb.WatchRequest{Group: "no-such-group"}, stream); err == nil {
+		t.Fatal("Watch on a missing group should fail")
+	}
+	err := s.Watch(&pb.WatchRequest{Group: "events-watch", Types: []pb.EventType{pb.EventType_SET, -1}}, stream)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Watch with type -1 returned %v, expect InvalidArgument", err)
+	}
+}
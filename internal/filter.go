@@ -0,0 +1,101 @@
+package service
+
+import (
+	"gocache/internal/bloom"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultBloomFPRate = 0.01
+
+/*
+keyFilter Group 的布隆过滤器，记录数据源中一定存在的 key
+  - 未构建（或构建失败）时不做任何过滤
+  - 重建期间通过 Set 写入的 key 先记录在 pending 中，重建完成后加入新的过滤器，避免丢失
+  - 过滤器大小取 expected 和实际 key 数量两倍中的较大值，为后续 Set 留出余量
+*/
+type keyFilter struct {
+	loader   KeyLoader
+	expected int
+	fpRate   float64
+	filter   atomic.Pointer[bloom.Filter]
+
+	mu         sync.Mutex
+	rebuilding bool
+	pending    []string
+}
+
+// newKeyFilter 未设置 KeyLoader 时返回 nil，nil 的 keyFilter 不过滤任何 key
+func newKeyFilter(o groupOptions) *keyFilter {
+	if o.keyLoader == nil {
+		return nil
+	}
+	fpRate := o.bloomFPRate
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = defaultBloomFPRate
+	}
+	return &keyFilter{loader: o.keyLoader, expected: o.bloomExpected, fpRate: fpRate}
+}
+
+// mightContain 返回 false 时 key 一定不存在于数据源中
+func (f *keyFilter) mightContain(key string) bool {
+	if f == nil {
+		return true
+	}
+	filter := f.filter.Load()
+	return filter == nil || filter.Test(key)
+}
+
+// add 记录新写入的 key
+func (f *keyFilter) add(key string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if filter := f.filter.Load(); filter != nil {
+		filter.Add(key)
+	}
+	if f.rebuilding {
+		f.pending = append(f.pending, key)
+	}
+}
+
+// rebuild 调用 KeyLoader 重新构建过滤器，同一时间只有一个重建任务
+func (f *keyFilter) rebuild() (int, error) {
+	f.mu.Lock()
+	if f.rebuilding {
+		f.mu.Unlock()
+		return 0, errRebuilding
+	}
+	f.rebuilding = true
+	f.mu.Unlock()
+
+	keys := make([]string, 0, f.expected)
+	err := f.loader(func(key string) {
+		keys = append(keys, key)
+	})
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rebuilding = false
+	pending := f.pending
+	f.pending = nil
+	if err != nil {
+		return 0, err
+	}
+
+	n := f.expected
+	if 2*len(keys) > n {
+		n = 2 * len(keys)
+	}
+	filter := bloom.New(n, f.fpRate)
+	for _, key := range keys {
+		filter.Add(key)
+	}
+	for _, key := range pending {
+		filter.Add(key)
+	}
+	f.filter.Store(filter)
+	return len(keys), nil
+}
@@ -2,44 +2,160 @@ package service
 
 import (
 	"context"
-	"errors"
-	pb "gocache/api/studentpb"
+	"gocache/config"
+	"gocache/internal/policy/interfaces"
 	dao2 "gocache/test/pkg/student/dao"
 	"gocache/utils/logger"
-	"gorm.io/gorm"
-	"math/rand"
 	"strconv"
 	"time"
 )
 
+const (
+	defaultPolicy      = "lru"
+	defaultMaxBytes    = 100 * 2 * 20
+	defaultNegativeTTL = 5 // 负缓存默认存活时间（秒）
+)
+
+/*
+groupSettings 读取 config.yml 中 group 的策略、容量和可选配置，未配置时使用默认值
+  - 条目的 TTL 默认取 services.groupcache.ttl，group 中配置了 ttl 时以 group 为准
+  - 配置了 softTTL 时，ttl 作为硬 TTL，启用 stale-while-revalidate
+  - 负缓存默认存活 defaultNegativeTTL 秒，可以通过 negativeTTL 调整
+  - 配置了 bloomFilter 时，从学生表加载所有名字构建布隆过滤器
+  - SingleFlight 的结果缓存默认 10 秒、1024 个，flightTTL 为负数时关闭
+  - 配置了 batchWindow 时，窗口内的未命中合并为一次 IN 查询
+*/
+func groupSettings(name string) (strategy string, maxBytes int64, opts []GroupOption) {
+	strategy, maxBytes = defaultPolicy, defaultMaxBytes
+	if config.Conf == nil {
+		return
+	}
+	ttl, softTTL, negativeTTL := 0, 0, defaultNegativeTTL
+	if s, ok := config.Conf.Services["groupcache"]; ok && s != nil {
+		ttl = s.TTL
+	}
+	defer func() {
+		opts = append(opts,
+			WithStaleWhileRevalidate(time.Duration(softTTL)*time.Second, time.Duration(ttl)*time.Second),
+			WithNegativeTTL(time.Duration(negativeTTL)*time.Second))
+	}()
+	if c, ok := config.Conf.Groups[name]; ok && c != nil {
+		if c.TTL > 0 {
+			ttl = c.TTL
+		}
+		softTTL = c.SoftTTL
+		if c.NegativeTTL > 0 {
+			negativeTTL = c.NegativeTTL
+		}
+		if c.TTLJitter > 0 {
+			opts = append(opts, WithTTLJitter(c.TTLJitter))
+		}
+		if c.EarlyBeta > 0 {
+			opts = append(opts, WithEarlyExpiration(c.EarlyBeta))
+		}
+		if c.Grace > 0 {
+			opts = append(opts, WithStaleOnError(time.Duration(c.Grace)*time.Second))
+		}
+		if c.BloomFilter {
+			opts = append(opts, WithBloomFilter(loadStudentNames, c.BloomExpected, c.BloomFPRate))
+		}
+		if c.RefreshAhead > 0 {
+			opts = append(opts, WithRefreshAhead(time.Duration(c.RefreshAhead)*time.Second, c.RefreshHits, c.RefreshConcurrency))
+		}
+		if c.FlightTTL != 0 || c.FlightEntries > 0 {
+			flightTTL, flightEntries := defaultFlightTTL, defaultFlightEntries
+			if c.FlightTTL != 0 {
+				flightTTL = time.Duration(max(c.FlightTTL, 0)) * time.Second
+			}
+			if c.FlightEntries > 0 {
+				flightEntries = c.FlightEntries
+			}
+			opts = append(opts, WithFlightCache(flightTTL, flightEntries))
+		}
+		if c.LoadLease > 0 {
+			opts = append(opts, WithLoadLease(time.Duration(c.LoadLease)*time.Second))
+		}
+		if c.BatchWindow > 0 {
+			opts = append(opts, WithBatching(time.Duration(c.BatchWindow)*time.Millisecond, c.BatchSize))
+			if c.BatchTimeout > 0 {
+				opts = append(opts, WithBatchTimeout(time.Duration(c.BatchTimeout)*time.Millisecond))
+			}
+		}
+		if c.HotKeys > 0 {
+			decay := defaultHotKeyDecay
+			if c.HotKeyDecay > 0 {
+				decay = time.Duration(c.HotKeyDecay) * time.Second
+			}
+			opts = append(opts, WithHotKeys(c.HotKeys, decay))
+		}
+		if c.HotReplicaBytes > 0 && c.HotReplicaTTL > 0 {
+			opts = append(opts, WithHotKeyReplication(c.HotReplicaMinCount, c.HotReplicaBytes, time.Duration(c.HotReplicaTTL)*time.Second))
+		}
+		if c.Policy != "" {
+			strategy = c.Policy
+		}
+		if c.MaxBytes > 0 {
+			maxBytes = c.MaxBytes
+		}
+		if c.MaxEntries > 0 {
+			opts = append(opts, WithMaxEntries(c.MaxEntries))
+		}
+		if c.Accounting == "bytes" {
+			opts = append(opts, WithSizer(func(string) interfaces.Sizer { return interfaces.BytesSizer }))
+		}
+	}
+	return
+}
+
+/*
+retrieveScores 一次查询多个学生的分数
+  - 不存在的名字不出现在结果中，由 Group 视为 ErrNotFound 写入负缓存，防止恶意请求穿透到数据库
+  - 未开启批量时每次只查询一个名字
+*/
+func retrieveScores(ctx context.Context, keys []string) (map[string][]byte, error) {
+	start := time.Now()
+	stus, err := dao2.NewStudentDao(ctx).ShowStudentsByNames(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string][]byte, len(stus))
+	for _, stu := range stus {
+		if _, ok := values[stu.Name]; !ok {
+			values[stu.Name] = []byte(strconv.FormatFloat(stu.Score, 'f', 2, 64))
+		}
+	}
+	logger.SampledDebugf("成功从后端数据库中查询到 %d/%d 个学生的分数，总耗时: %v ms", len(values), len(keys), time.Since(start).Milliseconds())
+	return values, nil
+}
+
+// loadStudentNames 从数据库批量读取所有学生的名字
+func loadStudentNames(add func(key string)) error {
+	return dao2.NewStudentDao(context.Background()).ScanStudentNames(add)
+}
+
 /*
 NewGroupManager 为groupnames 创建 Group 实例，并将它们存储在一个全局的 GroupManager 映射中
 */
 func NewGroupManager(groupnames []string, currentPeerAddr string) map[string]*Group {
 	// 为每个group构造一个Group实例
 	for i := 0; i < len(groupnames); i++ {
-		g := NewGroup(groupnames[i], "lru", 100*2*20, RetrieveFunc(func(key string) ([]byte, error) {
-			start := time.Now()
-			dao := dao2.NewStudentDao(context.Background())
-			stus, err := dao.ShowStudentInfo(&pb.StudentRequest{
-				Name:  key,
-				Score: rand.Float32(),
-			})
-
-			if err != nil {
-				if errors.Is(err, gorm.ErrRecordNotFound) {
-					// 优化点：即使没有查询到，但是为了防止恶意攻击，这里还是往缓存中 put 一个 key 的空值并设置一个相对合理的过期时间
-					return []byte{}, gorm.ErrRecordNotFound
-				} else {
-					return []byte{}, err
-				}
-			} else {
-				logger.LogrusObj.Infof("成功从后端数据库中查询到学生 %s 的分数：%v", key, stus.Score)
-				logger.LogrusObj.Warnf("查询数据库总耗时: %v ms", time.Since(start).Milliseconds())
-			}
-			return []byte(strconv.FormatFloat(stus.Score, 'f', 2, 64)), nil
-		}))
+		strategy, maxBytes, opts := groupSettings(groupnames[i])
+		g := NewGroup(groupnames[i], strategy, maxBytes, RetrieveManyFunc(retrieveScores), opts...)
 		GroupManager[groupnames[i]] = g
+		if c, ok := config.Conf.Groups[groupnames[i]]; ok && c != nil && c.BloomFilter && c.BloomRebuild > 0 {
+			go rebuildPeriodically(g, time.Duration(c.BloomRebuild)*time.Second)
+		}
 	}
 	return GroupManager
 }
+
+// rebuildPeriodically 定期重建布隆过滤器，纳入其他节点写入的 key
+func rebuildPeriodically(g *Group, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := g.Rebuild(); err != nil {
+			logger.LogrusObj.Warnf("[GoCache] Group %s rebuild bloom filter failed: %v", g.name, err)
+		}
+	}
+}
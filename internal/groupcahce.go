@@ -1,11 +1,15 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gocache/utils/logger"
-	"gorm.io/gorm"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -39,6 +43,22 @@ type Group struct {
 	retriever Retriever
 	server    Picker
 	flight    *SingleFlight
+	stats     groupStats
+	events    *eventBus
+	options   groupOptions // 创建时的配置，供 Config 查看
+
+	refreshing sync.Map   // 正在后台刷新的 key，保证每个 key 同时只有一个刷新任务
+	refresher  *refresher // 热点 key 的提前刷新，未开启时为 nil
+
+	negativeTTL time.Duration // 负缓存的存活时间，0 表示不缓存
+	earlyBeta   float64       // 概率提前过期的 beta，0 表示关闭
+	keys        *keyFilter    // 已存在 key 的布隆过滤器，未开启时为 nil
+	leases      *leaseTable   // 作为负责节点发放的回源租约，未开启时为 nil
+	batcher     *batcher      // 合并短时间内多次回源的批量查询，未开启时为 nil
+
+	hotKeys         *hotKeys // 热点 key 统计，未开启时为 nil
+	replicas        *cache   // 从负责节点取回的热点 key 的本地副本，未开启时为 nil
+	replicaMinCount int64    // 复制到本地的最小估计访问次数
 }
 
 // RegisterServer 注册一个 server Picker  ,用以选择远程对等节点
@@ -51,19 +71,14 @@ func (g *Group) RegisterServer(peers Picker) {
 
 // NewGroup :创建Group实例
 
-func NewGroup(name string, strategy string, maxBytes int64, retriever Retriever) *Group {
+func NewGroup(name string, strategy string, maxBytes int64, retriever Retriever, opts ...GroupOption) *Group {
 	if retriever == nil {
 		panic("Group Retriver must be existed!")
 	}
 	if _, ok := GroupManager[name]; ok {
 		return GroupManager[name]
 	}
-	g := &Group{
-		name:      name,
-		mainCache: newCache(strategy, maxBytes),
-		retriever: retriever,
-		flight:    NewSingleFlight(time.Second * 10),
-	}
+	g := newGroup(name, strategy, maxBytes, retriever, opts)
 
 	mu.Lock()
 	GroupManager[name] = g
@@ -71,6 +86,48 @@ func NewGroup(name string, strategy string, maxBytes int64, retriever Retriever)
 	return g
 }
 
+// newGroup 按配置创建 Group，不加入任何命名空间
+func newGroup(name string, strategy string, maxBytes int64, retriever Retriever, opts []GroupOption) *Group {
+	o := defaultGroupOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	// SingleFlight 缓存的结果不能比缓存条目活得更久，否则过期后仍会拿到旧结果
+	flightTTL := o.flightTTL
+	if o.ttl > 0 && o.ttl < flightTTL {
+		flightTTL = o.ttl
+	}
+	g := &Group{
+		name:      name,
+		mainCache: newCache(strategy, maxBytes, o),
+		retriever: retriever,
+		flight:    NewSingleFlight(flightTTL, o.flightEntries),
+		events:    newEventBus(name),
+
+		negativeTTL: o.negativeTTL,
+		earlyBeta:   o.earlyBeta,
+		keys:        newKeyFilter(o),
+		batcher:     newBatcher(retriever, o.batchWindow, o.batchSize, o.batchTimeout),
+
+		replicas:        newReplicaCache(o),
+		replicaMinCount: o.replicaMinCount,
+	}
+	if o.hotKeys <= 0 && g.replicas != nil {
+		o.hotKeys, o.hotKeyDecay = defaultHotKeys, defaultHotKeyDecay
+	}
+	g.hotKeys = newHotKeys(o.hotKeys, o.hotKeyDecay)
+	g.options = o
+	g.mainCache.notify = g.events.publish
+	if g.keys != nil {
+		if err := g.Rebuild(); err != nil {
+			logger.LogrusObj.Warnf("[GoCache] Group %s build bloom filter failed, keys are not filtered: %v", name, err)
+		}
+	}
+	g.refresher = newRefresher(g, o, g.mainCache.wheel)
+	g.leases = newLeaseTable(g, o.loadLease, g.mainCache.wheel)
+	return g
+}
+
 // GetGroup :返回 NewGroup 创建的group，没有则返回nil
 func GetGroup(name string) *Group {
 	mu.RLock()
@@ -79,6 +136,105 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// Groups 返回所有已经创建的 group，按名称排序
+func Groups() []*Group {
+	mu.RLock()
+	groups := make([]*Group, 0, len(GroupManager))
+	for _, g := range GroupManager {
+		groups = append(groups, g)
+	}
+	mu.RUnlock()
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].name < groups[j].name
+	})
+	return groups
+}
+
+/*
+GroupRegistry group 的命名空间，同一个命名空间中 group 的名称唯一
+  - NewGroup、GetGroup、Groups 使用进程全局的命名空间 GroupManager
+  - 在一个进程中运行多个节点时（例如测试），每个节点使用自己的 GroupRegistry，同名 group 互不影响
+*/
+type GroupRegistry struct {
+	mu     sync.RWMutex
+	groups map[string]*Group
+}
+
+func NewGroupRegistry() *GroupRegistry {
+	return &GroupRegistry{groups: make(map[string]*Group)}
+}
+
+// NewGroup 在 r 中创建 group，与全局的 NewGroup 相同，名称已经存在时返回已有的 group
+func (r *GroupRegistry) NewGroup(name string, strategy string, maxBytes int64, retriever Retriever, opts ...GroupOption) *Group {
+	if retriever == nil {
+		panic("Group Retriver must be existed!")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if g, ok := r.groups[name]; ok {
+		return g
+	}
+	g := newGroup(name, strategy, maxBytes, retriever, opts)
+	r.groups[name] = g
+	return g
+}
+
+// Get 返回 r 中名为 name 的 group，没有则返回 nil
+func (r *GroupRegistry) Get(name string) *Group {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.groups[name]
+}
+
+// Groups 返回 r 中所有的 group，按名称排序
+func (r *GroupRegistry) Groups() []*Group {
+	r.mu.RLock()
+	groups := make([]*Group, 0, len(r.groups))
+	for _, g := range r.groups {
+		groups = append(groups, g)
+	}
+	r.mu.RUnlock()
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].name < groups[j].name
+	})
+	return groups
+}
+
+// Name 返回 Group 的名称
+func (g *Group) Name() string {
+	return g.name
+}
+
+// Settings 返回 Group 当前使用的淘汰策略和缓存容量
+func (g *Group) Settings() (strategy string, maxBytes int64) {
+	return g.mainCache.settings()
+}
+
+/*
+Resize 在线调整 Group 的缓存容量
+  - 现有条目按价值从高到低迁移到新容量的策略实例中，不会清空缓存
+  - 容量缩小时，放不下的低价值条目被淘汰
+*/
+func (g *Group) Resize(maxBytes int64) error {
+	if err := g.mainCache.resize(maxBytes); err != nil {
+		return err
+	}
+	logger.LogrusObj.Infof("[GoCache] Group %s resized to %d bytes", g.name, maxBytes)
+	return nil
+}
+
+/*
+SetPolicy 在线切换 Group 的淘汰策略（lru、lfu、fifo）
+  - 现有条目按旧策略的价值排序迁移到新策略实例中，不会清空缓存
+*/
+func (g *Group) SetPolicy(strategy string) error {
+	if err := g.mainCache.setPolicy(strategy); err != nil {
+		return err
+	}
+	logger.LogrusObj.Infof("[GoCache] Group %s switched to %s policy", g.name, strategy)
+	return nil
+}
+
 //func DestroyGroup(name string) {
 //	g := GetGroup(name)
 //	if g != nil {
@@ -105,36 +261,186 @@ Get
 */
 
 func (g *Group) Get(key string) (ByteView, error) {
+	view, _, err := g.get(context.Background(), key)
+	return view, err
+}
+
+/*
+get 与 Get 相同，同时返回值是否已经超过硬 TTL（stale）
+  - 超过软 TTL 的值仍在 TTL 内，立即返回并在后台刷新，不标记为 stale
+  - 超过硬 TTL 但仍在宽限期内的值不直接返回，先阻塞回源，回源失败时才返回该值，
+    回源的错误只记录日志；没有可用的旧值时错误原样返回给调用方
+  - 命中负缓存、被布隆过滤器拦截或数据源返回 ErrNotFound 时返回 ErrNotFound，不会返回旧值
+*/
+func (g *Group) get(ctx context.Context, key string) (value ByteView, stale bool, err error) {
 	if key == "" {
-		return ByteView{}, fmt.Errorf("key is required!")
+		return ByteView{}, false, fmt.Errorf("key is required!")
+	}
+	g.stats.gets.Add(1)
+	g.hotKeys.touch(key)
+	_, span := tracer.Start(ctx, "cache.lookup")
+	it, ok := g.mainCache.lookup(key)
+	span.SetAttributes(attribute.Bool("gocache.hit", ok && !it.expired()))
+	span.End()
+	if ok && !it.expired() {
+		g.stats.hits.Add(1)
+		if it.negative {
+			g.stats.negativeHits.Add(1)
+			return ByteView{}, false, ErrNotFound
+		}
+		if it.stale() {
+			g.stats.staleHits.Add(1)
+			g.revalidate(key)
+		} else if it.earlyExpired(g.earlyBeta) {
+			g.stats.earlyHits.Add(1)
+			g.revalidate(key)
+		}
+		g.refresher.touch(key, it)
+		logger.SampledDebugf("[GoCache] Group %s cache hit....,key %s ...", g.name, key)
+		return it.view, false, nil
 	}
-	if v, ok := g.mainCache.get(key); ok {
-		logger.LogrusObj.Infof("[GoCache] Group %s cache hit....,key %s ...", g.name, key)
-		return v, nil
+
+	// 负责节点上的热点 key 在本地有副本
+	if g.replicas != nil {
+		if view, ok := g.replicas.get(key); ok {
+			g.stats.hits.Add(1)
+			g.stats.replicaHits.Add(1)
+			return view, false, nil
+		}
 	}
 
 	// cache未命中
-	return g.load(key)
+	g.stats.misses.Add(1)
+	if !g.keys.mightContain(key) {
+		g.stats.filtered.Add(1)
+		return ByteView{}, false, ErrNotFound
+	}
+	value, err = g.load(ctx, key)
+	if err != nil && ok && !it.negative && !errors.Is(err, ErrNotFound) {
+		g.stats.staleOnError.Add(1)
+		logger.LogrusObj.Warnf("[GoCache] Group %s load key %s failed, serve the expired value: %v", g.name, key, err)
+		return it.view, true, nil
+	}
+	return value, false, err
+}
+
+/*
+Set 写入 key 的最新值，例如业务更新数据库之后
+  - 更新本地缓存，并删除 SingleFlight 缓存的旧结果
+  - key 加入布隆过滤器，之后的读取不会被拦截
+  - 只作用于当前节点，其他节点的布隆过滤器需要同样调用 Set 或者 Rebuild
+*/
+func (g *Group) Set(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key is required!")
+	}
+	g.keys.add(key)
+	g.flight.Invalidate(key)
+	if g.replicas != nil {
+		g.replicas.remove(key)
+	}
+	view := ByteView{b: cloneBytes(value)}
+	g.populateCache(key, view)
+	g.events.publish(EventSet, key, view)
+	return nil
+}
+
+/*
+Delete 删除 key，例如业务删除数据库中的记录之后
+  - 删除本地缓存中的条目（包括负缓存和热点副本），并删除 SingleFlight 缓存的结果
+  - 只作用于当前节点，key 不存在时返回 false
+*/
+func (g *Group) Delete(key string) bool {
+	g.flight.Invalidate(key)
+	removed := g.mainCache.remove(key)
+	if g.replicas != nil && g.replicas.remove(key) {
+		removed = true
+	}
+	if removed {
+		g.events.publish(EventDeleted, key, ByteView{})
+	}
+	return removed
+}
+
+/*
+Rebuild 调用 KeyLoader 重新构建布隆过滤器，构建期间旧的过滤器继续生效
+  - 未开启布隆过滤器时返回错误
+*/
+func (g *Group) Rebuild() error {
+	if g.keys == nil {
+		return fmt.Errorf("group %s has no bloom filter", g.name)
+	}
+	n, err := g.keys.rebuild()
+	if err != nil {
+		return err
+	}
+	logger.LogrusObj.Infof("[GoCache] Group %s bloom filter rebuilt with %d keys", g.name, n)
+	return nil
+}
+
+/*
+revalidate 在后台刷新已经超过软 TTL 或触发概率提前过期的条目
+  - 同一个 key 同时只有一个刷新任务，刷新通过 load 走 SingleFlight，与前台的回源请求合并
+  - SingleFlight 缓存的结果可能就是当前的旧值，刷新前先将其删除
+  - 刷新失败时旧值保留到硬 TTL
+*/
+func (g *Group) revalidate(key string) {
+	if _, loaded := g.refreshing.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+	go func() {
+		defer g.refreshing.Delete(key)
+		g.flight.Invalidate(key)
+		if _, err := g.load(context.Background(), key); err != nil {
+			logger.LogrusObj.Warnf("[GoCache] Group %s revalidate key %s failed: %v", g.name, key, err)
+		}
+	}()
 }
 
 // load 方法，使用 PickPeer 方法选择节点，若非本机节点，则调用 getFromPeer() 从远程获取。
 // 若是本机节点或失败，则回退到 getLocally()。
-func (g *Group) load(key string) (value ByteView, err error) {
+// 加载结果由所有等待者共享，调用方的 ctx 取消时立即返回 ctx.Err()，加载继续进行并写入缓存，
+// 因此加载使用去掉取消的 ctx，只保留发起加载的调用方的 trace 上下文。
+func (g *Group) load(ctx context.Context, key string) (value ByteView, err error) {
+	start := time.Now()
+	defer func() {
+		g.stats.loads.Add(1)
+		g.stats.loadNanos.Add(int64(time.Since(start)))
+	}()
+
 	// 每个key仅被获取一次
-	view, err := g.flight.Do(key, func() (interface{}, error) {
+	ctx, span := tracer.Start(ctx, "singleflight.Do")
+	var ran atomic.Bool
+	view, err, shared := g.flight.DoContext(ctx, key, func() (interface{}, error) {
+		ran.Store(true)
+		ctx := context.WithoutCancel(ctx)
 		if g.server != nil {
 			if fetcher, ok := g.server.Pick(key); ok {
-				//fmt.Println(66666666666666)
-				bytes, err := fetcher.Fetch(g.name, key)
+				g.stats.peerLoads.Add(1)
+				bytes, err := fetcher.Fetch(ctx, g.name, key)
 				if err == nil {
-					return ByteView{b: cloneBytes(bytes)}, nil
+					value := ByteView{b: cloneBytes(bytes)}
+					g.replicate(key, value)
+					g.events.publish(EventLoadedFromPeer, key, value)
+					return value, nil
+				}
+				// 负责该 key 的节点已经确认不存在，无需再查询数据源
+				if errors.Is(err, ErrNotFound) {
+					return nil, err
 				}
-				logger.LogrusObj.Warnf("fetch key %s failed, error: %s\n", fetcher, err.Error())
+				g.stats.peerErrors.Add(1)
+				logger.LogrusObj.Warnf("fetch key %s from peer %v failed, error: %s\n", key, fetcher, err.Error())
 			}
 		}
 
-		return g.getLocally(key)
+		return g.getLocally(ctx, key)
 	})
+	leader := ran.Load()
+	if !leader && ctx.Err() == nil {
+		g.stats.dedupes.Add(1)
+	}
+	span.SetAttributes(attribute.Bool("gocache.leader", leader), attribute.Bool("gocache.shared", shared))
+	endSpan(span, err)
 
 	if err == nil {
 		return view.(ByteView), nil
@@ -156,23 +462,111 @@ func (g *Group) load(key string) (value ByteView, err error) {
 //	return ByteView{b: res.Value}, err
 //}
 
-// getLocally 调用回调函数getter.Get获取数据源，并将源数据添加到缓存mainCache中
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.retriever.retrieve(key)
+/*
+acquireLease 查询数据源之前向 key 的负责节点申请回源租约
+  - 未开启租约时总是获得租约；本节点是负责节点时使用本地的租约表
+  - 负责节点不可用或等待超时时无法协调，视为获得租约直接回源
+  - 获得租约时返回的 release 必须以回源结果调用一次
+*/
+func (g *Group) acquireLease(ctx context.Context, key string) (res LeaseResult, release func([]byte, error), err error) {
+	noop := func([]byte, error) {}
+	if g.leases == nil {
+		return LeaseResult{Granted: true}, noop, nil
+	}
+	// 最多等待一个租约过期后再由自己获得租约
+	ctx, cancel := context.WithTimeout(ctx, g.leases.ttl*2)
+	defer cancel()
+
+	if g.server != nil {
+		if fetcher, ok := g.server.Pick(key); ok {
+			if leaser, ok := fetcher.(Leaser); ok {
+				res, err = leaser.Lease(ctx, g.name, key)
+				if errors.Is(err, ErrNotFound) {
+					return res, noop, err
+				}
+				if err != nil {
+					logger.LogrusObj.Warnf("[GoCache] Group %s lease key %s from owner failed, load it directly: %v", g.name, key, err)
+					return LeaseResult{Granted: true}, noop, nil
+				}
+				return res, func(value []byte, loadErr error) {
+					if err := leaser.Release(g.name, key, res.Token, value, loadErr); err != nil {
+						logger.LogrusObj.Warnf("[GoCache] Group %s release lease of key %s failed: %v", g.name, key, err)
+					}
+				}, nil
+			}
+		}
+	}
+
+	res, err = g.leases.acquire(ctx, key)
+	if errors.Is(err, context.DeadlineExceeded) {
+		logger.LogrusObj.Warnf("[GoCache] Group %s wait lease of key %s timed out, load it directly", g.name, key)
+		return LeaseResult{Granted: true}, noop, nil
+	}
+	return res, func(value []byte, loadErr error) {
+		g.leases.finish(key, res.Token, value, loadErr)
+	}, err
+}
+
+/*
+getLocally 调用回调函数getter.Get获取数据源，并将源数据添加到缓存mainCache中
+  - 开启回源租约时，先向负责节点申请租约，其他节点正在加载时直接使用其结果
+  - 本节点是负责节点并且申请租约时命中了缓存，直接返回缓存的值，不重新写入缓存，也不发布从远程节点加载的事件
+  - 检索失败时返回错误，不写入缓存
+  - 数据源中不存在时写入负缓存，防止缓存穿透
+*/
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	lease, release, err := g.acquireLease(ctx, key)
+	if err == nil && !lease.Granted {
+		if lease.Failed {
+			return ByteView{}, fmt.Errorf("%w: %s/%s", errLoadFailed, g.name, key)
+		}
+		if lease.Cached {
+			return ByteView{b: lease.Value}, nil
+		}
+		g.stats.leaseWaits.Add(1)
+		value := ByteView{b: cloneBytes(lease.Value)}
+		g.populateCache(key, value)
+		g.events.publish(EventLoadedFromPeer, key, value)
+		return value, nil
+	}
+
+	start := time.Now()
+	var bytes []byte
+	if err == nil {
+		g.stats.localLoads.Add(1)
+		spanCtx, span := tracer.Start(ctx, "Retriever.retrieve", trace.WithAttributes(attribute.Bool("gocache.batched", g.batcher != nil)))
+		bytes, err = g.retrieve(spanCtx, key)
+		endSpan(span, err)
+		observer().ObserveRetrieve(g.name, time.Since(start), err)
+		release(bytes, err)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			g.stats.localLoadErrors.Add(1)
+		}
+	}
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			logger.LogrusObj.Warnf("对于不存在的 key, 为了防止缓存穿透, 先存入缓存中并设置合理过期时间")
-			g.mainCache.add(key, ByteView{})
+		if errors.Is(err, ErrNotFound) && g.negativeTTL > 0 {
+			logger.SampledDebugf("[GoCache] Group %s key %s not found, cache it for %v", g.name, key, g.negativeTTL)
+			g.mainCache.addNegative(key, g.negativeTTL)
 		}
+		return ByteView{}, err
 	}
 
 	value := ByteView{b: cloneBytes(bytes)}
 
-	g.populateCache(key, value)
+	g.mainCache.addLoaded(key, value, time.Since(start))
+	g.events.publish(EventLoadedFromRetriever, key, value)
 
 	return value, nil
 }
 
+// retrieve 查询数据源，开启批量时加入当前批次，批量查询的 context 由 ctx 等调用方的 context 派生
+func (g *Group) retrieve(ctx context.Context, key string) ([]byte, error) {
+	if g.batcher != nil {
+		return g.batcher.retrieve(ctx, key)
+	}
+	return g.retriever.retrieve(key)
+}
+
 /*
 populateCache 填充缓存使用从基础数据库查询的数据填充缓存
 */
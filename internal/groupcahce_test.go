@@ -0,0 +1,352 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "gocache/api/groupcachepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupStaleWhileRevalidate(t *testing.T) {
+	var loads atomic.Int64
+	release := make(chan struct{})
+	g := NewGroup("stale-while-revalidate", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		n := loads.Add(1)
+		if n > 1 {
+			<-release
+		}
+		return []byte(strconv.FormatInt(n, 10)), nil
+	}), WithStaleWhileRevalidate(time.Millisecond*20, time.Second))
+
+	if v, err := g.Get("key"); err != nil || v.String() != "1" {
+		t.Fatalf("first get = (%s, %v)", v, err)
+	}
+
+	// 超过软 TTL 后立即返回旧值，并发的读只触发一次后台刷新
+	time.Sleep(time.Millisecond * 30)
+	for i := 0; i < 10; i++ {
+		if v, err := g.Get("key"); err != nil || v.String() != "1" {
+			t.Fatalf("stale get = (%s, %v), expect the stale value without blocking", v, err)
+		}
+	}
+	close(release)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if v, _ := g.mainCache.get("key"); v.String() == "2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("background refresh did not update the entry")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("retriever called %d times, expect 2", n)
+	}
+	if n := g.stats.staleHits.Load(); n != 10 {
+		t.Fatalf("stale hits = %d, expect 10", n)
+	}
+}
+
+func TestGroupRefreshAhead(t *testing.T) {
+	var loads atomic.Int64
+	g := NewGroup("refresh-ahead", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte(strconv.FormatInt(loads.Add(1), 10)), nil
+	}), WithTTL(time.Second), WithRefreshAhead(time.Millisecond*500, 3, 1))
+
+	// hot 首次未命中后又命中 3 次成为热点，cold 只访问一次
+	for i := 0; i < 4; i++ {
+		g.Get("hot")
+	}
+	g.Get("cold")
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("retriever called %d times, expect 2", n)
+	}
+
+	// 过期前 500ms 刷新 hot，越过原来的过期时间后 hot 仍然命中，cold 已经过期
+	time.Sleep(time.Millisecond * 1100)
+	misses := g.stats.misses.Load()
+	if v, err := g.Get("hot"); err != nil || v.String() != "3" {
+		t.Fatalf("hot = (%s, %v), expect the refreshed value", v, err)
+	}
+	if g.stats.misses.Load() != misses {
+		t.Fatal("hot key should never miss with refresh-ahead")
+	}
+	if _, ok := g.mainCache.get("cold"); ok {
+		t.Fatal("cold key should expire without refresh")
+	}
+	if n := g.stats.refreshes.Load(); n != 1 {
+		t.Fatalf("refreshes = %d, expect 1", n)
+	}
+}
+
+func TestGroupStaleOnError(t *testing.T) {
+	var fail atomic.Bool
+	g := NewGroup("stale-on-error", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		if fail.Load() {
+			return nil, errors.New("database is down")
+		}
+		return []byte("score"), nil
+	}), WithTTL(time.Millisecond*20), WithStaleOnError(time.Second))
+
+	if _, stale, err := g.get(context.Background(), "key"); stale || err != nil {
+		t.Fatalf("first get: stale = %v, err = %v", stale, err)
+	}
+
+	// 超过硬 TTL 且回源失败时返回宽限期内的旧值
+	time.Sleep(time.Millisecond * 30)
+	fail.Store(true)
+	if v, stale, err := g.get(context.Background(), "key"); err != nil || !stale || v.String() != "score" {
+		t.Fatalf("get = (%s, %v, %v), expect the stale value", v, stale, err)
+	}
+
+	// 没有旧值时错误原样返回，且不会写入空值
+	if _, _, err := g.get(context.Background(), "missing"); err == nil {
+		t.Fatal("retriever error should be propagated")
+	}
+	if _, ok := g.mainCache.lookup("missing"); ok {
+		t.Fatal("failed load should not populate the cache")
+	}
+
+	// 回源恢复后返回新值
+	fail.Store(false)
+	if _, stale, err := g.get(context.Background(), "key"); stale || err != nil {
+		t.Fatalf("recovered get: stale = %v, err = %v", stale, err)
+	}
+}
+
+func TestGroupNegativeCache(t *testing.T) {
+	var loads atomic.Int64
+	g := NewGroup("negative-cache", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		if key == "missing" {
+			return nil, fmt.Errorf("query %s: %w", key, ErrNotFound)
+		}
+		return []byte(key), nil
+	}), WithTTL(time.Second), WithStaleOnError(time.Second), WithNegativeTTL(time.Millisecond*20))
+
+	for i := 0; i < 3; i++ {
+		if _, err := g.Get("missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("get missing key: err = %v, expect ErrNotFound", err)
+		}
+	}
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("retriever called %d times, expect 1 with negative caching", n)
+	}
+	if it, ok := g.mainCache.lookup("missing"); !ok || !it.negative {
+		t.Fatal("missing key should be stored as a negative entry")
+	}
+
+	// 负缓存使用自己的 TTL，过期后重新回源；宽限期不适用于负缓存
+	time.Sleep(time.Millisecond * 30)
+	if _, err := g.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get missing key after negative ttl: err = %v", err)
+	}
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("retriever called %d times, expect 2 after negative ttl", n)
+	}
+}
+
+func TestServerGetNotFound(t *testing.T) {
+	NewGroup("server-not-found", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}))
+	s := &Server{Addr: "localhost:9999"}
+	_, err := s.Get(context.Background(), &pb.GetRequest{Group: "server-not-found", Key: "key"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("code = %v, expect NotFound", status.Code(err))
+	}
+	if _, err := s.Get(context.Background(), &pb.GetRequest{Group: "server-not-found"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("code = %v, expect InvalidArgument", status.Code(err))
+	}
+}
+
+func TestServerGetCanceledWhileLoading(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var loads atomic.Int64
+	g := NewGroup("server-get-canceled", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		if loads.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return []byte("value"), nil
+	}), WithFlightCache(0, 0))
+	s := &Server{Addr: "localhost:9999"}
+
+	// 发起加载的调用方和等待者取消后立即返回，不等待共享的加载
+	var wg sync.WaitGroup
+	cancels := make([]context.CancelFunc, 2)
+	errs := make([]error, 2)
+	for i := range cancels {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels[i] = cancel
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = s.Get(ctx, &pb.GetRequest{Group: "server-get-canceled", Key: "key"})
+		}(i)
+		if i == 0 {
+			<-started
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	for _, cancel := range cancels {
+		cancel()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("canceled Get should not wait for the shared load")
+	}
+	for i, err := range errs {
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Get %d = %v, expect context.Canceled", i, err)
+		}
+	}
+
+	// 加载继续进行并写入缓存，之后的读取不再回源
+	close(release)
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if _, ok := g.Peek("key"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the abandoned load should still populate the cache")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if v, err := g.Get("key"); err != nil || v.String() != "value" || loads.Load() != 1 {
+		t.Fatalf("Get = %q, %v after %d loads, expect one load", v.String(), err, loads.Load())
+	}
+}
+
+func TestAdminSetDelete(t *testing.T) {
+	g := NewGroup("server-set-delete", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte("db"), nil
+	}))
+	s := NewAdmin(&Server{Addr: "localhost:9999"})
+	ctx := context.Background()
+	if _, err := s.Set(ctx, &pb.SetRequest{Group: "server-set-delete", Key: "key", Value: []byte("new")}); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := g.Get("key"); err != nil || v.String() != "new" {
+		t.Fatalf("get after Set = %q, %v", v.String(), err)
+	}
+	for _, want := range []bool{true, false} {
+		resp, err := s.Delete(ctx, &pb.DeleteRequest{Group: "server-set-delete", Key: "key"})
+		if err != nil || resp.Removed != want {
+			t.Fatalf("Delete = %v, %v, expect removed %v", resp.GetRemoved(), err, want)
+		}
+	}
+	if _, err := s.Set(ctx, &pb.SetRequest{Group: "no-such-group", Key: "key"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("code = %v, expect NotFound", status.Code(err))
+	}
+	if _, err := s.Delete(ctx, &pb.DeleteRequest{Group: "server-set-delete"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("code = %v, expect InvalidArgument", status.Code(err))
+	}
+}
+
+func TestGroupBloomFilter(t *testing.T) {
+	var loads atomic.Int64
+	db := map[string]string{"Tom": "90", "Jerry": "85"}
+	var dbMu sync.Mutex
+	loader := KeyLoader(func(add func(string)) error {
+		dbMu.Lock()
+		defer dbMu.Unlock()
+		for key := range db {
+			add(key)
+		}
+		return nil
+	})
+	g := NewGroup("bloom-filter", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		dbMu.Lock()
+		defer dbMu.Unlock()
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, ErrNotFound
+	}), WithBloomFilter(loader, 100, 0.001))
+
+	if v, err := g.Get("Tom"); err != nil || v.String() != "90" {
+		t.Fatalf("Tom = (%s, %v)", v, err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := g.Get(fmt.Sprintf("ghost%d", i)); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("ghost%d: err = %v, expect ErrNotFound", i, err)
+		}
+	}
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("retriever called %d times, non-existent keys should be filtered", n)
+	}
+
+	// Set 之后 key 不再被拦截
+	if err := g.Set("Spike", []byte("70")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := g.Get("Spike"); err != nil || v.String() != "70" {
+		t.Fatalf("Spike = (%s, %v)", v, err)
+	}
+
+	// 其他节点写入数据库的 key 在 Rebuild 之后可以读到
+	dbMu.Lock()
+	db["Tyke"] = "60"
+	dbMu.Unlock()
+	if _, err := g.Get("Tyke"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Tyke should be filtered before rebuild, err = %v", err)
+	}
+	if err := g.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := g.Get("Tyke"); err != nil || v.String() != "60" {
+		t.Fatalf("Tyke after rebuild = (%s, %v)", v, err)
+	}
+	if g.stats.filtered.Load() != 11 {
+		t.Fatalf("filtered = %d, expect 11", g.stats.filtered.Load())
+	}
+}
+
+func TestGroupWriteInvalidatesFlight(t *testing.T) {
+	var loads atomic.Int64
+	g := NewGroup("write-invalidates-flight", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte(strconv.FormatInt(loads.Add(1), 10)), nil
+	}), WithFlightCache(time.Minute, 2))
+
+	if v, err := g.Get("key"); err != nil || v.String() != "1" {
+		t.Fatalf("first get = (%s, %v)", v, err)
+	}
+	// Delete 同时删除 SingleFlight 缓存的结果，否则下一次回源仍然拿到 1
+	if !g.Delete("key") || g.Delete("key") {
+		t.Fatal("Delete should report whether the key was cached")
+	}
+	if v, err := g.Get("key"); err != nil || v.String() != "2" {
+		t.Fatalf("get after delete = (%s, %v), expect a fresh load", v, err)
+	}
+	if err := g.Set("key", []byte("set")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := g.Get("key"); err != nil || v.String() != "set" {
+		t.Fatalf("get after set = (%s, %v)", v, err)
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		g.Get(key)
+	}
+	if n := g.flight.Len(); n != 2 {
+		t.Fatalf("flight caches %d results, expect at most 2", n)
+	}
+}
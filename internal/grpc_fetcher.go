@@ -2,62 +2,182 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	pb "gocache/api/groupcachepb"
-	"gocache/discovery"
 	"gocache/utils/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"sync"
 	"time"
 )
 
-// 测试 Client 是否实现了 Fetcher 接口
-var _ Fetcher = (*Client)(nil)
+// 测试 Client 是否实现了 Fetcher 和 Leaser 接口
+var (
+	_ Fetcher = (*Client)(nil)
+	_ Leaser  = (*Client)(nil)
+)
 
-// Client 模块实现了groupcache访问其他远程节点以获取缓存的能力。
+/*
+Client 模块实现了groupcache访问其他远程节点以获取缓存的能力。
+  - 直接连接一致性哈希选出的节点地址，不经过服务发现的负载均衡，保证请求到达 key 的负责节点
+  - 连接在第一次调用时建立并复用，节点从哈希环上移除时由 Server 关闭
+*/
 type Client struct {
-	serviceName string // 服务名称 groupcache/ip:addr
+	addr        string // 远程节点地址 ip:port
+	dialOptions []grpc.DialOption
+	stats       peerStats
+
+	mu   sync.Mutex
+	conn *grpc.ClientConn
+}
+
+// NewClient 创建到 addr 的客户端，opts 追加在默认的连接选项之后
+func NewClient(addr string, opts ...grpc.DialOption) *Client {
+	return &Client{addr: addr, dialOptions: opts}
 }
 
-func NewClient(service string) *Client {
-	return &Client{service}
+func (c *Client) String() string {
+	return c.addr
+}
+
+// stub 返回复用的 gRPC 客户端，连接不存在时建立
+func (c *Client) stub() (pb.GroupCacheClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		opts := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, c.dialOptions...)
+		conn, err := grpc.NewClient(c.addr, opts...)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+	}
+	return pb.NewGroupCacheClient(c.conn), nil
+}
+
+// Close 关闭到远程节点的连接
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
 }
 
 /*
 Fetch 从gRPC服务中根据group和key获取数据
-  - 创建Etcd客户端
-  - 服务发现
-  - 创建gRPC客户端并设置超时
-  - 调用gRPC服务
+  - 获取到远程节点的连接并设置超时
+  - 创建客户端 span，trace 上下文写入 metadata 传给远程节点
+  - 调用gRPC服务，codes.NotFound 映射回 ErrNotFound
 */
-func (c *Client) Fetch(group string, key string) ([]byte, error) {
-	cli, err := clientv3.NewFromURL("http://localhost:2379")
+func (c *Client) Fetch(ctx context.Context, group string, key string) (value []byte, err error) {
+	ctx, span := tracer.Start(ctx, "GroupCache/Fetch", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("gocache.group", group),
+		attribute.String("gocache.key", key),
+		attribute.String("gocache.peer", c.addr),
+	))
+	defer func() { endSpan(span, err) }()
+
+	grpcClient, err := c.stub()
 	if err != nil {
 		return nil, err
 	}
-	defer cli.Close()
+	ctx, cancel := context.WithTimeout(injectTrace(ctx), time.Second*1)
+	defer cancel()
 
 	start := time.Now()
-	conn, err := discovery.Discovery(cli, c.serviceName)
-	logger.LogrusObj.Warnf("本次 grpc dial 的耗时为: %v ms", time.Since(start).Milliseconds())
+	resp, err := grpcClient.Get(ctx, &pb.GetRequest{
+		Group: group,
+		Key:   key,
+	})
+	latency := time.Since(start)
+	logger.SampledDebugf("本次 grpc Call 的耗时为: %v ms", latency.Milliseconds())
+
+	if status.Code(err) == codes.NotFound {
+		// 对端确认不存在是正常的应答，不计入失败
+		c.stats.observe(latency, nil)
+		err = fmt.Errorf("%w: %s/%s from peer %s", ErrNotFound, group, key, c.addr)
+	} else {
+		c.stats.observe(latency, err)
+		if err != nil {
+			err = fmt.Errorf("could not get %s/%s from peer %s: %w", group, key, c.addr, err)
+		}
+	}
+	observer().ObservePeerFetch(group, c.addr, latency, err)
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
 
-	grpcClient := pb.NewGroupCacheClient(conn)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
-	defer cancel()
+	return resp.Value, nil
+}
 
-	start = time.Now()
-	resp, err := grpcClient.Get(ctx, &pb.GetRequest{
+// Stats 返回访问该节点的统计信息
+func (c *Client) Stats() PeerStats {
+	return PeerStats{
+		Addr:         c.addr,
+		Fetches:      c.stats.fetches.Load(),
+		Errors:       c.stats.errors.Load(),
+		TotalLatency: time.Duration(c.stats.totalNanos.Load()),
+		MaxLatency:   time.Duration(c.stats.maxNanos.Load()),
+	}
+}
+
+// Lease 向负责节点申请回源租约，其他节点持有租约时阻塞到 ctx 结束
+func (c *Client) Lease(ctx context.Context, group string, key string) (LeaseResult, error) {
+	grpcClient, err := c.stub()
+	if err != nil {
+		return LeaseResult{}, err
+	}
+	resp, err := grpcClient.Lease(injectTrace(ctx), &pb.LeaseRequest{
 		Group: group,
 		Key:   key,
 	})
-	logger.LogrusObj.Warnf("本次 grpc Call 的耗时为: %v ms", time.Since(start).Milliseconds())
+	if status.Code(err) == codes.NotFound {
+		return LeaseResult{}, fmt.Errorf("%w: %s/%s from peer %s", ErrNotFound, group, key, c.addr)
+	}
+	if err != nil {
+		return LeaseResult{}, fmt.Errorf("could not lease %s/%s from peer %s: %w", group, key, c.addr, err)
+	}
+	return LeaseResult{
+		Granted: resp.Granted,
+		Token:   resp.Token,
+		Value:   resp.Value,
+		Failed:  resp.Failed,
+	}, nil
+}
 
+// Release 释放回源租约并把结果带回负责节点
+func (c *Client) Release(group string, key string, token string, value []byte, loadErr error) error {
+	grpcClient, err := c.stub()
 	if err != nil {
-		return nil, fmt.Errorf("could not get %s/%s from peer %s", group, key, c.serviceName)
+		return err
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+	defer cancel()
 
-	return resp.Value, nil
+	req := &pb.ReleaseRequest{
+		Group: group,
+		Key:   key,
+		Token: token,
+	}
+	switch {
+	case loadErr == nil:
+		req.Value = value
+	case errors.Is(loadErr, ErrNotFound):
+		req.NotFound = true
+	default:
+		req.Failed = true
+	}
+	if _, err := grpcClient.ReleaseLease(ctx, req); err != nil {
+		return fmt.Errorf("could not release %s/%s to peer %s: %w", group, key, c.addr, err)
+	}
+	return nil
 }
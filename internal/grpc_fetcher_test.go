@@ -0,0 +1,26 @@
+package service
+
+import "testing"
+
+func TestServerSetClients(t *testing.T) {
+	s := &Server{Addr: "10.0.0.1:9999"}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setClients([]string{"10.0.0.2:9999", "10.0.0.3:9999"})
+	kept, removed := s.clients["10.0.0.2:9999"], s.clients["10.0.0.3:9999"]
+	if _, err := removed.stub(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 仍在哈希环上的节点复用客户端，移除的节点关闭连接，新节点创建客户端
+	s.setClients([]string{"10.0.0.2:9999", "10.0.0.4:9999"})
+	if s.clients["10.0.0.2:9999"] != kept || s.clients["10.0.0.4:9999"] == nil || len(s.clients) != 2 {
+		t.Fatalf("clients = %v, expect 10.0.0.2 reused and 10.0.0.4 added", s.clients)
+	}
+	if removed.conn != nil {
+		t.Fatal("connection to a removed peer should be closed")
+	}
+	if c := s.clients["10.0.0.4:9999"]; c.String() != "10.0.0.4:9999" {
+		t.Fatalf("client addr = %s, expect the peer address", c)
+	}
+}
@@ -2,16 +2,20 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	pb "gocache/api/groupcachepb"
 	"gocache/discovery"
 	"gocache/utils/logger"
 	"gocache/utils/validate"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"net"
 	"strings"
 	"sync"
-	"time"
 )
 
 // 测试 Server 是否实现了 Picker 接口
@@ -37,16 +41,60 @@ type Server struct {
 	stopSignal chan error //通知register revoke服务
 	update     chan struct{}
 
-	mu       sync.Mutex
-	consHash *ConsistentHash
-	clients  map[string]*Client
+	mu          sync.Mutex
+	consHash    *ConsistentHash
+	clients     map[string]*Client
+	snapshotDir string       // Admin.Snapshot 写入快照的目录
+	grpcServer  *grpc.Server // Serve 期间的 gRPC 服务器，Stop 时关闭
+
+	groups      *GroupRegistry    // 提供服务的 group，nil 时使用全局的 GroupManager
+	discovery   Discovery         // nil 时使用 etcd
+	dialOptions []grpc.DialOption // 连接远程节点时追加的选项
+	admin       bool              // 是否注册 Admin 服务
+	adminToken  string            // 非空时 Admin 请求必须携带这个 token
+}
+
+// ServerOption Server 的可选配置
+type ServerOption func(*Server)
+
+// WithGroupRegistry 只在 r 中查找请求的 group，在一个进程中运行多个节点时使用
+func WithGroupRegistry(r *GroupRegistry) ServerOption {
+	return func(s *Server) {
+		s.groups = r
+	}
+}
+
+// WithDiscovery 使用 d 注册节点和获取节点列表，代替 etcd
+func WithDiscovery(d Discovery) ServerOption {
+	return func(s *Server) {
+		s.discovery = d
+	}
+}
+
+// WithDialOptions 连接远程节点时追加的 gRPC 选项，例如自定义的 dialer
+func WithDialOptions(opts ...grpc.DialOption) ServerOption {
+	return func(s *Server) {
+		s.dialOptions = opts
+	}
+}
+
+/*
+WithAdmin 在服务端口上注册 Admin 服务，默认不注册
+  - token 非空时 Admin 请求必须通过 AdminCredentials 携带相同的 token
+  - token 为空时任何能访问服务端口的客户端都可以清空缓存，只应在受信任的网络中使用
+*/
+func WithAdmin(token string) ServerOption {
+	return func(s *Server) {
+		s.admin = true
+		s.adminToken = token
+	}
 }
 
 /*
 	NewServer 将创建缓存服务器;如果addr为空，则使用默认的addr。
 */
 
-func NewServer(viewUpdate chan struct{}, addr string) (*Server, error) {
+func NewServer(viewUpdate chan struct{}, addr string, opts ...ServerOption) (*Server, error) {
 	if addr == "" {
 		addr = defaultBaseAddr
 	}
@@ -56,7 +104,37 @@ func NewServer(viewUpdate chan struct{}, addr string) (*Server, error) {
 		return nil, fmt.Errorf("expect address format is x.x.x.x:port, but got %s", addr)
 	}
 
-	return &Server{Addr: addr, update: viewUpdate}, nil
+	s := &Server{Addr: addr, update: viewUpdate}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// etcdDiscovery 通过 etcd 注册和发现节点
+type etcdDiscovery struct{}
+
+func (etcdDiscovery) Register(service string, addr string, stop chan error) error {
+	return discovery.Register(service, addr, stop)
+}
+
+func (etcdDiscovery) Peers(service string) ([]string, error) {
+	return discovery.ListServicePeers(service)
+}
+
+func (s *Server) registry() Discovery {
+	if s.discovery == nil {
+		return etcdDiscovery{}
+	}
+	return s.discovery
+}
+
+// group 返回本节点上名为 name 的 group，没有则返回 nil
+func (s *Server) group(name string) *Group {
+	if s.groups == nil {
+		return GetGroup(name)
+	}
+	return s.groups.Get(name)
 }
 
 /*
@@ -64,32 +142,273 @@ Get 处理来自客户端的 RPC 请求
   - 请求解析
   - 获取组实例
   - 从组中获取值，view, err := g.Get(key)
-  - 构建响应
+  - 构建响应，ErrNotFound 映射为 codes.NotFound，客户端据此区分不存在和服务故障
+  - 从 metadata 中恢复调用方的 trace 上下文，创建服务端 span
 */
-func (s *Server) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+func (s *Server) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.GetResponse, err error) {
 
 	group, key := req.GetGroup(), req.GetKey()
-	resp := &pb.GetResponse{}
-	logger.LogrusObj.Infof("[Groupcache server %s] Recv RPC Request - (%s)/(%s)", s.Addr, group, key)
+	ctx, span := tracer.Start(extractTrace(ctx), "GroupCache/Get", trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		attribute.String("gocache.group", group),
+		attribute.String("gocache.key", key),
+	))
+	defer func() { endSpan(span, err) }()
+
+	resp = &pb.GetResponse{}
+	logger.SampledDebugf("[Groupcache server %s] Recv RPC Request - (%s)/(%s)", s.Addr, group, key)
 
 	if key == "" || group == "" {
-		return resp, fmt.Errorf("key and group name is reqiured")
+		return resp, status.Error(codes.InvalidArgument, "key and group name is reqiured")
 	}
 
-	g := GetGroup(group)
+	g := s.group(group)
 	if g == nil {
+		// 不使用 codes.NotFound，避免对端把缺少 group 误认为 key 不存在
 		return resp, fmt.Errorf("group %s not found", group)
 	}
 
-	view, err := g.Get(key)
+	view, stale, err := g.get(ctx, key)
+	span.SetAttributes(attribute.Bool("gocache.stale", stale))
+	if errors.Is(err, ErrNotFound) {
+		return resp, status.Errorf(codes.NotFound, "%s/%s: %v", group, key, err)
+	}
 	if err != nil {
 		return resp, err
 	}
 
 	resp.Value = view.ByteSlice()
+	resp.Stale = stale
+	return resp, nil
+}
+
+/*
+Lease 处理其他节点的回源租约申请，本节点作为 key 的负责节点协调整个集群的回源
+  - 未开启租约的 group 总是发放租约，与开启前的行为一致
+  - 数据源中不存在时返回 codes.NotFound
+*/
+func (s *Server) Lease(ctx context.Context, req *pb.LeaseRequest) (*pb.LeaseResponse, error) {
+	group, key := req.GetGroup(), req.GetKey()
+	resp := &pb.LeaseResponse{}
+	if key == "" || group == "" {
+		return resp, status.Error(codes.InvalidArgument, "key and group name is reqiured")
+	}
+	g := s.group(group)
+	if g == nil {
+		return resp, fmt.Errorf("group %s not found", group)
+	}
+	if g.leases == nil {
+		resp.Granted = true
+		return resp, nil
+	}
+
+	res, err := g.leases.acquire(extractTrace(ctx), key)
+	if errors.Is(err, ErrNotFound) {
+		return resp, status.Errorf(codes.NotFound, "%s/%s: %v", group, key, err)
+	}
+	if err != nil {
+		return resp, status.FromContextError(err).Err()
+	}
+	resp.Granted, resp.Token, resp.Value, resp.Failed = res.Granted, res.Token, res.Value, res.Failed
+	return resp, nil
+}
+
+// ReleaseLease 处理租约持有者带回的回源结果，唤醒等待的节点
+func (s *Server) ReleaseLease(ctx context.Context, req *pb.ReleaseRequest) (*pb.ReleaseResponse, error) {
+	group, key := req.GetGroup(), req.GetKey()
+	resp := &pb.ReleaseResponse{}
+	if key == "" || group == "" {
+		return resp, status.Error(codes.InvalidArgument, "key and group name is reqiured")
+	}
+	g := s.group(group)
+	if g == nil {
+		return resp, fmt.Errorf("group %s not found", group)
+	}
+	if g.leases == nil {
+		return resp, nil
+	}
+
+	var err error
+	switch {
+	case req.GetNotFound():
+		err = ErrNotFound
+	case req.GetFailed():
+		err = errLoadFailed
+	}
+	g.leases.release(key, req.GetToken(), req.GetValue(), err)
 	return resp, nil
 }
 
+/*
+Stats 返回本节点上 group 的统计信息和访问各远程节点的耗时
+  - 请求中 group 为空时返回所有 group，按名称排序
+*/
+func (s *Server) Stats(ctx context.Context, req *pb.StatsRequest) (*pb.StatsResponse, error) {
+	resp := &pb.StatsResponse{}
+	groups, err := s.requestedGroups(req.GetGroup())
+	if err != nil {
+		return resp, err
+	}
+
+	for _, g := range groups {
+		st := g.Stats()
+		resp.Groups = append(resp.Groups, &pb.GroupStats{
+			Name:            g.name,
+			Gets:            st.Gets,
+			Hits:            st.Hits,
+			StaleHits:       st.StaleHits,
+			EarlyHits:       st.EarlyHits,
+			NegativeHits:    st.NegativeHits,
+			Misses:          st.Misses,
+			Filtered:        st.Filtered,
+			StaleOnError:    st.StaleOnError,
+			ReplicaHits:     st.ReplicaHits,
+			Replicated:      st.Replicated,
+			Loads:           st.Loads,
+			LoadNanos:       int64(st.LoadTime),
+			Dedupes:         st.Dedupes,
+			PeerLoads:       st.PeerLoads,
+			PeerErrors:      st.PeerErrors,
+			LocalLoads:      st.LocalLoads,
+			LocalLoadErrors: st.LocalLoadErrors,
+			LeaseWaits:      st.LeaseWaits,
+			Refreshes:       st.Refreshes,
+			RefreshSkipped:  st.RefreshSkipped,
+			Evictions:       st.Evictions,
+			Expirations:     st.Expirations,
+			Bytes:           st.Bytes,
+			Items:           st.Items,
+		})
+	}
+	for _, p := range s.PeerStats() {
+		resp.Peers = append(resp.Peers, &pb.PeerStats{
+			Addr:       p.Addr,
+			Fetches:    p.Fetches,
+			Errors:     p.Errors,
+			TotalNanos: int64(p.TotalLatency),
+			MaxNanos:   int64(p.MaxLatency),
+		})
+	}
+	return resp, nil
+}
+
+/*
+HotKeys 返回本节点上 group 访问最多的 key，计数只反映经过本节点的 Get
+  - 请求中 group 为空时返回所有 group，按名称排序；没有开启热点统计的 group 返回空列表
+*/
+func (s *Server) HotKeys(ctx context.Context, req *pb.HotKeysRequest) (*pb.HotKeysResponse, error) {
+	resp := &pb.HotKeysResponse{}
+	groups, err := s.requestedGroups(req.GetGroup())
+	if err != nil {
+		return resp, err
+	}
+	for _, g := range groups {
+		hot := &pb.GroupHotKeys{Name: g.name}
+		for _, k := range g.HotKeys(int(req.GetLimit())) {
+			hot.Keys = append(hot.Keys, &pb.HotKey{Key: k.Key, Count: k.Count})
+		}
+		resp.Groups = append(resp.Groups, hot)
+	}
+	return resp, nil
+}
+
+// defaultWatchBuffer Watch 请求未指定缓冲区大小时每个订阅缓冲的事件数
+const defaultWatchBuffer = 256
+
+/*
+Watch 以服务端流的形式推送本节点上 group 的变更事件，直到客户端取消或连接断开
+  - pb.EventType 与 EventType 的取值一一对应，请求中 types 为空时推送所有类型，包含未定义的类型时返回 InvalidArgument
+  - 客户端读取跟不上时事件被丢弃，每个事件携带累计丢弃数，增长时客户端应当重新同步
+*/
+func (s *Server) Watch(req *pb.WatchRequest, stream pb.GroupCache_WatchServer) error {
+	if req.GetGroup() == "" {
+		return status.Error(codes.InvalidArgument, "group name is required")
+	}
+	g := s.group(req.GetGroup())
+	if g == nil {
+		return status.Errorf(codes.NotFound, "group %s not found", req.GetGroup())
+	}
+	types := make([]EventType, 0, len(req.GetTypes()))
+	for _, t := range req.GetTypes() {
+		if !EventType(t).Valid() {
+			return status.Errorf(codes.InvalidArgument, "unknown event type %d", t)
+		}
+		types = append(types, EventType(t))
+	}
+	buffer := int(req.GetBuffer())
+	if buffer <= 0 {
+		buffer = defaultWatchBuffer
+	}
+
+	sub := g.Subscribe(buffer, types...)
+	defer sub.Close()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e := <-sub.C:
+			err := stream.Send(&pb.Event{
+				Group:     e.Group,
+				Key:       e.Key,
+				Type:      pb.EventType(e.Type),
+				Value:     e.Value.ByteSlice(),
+				UnixNanos: e.Time.UnixNano(),
+				Dropped:   sub.Dropped(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// requestedGroups 返回名为 name 的 group，name 为空时返回所有 group；group 不存在时返回 codes.NotFound
+func (s *Server) requestedGroups(name string) ([]*Group, error) {
+	if name == "" {
+		if s.groups != nil {
+			return s.groups.Groups(), nil
+		}
+		return Groups(), nil
+	}
+	g := s.group(name)
+	if g == nil {
+		return nil, status.Errorf(codes.NotFound, "group %s not found", name)
+	}
+	return []*Group{g}, nil
+}
+
+/*
+setClients 按新的节点列表更新客户端，调用方需持有 s.mu
+  - 仍在哈希环上的节点复用原来的客户端和连接
+  - 已经移除的节点关闭连接
+*/
+func (s *Server) setClients(peersAddr []string) {
+	clients := make(map[string]*Client, len(peersAddr))
+	joined, left := 0, 0
+	for _, addr := range peersAddr {
+		if c, ok := s.clients[addr]; ok {
+			clients[addr] = c
+		} else {
+			clients[addr] = NewClient(addr, s.dialOptions...)
+			joined++
+		}
+	}
+	for addr, c := range s.clients {
+		if _, ok := clients[addr]; !ok {
+			c.Close()
+			left++
+		}
+	}
+	s.clients = clients
+	observer().ObserveRing(len(clients), joined, left)
+}
+
+// NewPeerRing 按与 Server 相同的虚拟节点数构建哈希环，客户端据此把请求直接发给 key 的负责节点
+func NewPeerRing(peersAddr []string) *ConsistentHash {
+	ring := NewConsistentHash(defaultReplicas, nil)
+	ring.AddTruthNode(peersAddr)
+	return ring
+}
+
 /*
 SetPeers 将每个远程主机IP配置到服务器
   - 加锁并处理空的peer
@@ -103,49 +422,41 @@ func (s *Server) SetPeers(peersAddr []string) {
 		peersAddr = []string{s.Addr}
 	}
 
-	s.consHash = NewConsistentHash(defaultReplicas, nil) //新的哈希环
-	s.consHash.AddTruthNode(peersAddr)                   //添加对等节点（真实）
-
-	s.clients = make(map[string]*Client)
+	s.consHash = NewPeerRing(peersAddr) //新的哈希环，添加对等节点（真实）
 
 	for _, addr := range peersAddr {
 		if !validate.ValidPeerAddr(addr) {
 			s.mu.Unlock()
 			panic(fmt.Sprintf("[peer %s] invalid address format, it should be x.x.x.x:port", addr))
 		}
-		/*
-			GroupCache/localhost:9999
-			GroupCache/localhost:10000
-			GroupCache/localhost:10001
-			attention：服务发现原理建议看下 Endpoint 源码, key 是 service/addr value 是 addr
-			服务解析时按照 service 进行前缀查询，找到所有服务节点
-			而 clusters 前缀是为了拿到所有实例地址做一致性哈希使用的
-			注意 service 要和在 protocol 文件中定义的服务名称一致
-		*/
-
-		// 使用固定的服务名称“GroupCache”创建客户端
-		s.clients[addr] = NewClient(CacheServiceName)
 	}
-	s.mu.Unlock()
-
 	/*
-		<-s.update 重新构建服务器的一致性哈希环和客户端连接映射
-		<-s.stopSignal 停止服务
-		default:休眠2s
+		GroupCache/localhost:9999
+		GroupCache/localhost:10000
+		GroupCache/localhost:10001
+		attention：服务发现原理建议看下 Endpoint 源码, key 是 service/addr value 是 addr
+		clusters 前缀是为了拿到所有实例地址做一致性哈希使用的
+		客户端直接连接哈希环选出的节点地址，不再按服务名称负载均衡，否则请求可能落到任意节点上
 	*/
-	go func() {
-		for {
-			select {
-			case <-s.update:
-				s.reconstruct()
-			case <-s.stopSignal:
-
-				s.Stop()
-			default:
-				time.Sleep(time.Second * 2)
-			}
+	s.setClients(peersAddr)
+	s.mu.Unlock()
+
+}
+
+/*
+watchPeers 在服务期间处理节点列表的变化，直到 stop 关闭
+  - <-s.update 重新构建服务器的一致性哈希环和客户端连接映射
+  - <-stop 停止服务
+*/
+func (s *Server) watchPeers(stop chan error) {
+	for {
+		select {
+		case <-s.update:
+			s.reconstruct()
+		case <-stop:
+			return
 		}
-	}()
+	}
 }
 
 /*
@@ -155,26 +466,27 @@ reconstruct 重新构建服务器的一致性哈希环和客户端连接映射
   - 重新构建客户端映射连接
 */
 func (s *Server) reconstruct() {
-	serviceList, err := discovery.ListServicePeers(CacheServiceName)
+	serviceList, err := s.registry().Peers(CacheServiceName)
 	if err != nil { // 如果没有拿到服务实例列表，暂时先维持当前视图
 		return
 	}
 
 	s.mu.Lock()
+	if !s.Status { // 已经停止，不再建立连接
+		s.mu.Unlock()
+		return
+	}
 
-	s.consHash = NewConsistentHash(defaultReplicas, nil)
-	s.consHash.AddTruthNode(serviceList)
-	s.clients = make(map[string]*Client)
+	s.consHash = NewPeerRing(serviceList)
 
 	for _, peerAddr := range serviceList {
 		if !validate.ValidPeerAddr(peerAddr) {
 			panic(fmt.Sprintf("[peer %s] invalid address format, expect x.x.x.x:port", peerAddr))
 		}
-
-		// demo: GroupCache/127.0.0.1:9999
-		//地址有效，使用固定服务名称GroupCache和地址创建新的客户端实例，并添加到s.clients
-		s.clients[peerAddr] = NewClient(CacheServiceName)
 	}
+	// demo: GroupCache/127.0.0.1:9999
+	// 地址有效，复用仍在哈希环上的节点的客户端，为新节点创建客户端，关闭已移除节点的连接
+	s.setClients(serviceList)
 	s.mu.Unlock()
 	logger.LogrusObj.Infof("hash ring reconstruct, contain service peer %v", serviceList)
 
@@ -182,94 +494,118 @@ func (s *Server) reconstruct() {
 
 /*
 Pick 根据给定的键 key 从一致性哈希环中选择一个对等节点（peer）
+  - 还没有设置节点或者已经停止时总是选择自己
 */
 func (s *Server) Pick(key string) (Fetcher, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.consHash == nil {
+		return nil, false
+	}
 	// 获取对等节点地址
 	peerAddr := s.consHash.GetTruthNode(key)
 
 	if peerAddr == s.Addr || peerAddr == "" {
-		logger.LogrusObj.Infof("oohhh! pick myself, i am %s", s.Addr)
+		logger.SampledDebugf("oohhh! pick myself, i am %s", s.Addr)
 		return nil, false
 	}
-	logger.LogrusObj.Infof("[current peer %s] pick remote peer: %s", s.Addr, peerAddr)
+	logger.SampledDebugf("[current peer %s] pick remote peer: %s", s.Addr, peerAddr)
 	// 返回选定的对等节点的客户端实例
 	return s.clients[peerAddr], true
 }
 
+// Start 监听 Addr 的端口并调用 Serve，阻塞直到服务停止
+func (s *Server) Start() {
+	//监听端口
+	port := strings.Split(s.Addr, ":")[1]
+	lis, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		fmt.Printf("failed to listen %s, error: %v", s.Addr, err)
+		return
+	}
+	s.Serve(lis)
+}
+
 /*
-Start 启动服务器并处理相关的初始化任务
+Serve 在 lis 上启动服务器并处理相关的初始化任务，阻塞直到 Stop 或者注册失效
 
 	------------启动服务----------------
 	1.设置服务器运行状态
 	2.初始化停止通道以通知注册表停止保活租约
-	3.初始化tcp套接字并开始侦听
-	4.将自定义rpc服务注册到grpc，以便grpc可以将请求分发到服务器进行处理
-	5.使用etcd服务注册表，它可以通过服务名称，即grpc通道，直接获得与给定服务的客户端连接，然后创建一个客户端Stub，它实现与服务器相同的方法并直接调用它
+	3.将自定义rpc服务注册到grpc，以便grpc可以将请求分发到服务器进行处理
+	4.使用服务注册表（默认为 etcd）注册当前节点，注册失效时停止服务
+	5.处理节点列表的变化，重新构建哈希环
 */
-func (s *Server) Start() {
+func (s *Server) Serve(lis net.Listener) {
 	s.mu.Lock()
 	if s.Status == true {
 		s.mu.Unlock()
+		lis.Close()
 		fmt.Printf("server %s is already started", s.Addr)
 		return
 	}
 	s.Status = true
 	s.stopSignal = make(chan error)
 
-	//监听端口
-	port := strings.Split(s.Addr, ":")[1]
-	lis, err := net.Listen("tcp", ":"+port)
-	if err != nil {
-		fmt.Printf("failed to listen %s, error: %v", s.Addr, err)
-		return
-	}
-
 	//设置gRPC服务器
-	grpcServer := grpc.NewServer()
+	var opts []grpc.ServerOption
+	if s.admin && s.adminToken != "" {
+		opts = append(opts, AdminAuth(s.adminToken))
+	}
+	grpcServer := grpc.NewServer(opts...)
 	//将服务及其实现注册到实现GroupCacheServer接口的具体类型
 	pb.RegisterGroupCacheServer(grpcServer, s)
+	if s.admin {
+		pb.RegisterAdminServer(grpcServer, NewAdmin(s))
+	}
+	s.grpcServer = grpcServer
 	defer s.Stop()
 
 	//服务注册
-	go func() {
-		//注册当前服务器实例
-		err := discovery.Register(CacheServiceName, s.Addr, s.stopSignal)
-		if err != nil {
-			logger.LogrusObj.Error(err.Error())
-		}
-		close(s.stopSignal)
-		// 关闭tcp监听器
-		err = lis.Close()
+	go func(stop chan error) {
+		//注册当前服务器实例，返回时注销或者注册已经失效
+		err := s.registry().Register(CacheServiceName, s.Addr, stop)
 		if err != nil {
 			logger.LogrusObj.Error(err.Error())
 		}
+		s.Stop()
 		logger.LogrusObj.Warnf("[%s] Revoke service and close tcp socket", s.Addr)
-	}()
+	}(s.stopSignal)
+	go s.watchPeers(s.stopSignal)
 
 	//解锁 启动gRPC服务
 	//Serve接受侦听器列表上的传入连接，为每个连接创建一个新的服务器传输和服务Goroutine。
 	//服务goroutines读取gRPC请求，然后调用注册的处理程序来回复它们。
 	s.mu.Unlock()
-	if err := grpcServer.Serve(lis); s.Status && err != nil {
+	// Stop 之后 Serve 返回 nil；Stop 发生在 Serve 开始之前（例如注册立即失败）时返回 ErrServerStopped，同样是正常退出
+	if err := grpcServer.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
 		logger.LogrusObj.Fatalf("failed to serve %s, error: %v", s.Addr, err)
-		return
 	}
 }
+
+/*
+Stop 停止服务器
+  - 关闭停止通道，通知注册表注销节点、停止处理节点列表的变化
+  - 关闭到远程节点的连接，关闭 gRPC 服务器和所有连接
+*/
 func (s *Server) Stop() {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	if !s.Status {
+		s.mu.Unlock()
 		return
 	}
-
-	// 通知registry停止释放keepalive
-	s.stopSignal <- nil
-
 	s.Status = false
+	close(s.stopSignal)
 	//清理资源，释放内存，可以帮助GC
+	s.setClients(nil)
 	s.clients = nil
 	s.consHash = nil
+	grpcServer := s.grpcServer
+	s.grpcServer = nil
+	s.mu.Unlock()
+
+	// 正在处理的请求可能需要 s.mu，在锁外等待它们结束
+	if grpcServer != nil {
+		grpcServer.Stop()
+	}
 }
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"errors"
+	pb "gocache/api/groupcachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDiscovery 内存中的服务发现，Register 注册后阻塞到 stop 关闭
+type fakeDiscovery struct {
+	mu         sync.Mutex
+	peers      map[string]bool
+	registered chan string
+}
+
+func newFakeDiscovery(peers ...string) *fakeDiscovery {
+	d := &fakeDiscovery{peers: make(map[string]bool), registered: make(chan string, 1)}
+	for _, p := range peers {
+		d.peers[p] = true
+	}
+	return d
+}
+
+func (d *fakeDiscovery) Register(service string, addr string, stop chan error) error {
+	d.mu.Lock()
+	d.peers[addr] = true
+	d.mu.Unlock()
+	d.registered <- addr
+	<-stop
+	d.mu.Lock()
+	delete(d.peers, addr)
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *fakeDiscovery) Peers(service string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	peers := make([]string, 0, len(d.peers))
+	for p := range d.peers {
+		peers = append(peers, p)
+	}
+	sort.Strings(peers)
+	return peers, nil
+}
+
+func TestGroupRegistry(t *testing.T) {
+	retriever := RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	})
+	r := NewGroupRegistry()
+	b := r.NewGroup("registry-b", "lru", 0, retriever)
+	a := r.NewGroup("registry-a", "lru", 0, retriever)
+	if r.NewGroup("registry-b", "lru", 0, retriever) != b {
+		t.Fatal("NewGroup with an existing name should return the existing group")
+	}
+	if r.Get("registry-a") != a || r.Get("missing") != nil {
+		t.Fatal("Get should find groups created in the registry only")
+	}
+	if groups := r.Groups(); len(groups) != 2 || groups[0] != a || groups[1] != b {
+		t.Fatalf("Groups = %v, expect registry-a and registry-b", groups)
+	}
+	// 命名空间相互独立，不影响全局的 GroupManager
+	if GetGroup("registry-a") != nil {
+		t.Fatal("groups in a registry should not be visible globally")
+	}
+	if NewGroupRegistry().NewGroup("registry-a", "lru", 0, retriever) == a {
+		t.Fatal("registries should not share groups")
+	}
+}
+
+func TestServerGroupRegistry(t *testing.T) {
+	retriever := func(value string) Retriever {
+		return RetrieveFunc(func(key string) ([]byte, error) {
+			return []byte(value), nil
+		})
+	}
+	NewGroup("server-registry", "lru", 0, retriever("global"))
+	NewGroup("server-registry-global", "lru", 0, retriever("global"))
+	r := NewGroupRegistry()
+	r.NewGroup("server-registry", "lru", 0, retriever("local"))
+
+	s, err := NewServer(nil, "10.0.0.1:9999", WithGroupRegistry(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	resp, err := s.Get(ctx, &pb.GetRequest{Group: "server-registry", Key: "key"})
+	if err != nil || string(resp.Value) != "local" {
+		t.Fatalf("Get = %q, %v, expect the group in the registry", resp.GetValue(), err)
+	}
+	if _, err := s.Get(ctx, &pb.GetRequest{Group: "server-registry-global", Key: "key"}); err == nil {
+		t.Fatal("groups outside the registry should not be served")
+	}
+	if _, err := NewAdmin(s).Set(ctx, &pb.SetRequest{Group: "server-registry-global", Key: "key"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("code = %v, expect NotFound for groups outside the registry", status.Code(err))
+	}
+}
+
+// failingDiscovery 注册立即失败，Server 随即自行 Stop
+type failingDiscovery struct{}
+
+func (failingDiscovery) Register(service string, addr string, stop chan error) error {
+	return errors.New("register failed")
+}
+
+func (failingDiscovery) Peers(service string) ([]string, error) {
+	return nil, errors.New("no peers")
+}
+
+func TestServerStopBeforeServe(t *testing.T) {
+	// 注册失败触发的 Stop 与 gRPC 服务器开始 Serve 同时发生，无论哪个先执行 Serve 都应当正常返回而不是退出进程
+	for i := 0; i < 50; i++ {
+		s, err := NewServer(make(chan struct{}), "10.0.0.1:9999", WithGroupRegistry(NewGroupRegistry()), WithDiscovery(failingDiscovery{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan struct{})
+		go func() {
+			s.Serve(bufconn.Listen(1 << 10))
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second * 3):
+			t.Fatal("Serve did not return after registration failed")
+		}
+	}
+}
+
+func TestServerServeWithDiscovery(t *testing.T) {
+	const addr, peer = "10.0.0.1:9999", "10.0.0.2:9999"
+	r := NewGroupRegistry()
+	r.NewGroup("server-serve", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte("value-" + key), nil
+	}))
+	d := newFakeDiscovery(peer)
+	update := make(chan struct{}, 1)
+	lis := bufconn.Listen(1 << 20)
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}
+	s, err := NewServer(update, addr, WithGroupRegistry(r), WithDiscovery(d), WithDialOptions(grpc.WithContextDialer(dialer)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Serve(lis)
+		close(done)
+	}()
+	select {
+	case got := <-d.registered:
+		if got != addr {
+			t.Fatalf("registered %s, expect %s", got, addr)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("server never registered")
+	}
+
+	// 节点列表变化时从 Discovery 读取并重建哈希环
+	update <- struct{}{}
+	deadline := time.Now().Add(time.Second * 3)
+	for len(s.Ring()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("ring = %v, expect %s and %s", s.Ring(), addr, peer)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// 通过 bufconn 访问 Serve 的监听器
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithContextDialer(dialer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	resp, err := pb.NewGroupCacheClient(conn).Get(ctx, &pb.GetRequest{Group: "server-serve", Key: "key"})
+	if err != nil || string(resp.Value) != "value-key" {
+		t.Fatalf("Get = %q, %v", resp.GetValue(), err)
+	}
+
+	// Stop 之后 Serve 返回，节点从 Discovery 注销
+	s.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 3):
+		t.Fatal("Serve did not return after Stop")
+	}
+	deadline = time.Now().Add(time.Second * 3)
+	for peers, _ := d.Peers(CacheServiceName); len(peers) != 1; peers, _ = d.Peers(CacheServiceName) {
+		if time.Now().After(deadline) {
+			t.Fatalf("peers = %v after Stop, expect only %s", peers, peer)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// serveAdmin 通过 bufconn 启动带有 opts 的 Server，返回到它的 Admin 客户端
+func serveAdmin(t *testing.T, addr string, opts ...ServerOption) pb.AdminClient {
+	lis := bufconn.Listen(1 << 20)
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}
+	d := newFakeDiscovery()
+	opts = append(opts, WithGroupRegistry(NewGroupRegistry()), WithDiscovery(d))
+	s, err := NewServer(make(chan struct{}), addr, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		s.Serve(lis)
+		close(done)
+	}()
+	<-d.registered
+	t.Cleanup(func() {
+		s.Stop()
+		<-done
+	})
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithContextDialer(dialer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewAdminClient(conn)
+}
+
+func TestServerAdminOptIn(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	// 默认不注册 Admin 服务
+	admin := serveAdmin(t, "10.0.0.1:9999")
+	if _, err := admin.Ring(ctx, &pb.RingRequest{}); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("code = %v, expect Unimplemented without WithAdmin", status.Code(err))
+	}
+	if _, err := admin.Set(ctx, &pb.SetRequest{Group: "g", Key: "k"}); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("code = %v, expect writes disabled without WithAdmin", status.Code(err))
+	}
+
+	admin = serveAdmin(t, "10.0.0.2:9999", WithAdmin(""))
+	if _, err := admin.Ring(ctx, &pb.RingRequest{}); err != nil {
+		t.Fatalf("Ring = %v, WithAdmin without a token should not require one", err)
+	}
+
+	// 配置 token 后必须携带相同的 token
+	admin = serveAdmin(t, "10.0.0.3:9999", WithAdmin("secret"))
+	if _, err := admin.Ring(ctx, &pb.RingRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("code = %v, expect Unauthenticated without a token", status.Code(err))
+	}
+	for token, code := range map[string]codes.Code{"wrong": codes.Unauthenticated, "secret": codes.OK} {
+		resp, err := admin.Ring(ctx, &pb.RingRequest{}, grpc.PerRPCCredentials(adminCredentials(token)))
+		if status.Code(err) != code {
+			t.Fatalf("Ring with token %q: %v, expect %v", token, err, code)
+		}
+		if err == nil && resp.Self != "10.0.0.3:9999" {
+			t.Fatalf("Ring = %v", resp)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package service
+
+import (
+	"container/heap"
+	"hash/maphash"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	sketchDepth    = 4
+	sketchMinWidth = 1024
+	hotKeyShards   = 16 // 按 key 分片，不同 key 的访问落在不同的锁上
+	hotKeySample   = 8  // 分片锁被占用时只有 1/hotKeySample 的访问等待锁，并按 hotKeySample 次计数
+)
+
+// HotKey 热点 key 及其访问次数的估计值，估计值随时间衰减，只用于比较热度
+type HotKey struct {
+	Key   string
+	Count int64
+}
+
+/*
+hotKeys 流式 top-K 热点 key 统计，每个 Group 一个
+  - count-min sketch 估计每个 key 的访问次数，内存与 key 的数量无关，估计值只会偏大
+  - 小顶堆保留估计值最大的 k 个 key，新 key 的估计值超过堆顶时替换堆顶
+  - 每隔 decay 把 sketch 和堆中的计数减半，热点随流量变化，不再访问的 key 逐渐被新的热点挤出
+  - key 按哈希分到 hotKeyShards 个分片，每个分片有自己的锁、sketch 和 top-K，全局 top-K 一定在各分片的 top-K 中
+  - 每次 Get 都会调用 touch，分片锁被占用时按 1/hotKeySample 采样，计数的期望不变，单个热点 key 也不会让所有读取排队
+  - nil 的 hotKeys 上所有方法都是空操作
+*/
+type hotKeys struct {
+	k      int
+	seed   maphash.Seed
+	shards [hotKeyShards]hotShard
+}
+
+// hotShard hotKeys 的一个分片
+type hotShard struct {
+	mu        sync.Mutex
+	k         int
+	decay     time.Duration
+	lastDecay time.Time
+	sketch    *countMinSketch
+	top       hotHeap
+	index     map[string]*hotEntry
+}
+
+// newHotKeys k <= 0 时返回 nil，decay <= 0 时不衰减
+func newHotKeys(k int, decay time.Duration) *hotKeys {
+	if k <= 0 {
+		return nil
+	}
+	h := &hotKeys{k: k, seed: maphash.MakeSeed()}
+	// 每个分片只统计 1/hotKeyShards 的 key，sketch 的宽度相应缩小，总内存和冲突率与不分片时相同
+	width := max(sketchMinWidth, k*64) / hotKeyShards
+	now := time.Now()
+	for i := range h.shards {
+		h.shards[i] = hotShard{
+			k:         k,
+			decay:     decay,
+			lastDecay: now,
+			sketch:    newCountMinSketch(width, sketchDepth),
+			index:     make(map[string]*hotEntry),
+		}
+	}
+	return h
+}
+
+// shard 返回 key 所在的分片
+func (h *hotKeys) shard(key string) *hotShard {
+	return &h.shards[maphash.String(h.seed, key)%hotKeyShards]
+}
+
+// touch 记录一次访问
+func (h *hotKeys) touch(key string) {
+	if h == nil {
+		return
+	}
+	s := h.shard(key)
+	weight := uint32(1)
+	if !s.mu.TryLock() {
+		if rand.Uint32N(hotKeySample) != 0 {
+			return
+		}
+		weight = hotKeySample
+		s.mu.Lock()
+	}
+	defer s.mu.Unlock()
+	s.add(key, weight)
+}
+
+// add 把 key 的访问计数增加 weight 并更新 top-K，调用方需持有 s.mu
+func (s *hotShard) add(key string, weight uint32) {
+	s.age(time.Now())
+	count := s.sketch.add(key, weight)
+	if e, ok := s.index[key]; ok {
+		e.count = count
+		heap.Fix(&s.top, e.index)
+		return
+	}
+	if len(s.top) < s.k {
+		e := &hotEntry{key: key, count: count}
+		heap.Push(&s.top, e)
+		s.index[key] = e
+		return
+	}
+	if coldest := s.top[0]; count > coldest.count {
+		delete(s.index, coldest.key)
+		coldest.key, coldest.count = key, count
+		s.index[key] = coldest
+		heap.Fix(&s.top, 0)
+	}
+}
+
+// age 按经过的 decay 周期数把所有计数减半，调用方需持有 s.mu
+func (s *hotShard) age(now time.Time) {
+	if s.decay <= 0 {
+		return
+	}
+	periods := int(now.Sub(s.lastDecay) / s.decay)
+	if periods <= 0 {
+		return
+	}
+	s.lastDecay = s.lastDecay.Add(time.Duration(periods) * s.decay)
+	shift := uint(min(periods, 32))
+	s.sketch.halve(shift)
+	for _, e := range s.top {
+		e.count >>= shift
+	}
+	// 衰减不改变相对大小，堆的顺序仍然有效
+}
+
+// count 返回 key 在分片 top-K 中的估计值，不在 top-K 中时返回 false
+func (s *hotShard) count(key string) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.age(time.Now())
+	e, ok := s.index[key]
+	if !ok {
+		return 0, false
+	}
+	return e.count, true
+}
+
+// entries 返回分片 top-K 中计数大于 0 的 key
+func (s *hotShard) entries(keys []HotKey) []HotKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.age(time.Now())
+	for _, e := range s.top {
+		if e.count > 0 {
+			keys = append(keys, HotKey{Key: e.key, Count: e.count})
+		}
+	}
+	return keys
+}
+
+/*
+hot 判断 key 是否在全局 top-K 中且估计值不少于 minCount
+  - 只在从负责节点取回值之后调用，可以逐个查看所有分片：计数超过 key 的条目少于 k 个时 key 在全局 top-K 中
+*/
+func (h *hotKeys) hot(key string, minCount int64) bool {
+	if h == nil {
+		return false
+	}
+	s := h.shard(key)
+	count, ok := s.count(key)
+	if !ok || count < minCount {
+		return false
+	}
+	hotter := 0
+	for i := range h.shards {
+		other := &h.shards[i]
+		other.mu.Lock()
+		for _, e := range other.top {
+			if e.count > count {
+				hotter++
+			}
+		}
+		other.mu.Unlock()
+	}
+	return hotter < h.k
+}
+
+// list 返回访问次数最多的 n 个 key，按估计值从大到小排列；n <= 0 时返回全部 k 个
+func (h *hotKeys) list(n int) []HotKey {
+	if h == nil {
+		return nil
+	}
+	var keys []HotKey
+	for i := range h.shards {
+		keys = h.shards[i].entries(keys)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Count != keys[j].Count {
+			return keys[i].Count > keys[j].Count
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	if n <= 0 || n > h.k {
+		n = h.k
+	}
+	if n < len(keys) {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// hotEntry 堆中的一个 key，index 为其在堆中的下标
+type hotEntry struct {
+	key   string
+	count int64
+	index int
+}
+
+// hotHeap 按 count 排列的小顶堆，实现 heap.Interface
+type hotHeap []*hotEntry
+
+func (h hotHeap) Len() int           { return len(h) }
+func (h hotHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h hotHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *hotHeap) Push(x any) {
+	e := x.(*hotEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *hotHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+/*
+countMinSketch depth 行、每行 width 个计数器，每行使用不同种子的哈希
+  - add 把 key 在每一行对应的计数器加上 weight，返回其中的最小值作为估计值
+  - 冲突只会让估计值偏大，width 越大偏差越小
+*/
+type countMinSketch struct {
+	width uint64
+	seeds []maphash.Seed
+	rows  [][]uint32
+}
+
+func newCountMinSketch(width int, depth int) *countMinSketch {
+	s := &countMinSketch{
+		width: uint64(width),
+		seeds: make([]maphash.Seed, depth),
+		rows:  make([][]uint32, depth),
+	}
+	for i := range s.rows {
+		s.seeds[i] = maphash.MakeSeed()
+		s.rows[i] = make([]uint32, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) add(key string, weight uint32) int64 {
+	estimate := uint32(math.MaxUint32)
+	for i, row := range s.rows {
+		c := &row[maphash.String(s.seeds[i], key)%s.width]
+		*c += min(weight, math.MaxUint32-*c)
+		estimate = min(estimate, *c)
+	}
+	return int64(estimate)
+}
+
+// halve 把所有计数器右移 shift 位
+func (s *countMinSketch) halve(shift uint) {
+	for _, row := range s.rows {
+		for i := range row {
+			row[i] >>= shift
+		}
+	}
+}
+
+// newReplicaCache 创建热点 key 副本使用的 LRU 缓存，未开启复制时返回 nil
+func newReplicaCache(o groupOptions) *cache {
+	if o.replicaBytes <= 0 || o.replicaTTL <= 0 {
+		return nil
+	}
+	// 副本只按较短的 TTL 过期，不需要软 TTL 和宽限期
+	ro := o
+	ro.maxEntries, ro.softTTL, ro.grace = 0, 0, 0
+	if o.ttl <= 0 || o.replicaTTL < o.ttl {
+		ro.ttl = o.replicaTTL
+	}
+	return newCache("lru", o.replicaBytes, ro)
+}
+
+// replicate 从负责节点取回的值是热点时写入本地副本
+func (g *Group) replicate(key string, value ByteView) {
+	if g.replicas == nil || !g.hotKeys.hot(key, g.replicaMinCount) {
+		return
+	}
+	g.replicas.add(key, value)
+	g.stats.replicated.Add(1)
+}
+
+// HotKeys 返回访问最多的 n 个 key，按估计的访问次数从大到小排列；n <= 0 时返回全部，未开启统计时返回 nil
+func (g *Group) HotKeys(n int) []HotKey {
+	return g.hotKeys.list(n)
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	pb "gocache/api/groupcachepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHotKeysTopK(t *testing.T) {
+	h := newHotKeys(3, 0)
+	for i := 0; i < 200; i++ {
+		h.touch("cold-" + strconv.Itoa(i))
+		if i%2 == 0 {
+			h.touch("a")
+		}
+		if i%4 == 0 {
+			h.touch("b")
+		}
+		if i%10 == 0 {
+			h.touch("c")
+		}
+	}
+	keys := h.list(0)
+	if len(keys) != 3 {
+		t.Fatalf("got %v, expect 3 keys", keys)
+	}
+	for i, want := range []struct {
+		key   string
+		count int64
+	}{{"a", 100}, {"b", 50}, {"c", 20}} {
+		// count-min sketch 的估计值只会偏大
+		if keys[i].Key != want.key || keys[i].Count < want.count {
+			t.Fatalf("keys[%d] = %v, expect %s with count >= %d", i, keys[i], want.key, want.count)
+		}
+	}
+	if got := h.list(1); len(got) != 1 || got[0].Key != "a" {
+		t.Fatalf("list(1) = %v, expect [a]", got)
+	}
+	if !h.hot("a", 100) || h.hot("a", 1000) || h.hot("cold-1", 1) {
+		t.Fatal("hot should require the key in top-K with enough gets")
+	}
+}
+
+func TestHotKeysDecay(t *testing.T) {
+	h := newHotKeys(2, time.Minute)
+	for i := 0; i < 8; i++ {
+		h.touch("old")
+	}
+	for i := range h.shards {
+		s := &h.shards[i]
+		s.mu.Lock()
+		s.age(s.lastDecay.Add(2 * time.Minute))
+		s.mu.Unlock()
+	}
+	if keys := h.list(0); len(keys) != 1 || keys[0].Count != 2 {
+		t.Fatalf("got %v, expect old counted 8 >> 2 = 2", keys)
+	}
+
+	// 新的热点超过衰减后的旧热点，旧热点被挤出
+	for i := 0; i < 3; i++ {
+		h.touch("new")
+		h.touch("newer")
+	}
+	keys := h.list(0)
+	if len(keys) != 2 || keys[0].Key == "old" || keys[1].Key == "old" {
+		t.Fatalf("got %v, expect old evicted by new hot keys", keys)
+	}
+}
+
+func TestHotKeysConcurrentTouch(t *testing.T) {
+	h := newHotKeys(4, 0)
+	const workers, touches = 8, 20000
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < touches; i++ {
+				h.touch("hot")
+				if i%4 == 0 {
+					h.touch("cold-" + strconv.Itoa(w) + "-" + strconv.Itoa(i))
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// 锁被占用时按权重采样，估计值的期望仍然是真实的访问次数
+	keys := h.list(1)
+	if len(keys) != 1 || keys[0].Key != "hot" {
+		t.Fatalf("list(1) = %v, expect hot", keys)
+	}
+	if total := int64(workers * touches); keys[0].Count < total/2 || keys[0].Count > total*3/2 {
+		t.Fatalf("hot counted %d, expect about %d", keys[0].Count, total)
+	}
+	if !h.hot("hot", 1) {
+		t.Fatal("hot should be in the top-K")
+	}
+}
+
+// countingPeer 总是返回同一个值的负责节点，记录 Fetch 的次数
+type countingPeer struct {
+	fetches atomic.Int64
+}
+
+func (p *countingPeer) Pick(key string) (Fetcher, bool) {
+	return p, true
+}
+
+func (p *countingPeer) Fetch(ctx context.Context, group string, key string) ([]byte, error) {
+	p.fetches.Add(1)
+	return []byte("value"), nil
+}
+
+func TestGroupHotKeyReplication(t *testing.T) {
+	g := NewGroup("hot-key-replication", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		t.Fatal("keys owned by the peer should not be retrieved locally")
+		return nil, nil
+	}), WithFlightCache(0, 0), WithHotKeyReplication(3, 1<<20, time.Minute))
+	peer := &countingPeer{}
+	g.RegisterServer(peer)
+
+	// 前两次访问还不是热点，第三次从负责节点取回后复制到本地
+	for i := 0; i < 5; i++ {
+		if view, err := g.Get("hot"); err != nil || view.String() != "value" {
+			t.Fatalf("Get = %q, %v", view.String(), err)
+		}
+	}
+	if n := peer.fetches.Load(); n != 3 {
+		t.Fatalf("fetched %d times, expect 3", n)
+	}
+	st := g.Stats()
+	if st.Replicated != 1 || st.ReplicaHits != 2 || st.Hits != 2 {
+		t.Fatalf("stats = %+v, expect 1 replicated and 2 replica hits", st)
+	}
+	s := &Server{Addr: "localhost:9999"}
+	resp, err := s.HotKeys(context.Background(), &pb.HotKeysRequest{Group: "hot-key-replication", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Groups) != 1 || len(resp.Groups[0].Keys) != 1 || resp.Groups[0].Keys[0].Key != "hot" || resp.Groups[0].Keys[0].Count < 5 {
+		t.Fatalf("HotKeys = %v, expect hot with count >= 5", resp)
+	}
+	if _, err := s.HotKeys(context.Background(), &pb.HotKeysRequest{Group: "no-such-group"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("code = %v, expect NotFound", status.Code(err))
+	}
+
+	if !g.Delete("hot") {
+		t.Fatal("Delete should remove the replica")
+	}
+	g.Get("hot")
+	if n := peer.fetches.Load(); n != 4 {
+		t.Fatalf("fetched %d times after Delete, expect 4", n)
+	}
+}
+
+/*
+BenchmarkGroupGetHotKeys 并发读取已经缓存的 key，对比开启和关闭热点统计时 Get 的开销
+  - 1/8 的 key 承担一半的读取，接近有热点的真实流量
+*/
+func BenchmarkGroupGetHotKeys(b *testing.B) {
+	const n = 4096
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+	for _, bc := range []struct {
+		name string
+		opts []GroupOption
+	}{
+		{"off", nil},
+		{"on", []GroupOption{WithHotKeys(100, time.Minute)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			g := NewGroup("bench-hot-keys-"+bc.name, "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+				return []byte("value"), nil
+			}), bc.opts...)
+			for _, key := range keys {
+				g.Get(key)
+			}
+			var seq atomic.Uint64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := seq.Add(1) * 7919
+				for pb.Next() {
+					i = i*6364136223846793005 + 1442695040888963407
+					idx := int(i>>33) % n
+					if i&(1<<20) != 0 {
+						idx %= n / 8
+					}
+					if _, err := g.Get(keys[idx]); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkHotKeysTouch 并发记录访问，衡量热点统计本身在多核下的开销
+func BenchmarkHotKeysTouch(b *testing.B) {
+	const n = 4096
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+	h := newHotKeys(100, time.Minute)
+	var seq atomic.Uint64
+	b.RunParallel(func(pb *testing.PB) {
+		i := seq.Add(1) * 7919
+		for pb.Next() {
+			i = i*6364136223846793005 + 1442695040888963407
+			h.touch(keys[int(i>>33)%n])
+		}
+	})
+}
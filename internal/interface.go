@@ -1,5 +1,30 @@
 package service
 
+import (
+	"context"
+	"errors"
+)
+
+/*
+ErrNotFound 数据源中不存在该 key
+  - Retriever 查询不到数据时应当返回（或包装）该错误，Group 会为其写入负缓存，防止缓存穿透
+  - 跨节点传输时映射为 gRPC 的 codes.NotFound，对端 Client 再映射回该错误
+*/
+var ErrNotFound = errors.New("record not found")
+
+var errRebuilding = errors.New("bloom filter is being rebuilt")
+
+var (
+	errLeaseExpired = errors.New("load lease expired")
+	errLoadFailed   = errors.New("load failed on the lease holder")
+)
+
+/*
+KeyLoader 批量加载数据源中已经存在的所有 key，用于构建布隆过滤器
+  - 每个 key 调用一次 add，返回错误时本次构建失败，过滤器保持原状
+*/
+type KeyLoader func(add func(key string)) error
+
 /*
 Picker 负责查找密钥的查询请求应发送到哪个节点。（使用一致的哈希算法）
 */
@@ -7,12 +32,47 @@ type Picker interface {
 	Pick(key string) (Fetcher, bool)
 }
 
+/*
+Discovery 节点的注册与发现，Server 默认使用 etcd，见 WithDiscovery
+  - Register 注册节点并保持注册，stop 关闭时注销并返回 nil，注册失效时返回错误
+  - Peers 返回 service 下所有节点的地址
+*/
+type Discovery interface {
+	Register(service string, addr string, stop chan error) error
+	Peers(service string) ([]string, error)
+}
+
 /*
 Fetcher 负责查询指定组缓存中键的值。
 每个分布式kv节点都应该实现这个接口。
 */
 type Fetcher interface {
-	Fetch(group string, key string) ([]byte, error)
+	Fetch(ctx context.Context, group string, key string) ([]byte, error)
+}
+
+/*
+Leaser 负责节点上的回源租约，同一时刻只允许一个节点为同一个 key 查询数据源，见 WithLoadLease
+  - Lease 申请租约，获得租约时调用方查询数据源，之后必须调用 Release 带回结果
+  - 其他节点持有租约时 Lease 阻塞等待，直接返回持有者加载的结果
+  - 数据源中不存在时返回 ErrNotFound
+*/
+type Leaser interface {
+	Lease(ctx context.Context, group string, key string) (LeaseResult, error)
+	Release(group string, key string, token string, value []byte, loadErr error) error
+}
+
+/*
+LeaseResult 申请租约的结果
+  - Granted 为 true 时调用方获得租约，Token 用于释放
+  - 否则 Value 为负责节点缓存的值或者上一个持有者加载的值，Failed 表示上一个持有者回源失败
+  - Cached 表示 Value 来自本节点作为负责节点的缓存，只在本地申请时设置，不通过 RPC 传递
+*/
+type LeaseResult struct {
+	Granted bool
+	Token   string
+	Value   []byte
+	Failed  bool
+	Cached  bool
 }
 
 /*
@@ -40,3 +100,34 @@ RetrieveFunc 实现了 retrieve 方法，即实现 Retriever 接口，使任何
 func (f RetrieveFunc) retrieve(key string) ([]byte, error) {
 	return f(key)
 }
+
+/*
+BatchRetriever 一次从数据源批量检索多个 key，配合 WithBatching 把短时间内的多次未命中合并为一次查询
+  - 返回的 map 中不存在的 key 视为 ErrNotFound
+  - 返回错误时本批次所有 key 都失败
+*/
+type BatchRetriever interface {
+	RetrieveMany(ctx context.Context, keys []string) (map[string][]byte, error)
+}
+
+/*
+RetrieveManyFunc 与 RetrieveFunc 一样是适配器，把批量查询函数适配为 BatchRetriever，
+同时实现 Retriever，未开启批量时逐个 key 调用。
+*/
+type RetrieveManyFunc func(ctx context.Context, keys []string) (map[string][]byte, error)
+
+func (f RetrieveManyFunc) RetrieveMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	return f(ctx, keys)
+}
+
+func (f RetrieveManyFunc) retrieve(key string) ([]byte, error) {
+	values, err := f(context.Background(), []string{key})
+	if err != nil {
+		return nil, err
+	}
+	value, ok := values[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
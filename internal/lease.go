@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"gocache/internal/timingwheel"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+leaseTable 负责节点上的回源租约表，每个 Group 一个
+  - 同一个 key 同时只发放一个租约，持有者查询数据源后释放租约并带回结果
+  - 租约期间的其他申请阻塞等待，租约释放后直接拿到结果，不再查询数据源
+  - 持有者在 ttl 内没有释放（宕机、超时）时租约过期，等待者重新申请，其中一个获得租约
+  - 负责节点上已经缓存的值直接返回，不发放租约
+*/
+type leaseTable struct {
+	group *Group
+	ttl   time.Duration
+	wheel *timingwheel.TimingWheel
+
+	mu     sync.Mutex
+	seq    uint64
+	leases map[string]*lease
+}
+
+// lease 已经发放的租约，done 关闭后 value、err 为持有者带回的结果
+type lease struct {
+	token string
+	done  chan struct{}
+	value []byte
+	err   error
+	timer *timingwheel.Timer
+}
+
+// newLeaseTable 未设置租约时间时返回 nil，表示不在集群范围内合并回源
+func newLeaseTable(g *Group, ttl time.Duration, wheel *timingwheel.TimingWheel) *leaseTable {
+	if ttl <= 0 {
+		return nil
+	}
+	return &leaseTable{
+		group:  g,
+		ttl:    ttl,
+		wheel:  wheel,
+		leases: make(map[string]*lease),
+	}
+}
+
+/*
+acquire 申请 key 的租约
+  - 已经缓存的值（包括负缓存）直接返回
+  - 没有租约时发放新的租约
+  - 已有租约时等待其释放，持有者回源失败时返回 Failed，租约过期时重新申请
+*/
+func (t *leaseTable) acquire(ctx context.Context, key string) (LeaseResult, error) {
+	for {
+		if it, ok := t.group.mainCache.lookup(key); ok && !it.expired() {
+			if it.negative {
+				return LeaseResult{}, ErrNotFound
+			}
+			return LeaseResult{Value: it.view.ByteSlice(), Cached: true}, nil
+		}
+
+		t.mu.Lock()
+		l, ok := t.leases[key]
+		if !ok {
+			t.seq++
+			l = &lease{token: strconv.FormatUint(t.seq, 10), done: make(chan struct{})}
+			t.leases[key] = l
+			token := l.token
+			l.timer = t.wheel.AfterFunc(t.ttl, func() {
+				t.finish(key, token, nil, errLeaseExpired)
+			})
+			t.mu.Unlock()
+			return LeaseResult{Granted: true, Token: token}, nil
+		}
+		t.mu.Unlock()
+
+		select {
+		case <-l.done:
+		case <-ctx.Done():
+			return LeaseResult{}, ctx.Err()
+		}
+		switch {
+		case l.err == nil:
+			return LeaseResult{Value: l.value}, nil
+		case errors.Is(l.err, ErrNotFound):
+			return LeaseResult{}, ErrNotFound
+		case !errors.Is(l.err, errLeaseExpired):
+			return LeaseResult{Failed: true}, nil
+		}
+	}
+}
+
+// finish 释放租约并唤醒等待者，token 不匹配（租约已经过期并重新发放）时返回 false
+func (t *leaseTable) finish(key string, token string, value []byte, err error) bool {
+	t.mu.Lock()
+	l, ok := t.leases[key]
+	if !ok || l.token != token {
+		t.mu.Unlock()
+		return false
+	}
+	delete(t.leases, key)
+	t.mu.Unlock()
+
+	l.timer.Stop()
+	l.value, l.err = value, err
+	close(l.done)
+	return true
+}
+
+/*
+release 远程持有者释放租约
+  - 加载成功的值写入负责节点的缓存，之后的 Fetch 直接命中，并发布 EventLoadedFromPeer 事件
+  - 数据源中不存在时写入负缓存
+*/
+func (t *leaseTable) release(key string, token string, value []byte, err error) {
+	if !t.finish(key, token, value, err) {
+		return
+	}
+	g := t.group
+	switch {
+	case err == nil:
+		view := ByteView{b: cloneBytes(value)}
+		g.populateCache(key, view)
+		g.events.publish(EventLoadedFromPeer, key, view)
+	case errors.Is(err, ErrNotFound) && g.negativeTTL > 0:
+		g.mainCache.addNegative(key, g.negativeTTL)
+	}
+}
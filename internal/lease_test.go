@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ownerPeer 在进程内模拟负责节点：Get 总是失败，迫使调用方回源，租约请求直接交给负责节点的租约表
+type ownerPeer struct {
+	owner *Group
+}
+
+func (p ownerPeer) Pick(key string) (Fetcher, bool) {
+	return p, true
+}
+
+func (p ownerPeer) Fetch(ctx context.Context, group string, key string) ([]byte, error) {
+	return nil, errors.New("owner unavailable")
+}
+
+func (p ownerPeer) Lease(ctx context.Context, group string, key string) (LeaseResult, error) {
+	return p.owner.leases.acquire(ctx, key)
+}
+
+func (p ownerPeer) Release(group string, key string, token string, value []byte, loadErr error) error {
+	p.owner.leases.release(key, token, value, loadErr)
+	return nil
+}
+
+func TestLoadLeaseCoalescesAcrossNodes(t *testing.T) {
+	var loads atomic.Int64
+	release := make(chan struct{})
+	retriever := RetrieveFunc(func(key string) ([]byte, error) {
+		n := loads.Add(1)
+		<-release
+		return []byte(strconv.FormatInt(n, 10)), nil
+	})
+	owner := NewGroup("lease-owner", "lru", 0, retriever, WithLoadLease(time.Second))
+	nodes := make([]*Group, 3)
+	for i := range nodes {
+		nodes[i] = NewGroup("lease-node-"+strconv.Itoa(i), "lru", 0, retriever, WithLoadLease(time.Second))
+		nodes[i].RegisterServer(ownerPeer{owner})
+	}
+
+	var wg sync.WaitGroup
+	for _, g := range nodes {
+		wg.Add(1)
+		go func(g *Group) {
+			defer wg.Done()
+			if v, err := g.Get("key"); err != nil || v.String() != "1" {
+				t.Errorf("%s get = (%s, %v), expect the value loaded by the lease holder", g.name, v, err)
+			}
+		}(g)
+	}
+	time.Sleep(time.Millisecond * 50)
+	close(release)
+	wg.Wait()
+
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("retriever called %d times across nodes, expect 1", n)
+	}
+	var waits int64
+	for _, g := range nodes {
+		waits += g.stats.leaseWaits.Load()
+	}
+	if waits != 2 {
+		t.Fatalf("lease waits = %d, expect 2", waits)
+	}
+	// 持有者释放租约时负责节点缓存了结果
+	if v, ok := owner.mainCache.get("key"); !ok || v.String() != "1" {
+		t.Fatalf("owner cache = (%s, %v), expect the released value", v, ok)
+	}
+}
+
+func TestLoadLeaseDivergentViews(t *testing.T) {
+	var loads atomic.Int64
+	release := make(chan struct{})
+	retriever := RetrieveFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		<-release
+		return []byte("value"), nil
+	})
+	// 哈希环变化期间 a、b 认为 key 属于 ownerA，c 认为属于 ownerB
+	ownerA := NewGroup("lease-divergent-owner-a", "lru", 0, retriever, WithLoadLease(time.Second))
+	ownerB := NewGroup("lease-divergent-owner-b", "lru", 0, retriever, WithLoadLease(time.Second))
+	views := map[string]*Group{"a": ownerA, "b": ownerA, "c": ownerB}
+
+	var wg sync.WaitGroup
+	for name, owner := range views {
+		g := NewGroup("lease-divergent-"+name, "lru", 0, retriever, WithLoadLease(time.Second))
+		g.RegisterServer(ownerPeer{owner})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := g.Get("key"); err != nil || v.String() != "value" {
+				t.Errorf("%s get = (%s, %v)", g.name, v, err)
+			}
+		}()
+	}
+	time.Sleep(time.Millisecond * 50)
+	close(release)
+	wg.Wait()
+
+	// 认为负责节点相同的节点合并为一次回源，不同的负责节点各自发放租约
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("retriever called %d times with two owner views, expect 2", n)
+	}
+	for _, owner := range []*Group{ownerA, ownerB} {
+		if v, ok := owner.mainCache.get("key"); !ok || v.String() != "value" {
+			t.Fatalf("%s cache = (%s, %v), expect the released value", owner.name, v, ok)
+		}
+	}
+}
+
+func TestLoadLeaseExpires(t *testing.T) {
+	owner := NewGroup("lease-expire-owner", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	}), WithLoadLease(time.Millisecond*100))
+
+	held, err := owner.leases.acquire(context.Background(), "key")
+	if err != nil || !held.Granted {
+		t.Fatalf("first acquire = (%+v, %v), expect granted", held, err)
+	}
+
+	// 持有者不释放，租约过期后等待者获得新的租约
+	start := time.Now()
+	next, err := owner.leases.acquire(context.Background(), "key")
+	if err != nil || !next.Granted || next.Token == held.Token {
+		t.Fatalf("second acquire = (%+v, %v), expect a new lease", next, err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Millisecond*100 {
+		t.Fatalf("lease granted after %v, expect to wait for expiration", elapsed)
+	}
+
+	// 过期的持有者释放时不影响新的租约
+	owner.leases.release("key", held.Token, []byte("old"), nil)
+	if _, ok := owner.mainCache.get("key"); ok {
+		t.Fatal("release with an expired token should be ignored")
+	}
+
+	// 持有者回源失败时，等待者收到失败而不是重新回源
+	done := make(chan LeaseResult)
+	go func() {
+		res, _ := owner.leases.acquire(context.Background(), "key")
+		done <- res
+	}()
+	time.Sleep(time.Millisecond * 20)
+	owner.leases.release("key", next.Token, nil, errLoadFailed)
+	if res := <-done; !res.Failed {
+		t.Fatalf("waiter got %+v, expect the holder's failure", res)
+	}
+}
+
+func TestLoadLeaseOwnerCacheHit(t *testing.T) {
+	owner := NewGroup("lease-owner-hit", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		t.Fatal("cached key should not be retrieved")
+		return nil, nil
+	}), WithLoadLease(time.Second), WithTTL(time.Minute))
+	owner.Set("key", []byte("value"))
+	before, _ := owner.Peek("key")
+	sub := owner.Subscribe(16)
+	defer sub.Close()
+	time.Sleep(time.Millisecond * 5)
+
+	// 负责节点申请租约时命中缓存（例如其他节点刚刚释放了租约），直接返回缓存的值
+	view, err := owner.getLocally(context.Background(), "key")
+	if err != nil || view.String() != "value" {
+		t.Fatalf("getLocally = %q, %v", view.String(), err)
+	}
+	if after, _ := owner.Peek("key"); !after.ExpireAt.Equal(before.ExpireAt) {
+		t.Fatalf("expire at %v -> %v, a cache hit should not write the entry again", before.ExpireAt, after.ExpireAt)
+	}
+	select {
+	case e := <-sub.C:
+		t.Fatalf("got %s event for a local cache hit", e.Type)
+	case <-time.After(time.Millisecond * 50):
+	}
+	if st := owner.Stats(); st.LeaseWaits != 0 {
+		t.Fatalf("stats = %+v, a cache hit is not a lease wait", st)
+	}
+}
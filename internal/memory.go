@@ -0,0 +1,226 @@
+package service
+
+import (
+	"gocache/utils/logger"
+	"math"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRebalanceInterval = time.Second * 30
+	defaultMissCost          = time.Millisecond // 还没有观测到回源耗时时使用的默认回源代价
+)
+
+/*
+MemoryManager 进程级的内存预算管理器，持有所有 group 共享的总预算
+  - 每个 group 至少分配 minGroupBytes（不小于 1 字节，容量 0 表示不限制），剩余预算按权重分配
+  - 权重 = 请求数 × 平均回源代价 × (1 + 未命中率)：请求数 × 回源代价是缓存为该 group 节省的回源时间，
+    未命中率高说明当前容量装不下工作集，增加容量的收益更大，权重最多翻倍；
+    请求多、回源慢、命中率低的 group 分到更多内存，空闲的 group 只保留保底容量
+  - 权重在相邻两个周期之间做指数平滑，避免容量来回抖动
+  - 可选地跟随 runtime/debug.SetMemoryLimit：预算不超过内存上限的 limitRatio
+*/
+type MemoryManager struct {
+	mu            sync.Mutex
+	budget        int64
+	minGroupBytes int64
+	limitRatio    float64
+	interval      time.Duration
+	groups        map[string]*managedGroup
+	stop          chan struct{}
+}
+
+// managedGroup 记录上一次再平衡时的计数器快照和平滑后的权重
+type managedGroup struct {
+	group     *Group
+	gets      int64
+	hits      int64
+	loads     int64
+	loadNanos int64
+	missCost  float64 // 平均回源代价（纳秒）
+	weight    float64
+}
+
+// NewMemoryManager 创建内存管理器，budget 为所有 group 共享的总字节数，interval 为再平衡周期
+func NewMemoryManager(budget int64, interval time.Duration) *MemoryManager {
+	if interval <= 0 {
+		interval = defaultRebalanceInterval
+	}
+	return &MemoryManager{
+		budget:   budget,
+		interval: interval,
+		groups:   make(map[string]*managedGroup),
+	}
+}
+
+// SetMinGroupBytes 设置每个 group 的保底容量
+func (m *MemoryManager) SetMinGroupBytes(minGroupBytes int64) {
+	m.mu.Lock()
+	m.minGroupBytes = minGroupBytes
+	m.mu.Unlock()
+}
+
+/*
+FollowMemoryLimit 让预算跟随 runtime/debug.SetMemoryLimit 设置的软内存上限
+  - ratio 为可用于缓存的比例，例如 0.5 表示最多使用内存上限的一半
+  - 未设置内存上限（math.MaxInt64）时仍使用固定预算
+  - ratio <= 0 关闭跟随
+*/
+func (m *MemoryManager) FollowMemoryLimit(ratio float64) {
+	m.mu.Lock()
+	m.limitRatio = ratio
+	m.mu.Unlock()
+}
+
+// Register 将 group 纳入预算管理，立即触发一次再平衡
+func (m *MemoryManager) Register(g *Group) {
+	m.mu.Lock()
+	m.groups[g.name] = &managedGroup{
+		group:     g,
+		gets:      g.stats.gets.Load(),
+		hits:      g.stats.hits.Load(),
+		loads:     g.stats.loads.Load(),
+		loadNanos: g.stats.loadNanos.Load(),
+	}
+	m.mu.Unlock()
+	m.Rebalance()
+}
+
+// Unregister 将 group 移出预算管理，其容量保持最后一次分配的值
+func (m *MemoryManager) Unregister(name string) {
+	m.mu.Lock()
+	delete(m.groups, name)
+	m.mu.Unlock()
+}
+
+// Budget 返回当前生效的总预算
+func (m *MemoryManager) Budget() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.effectiveBudget()
+}
+
+// effectiveBudget 计算生效的预算，调用方需持有 m.mu
+func (m *MemoryManager) effectiveBudget() int64 {
+	budget := m.budget
+	if m.limitRatio > 0 {
+		// 传入负数只读取当前的内存上限，不会修改
+		if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+			if limited := int64(float64(limit) * m.limitRatio); budget <= 0 || limited < budget {
+				budget = limited
+			}
+		}
+	}
+	return budget
+}
+
+/*
+Rebalance 按观测到的访问量和回源代价重新分配预算
+  - 统计上一周期内每个 group 的请求数和回源耗时，更新平滑权重
+  - 先给每个 group 分配保底容量，剩余预算按权重分配；所有权重为 0 时平均分配
+  - 先缩容再扩容，避免调整过程中总占用超出预算
+*/
+func (m *MemoryManager) Rebalance() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	budget := m.effectiveBudget()
+	if budget <= 0 || len(m.groups) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(m.groups))
+	for name := range m.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var totalWeight float64
+	for _, name := range names {
+		mg := m.groups[name]
+		st := &mg.group.stats
+		gets, hits, loads, loadNanos := st.gets.Load(), st.hits.Load(), st.loads.Load(), st.loadNanos.Load()
+		deltaGets, deltaHits, deltaLoads, deltaNanos := gets-mg.gets, hits-mg.hits, loads-mg.loads, loadNanos-mg.loadNanos
+		mg.gets, mg.hits, mg.loads, mg.loadNanos = gets, hits, loads, loadNanos
+
+		if deltaLoads > 0 {
+			mg.missCost = float64(deltaNanos) / float64(deltaLoads)
+		}
+		missCost := mg.missCost
+		if missCost == 0 {
+			missCost = float64(defaultMissCost)
+		}
+		missRatio := 0.0
+		if deltaGets > 0 {
+			missRatio = math.Min(1, math.Max(0, 1-float64(deltaHits)/float64(deltaGets)))
+		}
+		mg.weight = 0.5*mg.weight + 0.5*float64(deltaGets)*missCost*(1+missRatio)
+		totalWeight += mg.weight
+	}
+
+	// 保底容量至少 1 字节：setCacheBytes(0) 会让淘汰策略不再限制容量，空闲的 group 反而没有上限
+	minGroupBytes := max(m.minGroupBytes, 1)
+	if reserved := minGroupBytes * int64(len(names)); reserved > budget {
+		minGroupBytes = max(budget/int64(len(names)), 1)
+	}
+	rest := max(budget-minGroupBytes*int64(len(names)), 0)
+
+	targets := make(map[string]int64, len(names))
+	for _, name := range names {
+		share := 1 / float64(len(names))
+		if totalWeight > 0 {
+			share = m.groups[name].weight / totalWeight
+		}
+		targets[name] = minGroupBytes + int64(float64(rest)*share)
+	}
+
+	// 先缩容后扩容
+	for _, shrink := range []bool{true, false} {
+		for _, name := range names {
+			c := m.groups[name].group.mainCache
+			_, current := c.settings()
+			if target := targets[name]; (target < current) == shrink && target != current {
+				c.setCacheBytes(target)
+			}
+		}
+	}
+	logger.LogrusObj.Debugf("[GoCache] memory budget %d bytes rebalanced: %v", budget, targets)
+}
+
+// Start 启动后台再平衡任务，重复调用无效
+func (m *MemoryManager) Start() {
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.stop = make(chan struct{})
+	stop := m.stop
+	m.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.Rebalance()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止后台再平衡任务
+func (m *MemoryManager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
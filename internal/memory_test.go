@@ -0,0 +1,105 @@
+package service
+
+import (
+	"math"
+	"runtime/debug"
+	"testing"
+	"time"
+)
+
+func TestMemoryManagerRebalance(t *testing.T) {
+	retriever := RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	busy := NewGroup("memory-busy", "lru", 1000, retriever)
+	idle := NewGroup("memory-idle", "lru", 1000, retriever)
+
+	mm := NewMemoryManager(1000, time.Minute)
+	mm.SetMinGroupBytes(100)
+	mm.Register(busy)
+	mm.Register(idle)
+
+	// 没有任何访问时平均分配
+	if _, b := busy.Settings(); b != 500 {
+		t.Fatalf("busy group should get half of the budget, got %d", b)
+	}
+
+	// busy 有大量请求且回源代价高，idle 没有请求
+	busy.stats.gets.Add(1000)
+	busy.stats.loads.Add(100)
+	busy.stats.loadNanos.Add(int64(100 * time.Millisecond))
+	mm.Rebalance()
+
+	_, busyBytes := busy.Settings()
+	_, idleBytes := idle.Settings()
+	if busyBytes+idleBytes > 1000 {
+		t.Fatalf("allocated %d bytes exceed the budget", busyBytes+idleBytes)
+	}
+	if idleBytes != 100 || busyBytes != 900 {
+		t.Fatalf("busy = %d, idle = %d, expect 900 and 100", busyBytes, idleBytes)
+	}
+}
+
+func TestMemoryManagerIdleGroupStaysBounded(t *testing.T) {
+	retriever := RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	busy := NewGroup("memory-bounded-busy", "lru", 1000, retriever)
+	idle := NewGroup("memory-bounded-idle", "lru", 1000, retriever)
+
+	// 没有设置保底容量，idle 没有请求时也不能分到 0（不限制容量）
+	mm := NewMemoryManager(1000, time.Minute)
+	mm.Register(busy)
+	mm.Register(idle)
+	busy.stats.gets.Add(1000)
+	mm.Rebalance()
+
+	_, busyBytes := busy.Settings()
+	_, idleBytes := idle.Settings()
+	if idleBytes <= 0 || busyBytes <= 0 || busyBytes+idleBytes > 1000 {
+		t.Fatalf("busy = %d, idle = %d, expect positive caps within the budget", busyBytes, idleBytes)
+	}
+}
+
+func TestMemoryManagerWeighsMissRatio(t *testing.T) {
+	retriever := RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	hot := NewGroup("memory-ratio-hot", "lru", 1000, retriever)
+	cold := NewGroup("memory-ratio-cold", "lru", 1000, retriever)
+
+	mm := NewMemoryManager(1000, time.Minute)
+	mm.Register(hot)
+	mm.Register(cold)
+
+	// 请求数和回源代价相同，cold 的命中率低，增加容量的收益更大
+	for _, g := range []*Group{hot, cold} {
+		g.stats.gets.Add(1000)
+		g.stats.loads.Add(100)
+		g.stats.loadNanos.Add(int64(100 * time.Millisecond))
+	}
+	hot.stats.hits.Add(1000)
+	mm.Rebalance()
+
+	_, hotBytes := hot.Settings()
+	_, coldBytes := cold.Settings()
+	if coldBytes <= hotBytes || hotBytes+coldBytes > 1000 {
+		t.Fatalf("hot = %d, cold = %d, expect cold to get more", hotBytes, coldBytes)
+	}
+}
+
+func TestMemoryManagerFollowMemoryLimit(t *testing.T) {
+	prev := debug.SetMemoryLimit(math.MaxInt64)
+	defer debug.SetMemoryLimit(prev)
+
+	mm := NewMemoryManager(1<<20, time.Minute)
+	mm.FollowMemoryLimit(0.5)
+	if mm.Budget() != 1<<20 {
+		t.Fatalf("budget should stay fixed without a memory limit, got %d", mm.Budget())
+	}
+
+	debug.SetMemoryLimit(1 << 20)
+	if mm.Budget() != 1<<19 {
+		t.Fatalf("budget should follow half of the memory limit, got %d", mm.Budget())
+	}
+}
@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"errors"
+	service "gocache/internal"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+/*
+Metrics 缓存节点的 Prometheus 指标
+  - group 的命中、未命中、淘汰等计数和缓存占用在抓取时从 Group.Stats() 读取，不在请求路径上重复计数
+  - 开启热点统计的 group 在抓取时导出访问最多的 hotKeyLimit 个 key 的估计访问次数
+  - 数据源查询和远程节点获取的耗时分布、哈希环的变化通过 service.Observer 在事件发生时记录
+  - 使用独立的 Registry，同时导出 Go 运行时和进程指标
+*/
+type Metrics struct {
+	registry *prometheus.Registry
+
+	retrieveLatency  *prometheus.HistogramVec
+	peerFetchLatency *prometheus.HistogramVec
+	ringPeers        prometheus.Gauge
+	ringChanges      *prometheus.CounterVec
+}
+
+var _ service.Observer = (*Metrics)(nil)
+
+// New 创建并注册所有指标，需要通过 service.SetObserver 接收事件
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		retrieveLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "gocache",
+			Name:      "retrieve_duration_seconds",
+			Help:      "Latency of loading a key from the data source.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, []string{"group", "result"}),
+		peerFetchLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "gocache",
+			Name:      "peer_fetch_duration_seconds",
+			Help:      "Latency of fetching a key from the owner peer.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, []string{"group", "peer", "result"}),
+		ringPeers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "gocache",
+			Name:      "ring_peers",
+			Help:      "Number of peers on the consistent hash ring.",
+		}),
+		ringChanges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "gocache",
+			Name:      "ring_membership_changes_total",
+			Help:      "Peers that joined or left the consistent hash ring.",
+		}, []string{"change"}),
+	}
+	m.registry.MustRegister(
+		m.retrieveLatency,
+		m.peerFetchLatency,
+		m.ringPeers,
+		m.ringChanges,
+		groupCollector{},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler 返回导出指标的 HTTP handler
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Serve 在 addr 上监听并在 /metrics 路径导出指标，阻塞直到监听失败
+func (m *Metrics) Serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	return http.ListenAndServe(addr, mux)
+}
+
+// result 把错误归类为指标的 result 标签
+func result(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, service.ErrNotFound):
+		return "not_found"
+	default:
+		return "error"
+	}
+}
+
+func (m *Metrics) ObserveRetrieve(group string, latency time.Duration, err error) {
+	m.retrieveLatency.WithLabelValues(group, result(err)).Observe(latency.Seconds())
+}
+
+func (m *Metrics) ObservePeerFetch(group string, peer string, latency time.Duration, err error) {
+	m.peerFetchLatency.WithLabelValues(group, peer, result(err)).Observe(latency.Seconds())
+}
+
+func (m *Metrics) ObserveRing(peers int, joined int, left int) {
+	m.ringPeers.Set(float64(peers))
+	m.ringChanges.WithLabelValues("join").Add(float64(joined))
+	m.ringChanges.WithLabelValues("leave").Add(float64(left))
+}
+
+// groupMetric 从 Stats 中读取的一项 group 指标
+type groupMetric struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	value     func(service.Stats) float64
+}
+
+func counter(name string, help string, value func(service.Stats) int64) groupMetric {
+	return groupMetric{
+		desc:      prometheus.NewDesc("gocache_group_"+name+"_total", help, []string{"group"}, nil),
+		valueType: prometheus.CounterValue,
+		value:     func(s service.Stats) float64 { return float64(value(s)) },
+	}
+}
+
+func gauge(name string, help string, value func(service.Stats) int64) groupMetric {
+	return groupMetric{
+		desc:      prometheus.NewDesc("gocache_group_"+name, help, []string{"group"}, nil),
+		valueType: prometheus.GaugeValue,
+		value:     func(s service.Stats) float64 { return float64(value(s)) },
+	}
+}
+
+var groupMetrics = []groupMetric{
+	counter("gets", "Get requests.", func(s service.Stats) int64 { return s.Gets }),
+	counter("hits", "Get requests served from the local cache.", func(s service.Stats) int64 { return s.Hits }),
+	counter("stale_hits", "Hits past the soft TTL, refreshed in the background.", func(s service.Stats) int64 { return s.StaleHits }),
+	counter("negative_hits", "Hits on cached not-found entries.", func(s service.Stats) int64 { return s.NegativeHits }),
+	counter("misses", "Get requests missing the local cache.", func(s service.Stats) int64 { return s.Misses }),
+	counter("filtered", "Misses rejected by the bloom filter.", func(s service.Stats) int64 { return s.Filtered }),
+	counter("stale_on_error", "Expired values served because loading failed.", func(s service.Stats) int64 { return s.StaleOnError }),
+	counter("loads", "Loads after a miss, including deduplicated ones.", func(s service.Stats) int64 { return s.Loads }),
+	counter("dedupes", "Loads merged into a concurrent load of the same key.", func(s service.Stats) int64 { return s.Dedupes }),
+	counter("peer_loads", "Loads fetched from the owner peer.", func(s service.Stats) int64 { return s.PeerLoads }),
+	counter("peer_errors", "Failed fetches from the owner peer.", func(s service.Stats) int64 { return s.PeerErrors }),
+	counter("local_loads", "Loads from the data source.", func(s service.Stats) int64 { return s.LocalLoads }),
+	counter("local_load_errors", "Failed loads from the data source.", func(s service.Stats) int64 { return s.LocalLoadErrors }),
+	counter("replica_hits", "Hits served by local replicas of hot keys owned by other peers.", func(s service.Stats) int64 { return s.ReplicaHits }),
+	counter("replicated", "Hot keys fetched from the owner and replicated locally.", func(s service.Stats) int64 { return s.Replicated }),
+	counter("lease_waits", "Loads served by another node holding the load lease.", func(s service.Stats) int64 { return s.LeaseWaits }),
+	counter("refreshes", "Hot keys refreshed ahead of expiry.", func(s service.Stats) int64 { return s.Refreshes }),
+	counter("evictions", "Entries evicted for capacity.", func(s service.Stats) int64 { return s.Evictions }),
+	counter("expirations", "Entries removed after expiry.", func(s service.Stats) int64 { return s.Expirations }),
+	gauge("bytes", "Bytes used by the cache.", func(s service.Stats) int64 { return s.Bytes }),
+	gauge("items", "Entries in the cache.", func(s service.Stats) int64 { return s.Items }),
+}
+
+// hotKeyLimit 每个 group 导出的热点 key 数量，限制标签的基数
+const hotKeyLimit = 10
+
+var hotKeyDesc = prometheus.NewDesc("gocache_group_hot_key_gets",
+	"Decayed estimate of recent gets of the hottest keys, comparable within a group.",
+	[]string{"group", "key"}, nil)
+
+// groupCollector 抓取时遍历所有 group 读取 Stats，新建的 group 自动出现在指标中
+type groupCollector struct{}
+
+func (groupCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range groupMetrics {
+		ch <- m.desc
+	}
+	ch <- hotKeyDesc
+}
+
+func (groupCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, g := range service.Groups() {
+		stats := g.Stats()
+		for _, m := range groupMetrics {
+			ch <- prometheus.MustNewConstMetric(m.desc, m.valueType, m.value(stats), g.Name())
+		}
+		for _, k := range g.HotKeys(hotKeyLimit) {
+			ch <- prometheus.MustNewConstMetric(hotKeyDesc, prometheus.GaugeValue, float64(k.Count), g.Name(), k.Key)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"errors"
+	service "gocache/internal"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	service.SetObserver(m)
+	defer service.SetObserver(nil)
+
+	g := service.NewGroup("metrics", "lru", 0, service.RetrieveFunc(func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, service.ErrNotFound
+		}
+		return []byte("value"), nil
+	}), service.WithHotKeys(10, time.Hour))
+	g.Get("key")
+	g.Get("key")
+	g.Get("missing")
+	m.ObservePeerFetch("metrics", "127.0.0.1:10000", time.Millisecond, errors.New("timeout"))
+	m.ObserveRing(3, 3, 0)
+	m.ObserveRing(2, 0, 1)
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`gocache_group_gets_total{group="metrics"} 3`,
+		`gocache_group_hits_total{group="metrics"} 1`,
+		`gocache_group_misses_total{group="metrics"} 2`,
+		`gocache_group_items{group="metrics"} 1`,
+		`gocache_group_hot_key_gets{group="metrics",key="key"} 2`,
+		`gocache_retrieve_duration_seconds_count{group="metrics",result="ok"} 1`,
+		`gocache_retrieve_duration_seconds_count{group="metrics",result="not_found"} 1`,
+		`gocache_peer_fetch_duration_seconds_count{group="metrics",peer="127.0.0.1:10000",result="error"} 1`,
+		`gocache_ring_peers 2`,
+		`gocache_ring_membership_changes_total{change="join"} 3`,
+		`gocache_ring_membership_changes_total{change="leave"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics should contain %q", want)
+		}
+	}
+	if t.Failed() {
+		t.Log(body)
+	}
+}
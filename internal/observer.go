@@ -0,0 +1,49 @@
+package service
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+/*
+Observer 接收 Group、cache 和 Client 上需要计时的事件，用于导出监控指标
+  - 计数类指标直接读取 Group.Stats()，这里只有耗时分布和哈希环变化
+  - 方法在请求路径上同步调用，实现应当尽快返回
+  - 默认为空实现，通过 SetObserver 设置
+*/
+type Observer interface {
+	// ObserveRetrieve 一次数据源查询，err 为 ErrNotFound 表示数据源中不存在
+	ObserveRetrieve(group string, latency time.Duration, err error)
+	// ObservePeerFetch 一次从远程节点获取，err 为 ErrNotFound 表示对端确认不存在
+	ObservePeerFetch(group string, peer string, latency time.Duration, err error)
+	// ObserveRing 哈希环重建，peers 为节点总数，joined、left 为加入和离开的节点数
+	ObserveRing(peers int, joined int, left int)
+}
+
+type nopObserver struct{}
+
+func (nopObserver) ObserveRetrieve(string, time.Duration, error)          {}
+func (nopObserver) ObservePeerFetch(string, string, time.Duration, error) {}
+func (nopObserver) ObserveRing(int, int, int)                             {}
+
+// observerBox atomic.Pointer 只能存放具体类型，用它包装接口
+type observerBox struct {
+	Observer
+}
+
+var currentObserver atomic.Pointer[observerBox]
+
+// SetObserver 设置全局的 Observer，传入 nil 时恢复为空实现
+func SetObserver(o Observer) {
+	if o == nil {
+		o = nopObserver{}
+	}
+	currentObserver.Store(&observerBox{o})
+}
+
+func observer() Observer {
+	if box := currentObserver.Load(); box != nil {
+		return box.Observer
+	}
+	return nopObserver{}
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"gocache/internal/policy"
+	"gocache/internal/policy/interfaces"
+	"math"
+	"time"
+)
+
+/*
+groupOptions Group 的可选配置
+  - sizer：根据淘汰策略名给出条目大小的计算方式，默认计入策略的结构开销
+  - maxEntries：条目数量上限，0 表示只按字节数限制
+  - ttl：条目写入后的存活时间（硬 TTL），0 表示永不过期
+  - softTTL：超过后返回旧值并在后台刷新，0 或不小于 ttl 时关闭
+  - ttlJitter：TTL 的随机缩短比例（0~1），打散同一时刻写入的条目的过期时间
+  - earlyBeta：概率提前过期（XFetch）的 beta，0 表示关闭
+  - negativeTTL：数据源中不存在的 key 的负缓存时间，0 表示不缓存
+  - grace：硬 TTL 之后继续保留条目的时间，回源失败时返回这些旧值，0 表示不保留
+  - keyLoader、bloomExpected、bloomFPRate：布隆过滤器，见 WithBloomFilter
+  - refreshAhead、refreshHits、refreshConcurrency：热点 key 的提前刷新，见 WithRefreshAhead
+  - flightTTL、flightEntries：SingleFlight 缓存回源结果的时间和数量上限，见 WithFlightCache
+  - loadLease：回源租约的有效期，0 表示不在集群范围内合并回源，见 WithLoadLease
+  - batchWindow、batchSize：合并回源的时间窗口和批次大小，见 WithBatching
+  - batchTimeout：一次批量查询的超时，见 WithBatchTimeout
+  - hotKeys、hotKeyDecay：热点 key 统计的数量和衰减周期，见 WithHotKeys
+  - replicaMinCount、replicaBytes、replicaTTL：热点 key 的本地副本，见 WithHotKeyReplication
+*/
+type groupOptions struct {
+	sizer              func(strategy string) interfaces.Sizer
+	maxEntries         int
+	ttl                time.Duration
+	softTTL            time.Duration
+	grace              time.Duration
+	ttlJitter          float64
+	earlyBeta          float64
+	negativeTTL        time.Duration
+	keyLoader          KeyLoader
+	bloomExpected      int
+	bloomFPRate        float64
+	refreshAhead       time.Duration
+	refreshHits        int
+	refreshConcurrency int
+	flightTTL          time.Duration
+	flightEntries      int
+	loadLease          time.Duration
+	batchWindow        time.Duration
+	batchSize          int
+	batchTimeout       time.Duration
+	hotKeys            int
+	hotKeyDecay        time.Duration
+	replicaMinCount    int64
+	replicaBytes       int64
+	replicaTTL         time.Duration
+}
+
+const (
+	defaultFlightTTL     = time.Second * 10
+	defaultFlightEntries = 1024
+	defaultHotKeys       = 100
+	defaultHotKeyDecay   = time.Minute
+	defaultBatchTimeout  = time.Second * 5
+)
+
+// GroupOption 创建 Group 时的可选配置
+type GroupOption func(*groupOptions)
+
+func defaultGroupOptions() groupOptions {
+	return groupOptions{
+		sizer:         policy.OverheadSizer,
+		flightTTL:     defaultFlightTTL,
+		flightEntries: defaultFlightEntries,
+		batchTimeout:  defaultBatchTimeout,
+	}
+}
+
+/*
+WithSizer 指定条目大小的计算方式
+  - 传入的函数以淘汰策略名为参数，切换策略时会重新计算
+  - 例如 WithSizer(func(string) interfaces.Sizer { return interfaces.BytesSizer }) 只统计 key 和 value 的字节数
+*/
+func WithSizer(sizer func(strategy string) interfaces.Sizer) GroupOption {
+	return func(o *groupOptions) {
+		o.sizer = sizer
+	}
+}
+
+// WithMaxEntries 设置条目数量上限，与 maxBytes 同时生效
+func WithMaxEntries(maxEntries int) GroupOption {
+	return func(o *groupOptions) {
+		o.maxEntries = maxEntries
+	}
+}
+
+// WithTTL 设置条目写入后的存活时间，过期任务登记在共享的时间轮上
+func WithTTL(ttl time.Duration) GroupOption {
+	return func(o *groupOptions) {
+		o.ttl = ttl
+	}
+}
+
+/*
+WithStaleWhileRevalidate 设置软 TTL 和硬 TTL
+  - 写入后 softTTL 内条目是新鲜的，直接返回
+  - softTTL 到 hardTTL 之间，Get 立即返回旧值，并通过 SingleFlight 在后台刷新一次
+  - 超过 hardTTL 条目被淘汰，Get 阻塞回源
+*/
+func WithStaleWhileRevalidate(softTTL, hardTTL time.Duration) GroupOption {
+	return func(o *groupOptions) {
+		o.softTTL = softTTL
+		o.ttl = hardTTL
+	}
+}
+
+/*
+WithRefreshAhead 为热点 key 开启提前刷新，需要同时设置 TTL
+  - 最近两个 TTL 周期内命中次数不少于 minHits 的 key 视为热点
+  - 热点 key 在过期前 ahead 时重新调用 Retriever，刷新成功后不会出现未命中
+  - 同时进行的刷新不超过 concurrency 个，超出时放弃本次刷新，条目按时过期，避免压垮数据库
+*/
+func WithRefreshAhead(ahead time.Duration, minHits, concurrency int) GroupOption {
+	return func(o *groupOptions) {
+		o.refreshAhead = ahead
+		o.refreshHits = minHits
+		o.refreshConcurrency = concurrency
+	}
+}
+
+/*
+WithStaleOnError 开启回源失败时返回旧值，需要同时设置 TTL
+  - 条目超过硬 TTL 后继续保留 grace，这段时间内读取仍然先回源
+  - 回源失败时返回保留的旧值并标记为 stale，回源成功则覆盖旧值
+*/
+func WithStaleOnError(grace time.Duration) GroupOption {
+	return func(o *groupOptions) {
+		o.grace = grace
+	}
+}
+
+/*
+WithNegativeTTL 设置负缓存的存活时间
+  - Retriever 返回 ErrNotFound 时写入负缓存条目，ttl 内的读取直接返回 ErrNotFound，不再回源
+  - 通常比正常条目的 TTL 短，数据写入后最多 ttl 即可读到
+*/
+func WithNegativeTTL(ttl time.Duration) GroupOption {
+	return func(o *groupOptions) {
+		o.negativeTTL = ttl
+	}
+}
+
+/*
+WithBloomFilter 开启布隆过滤器，拦截数据源中一定不存在的 key
+  - 创建 Group 时调用 loader 加载所有已经存在的 key，之后可以通过 Rebuild 重建
+  - 被过滤的 key 在访问远程节点和 Retriever 之前直接返回 ErrNotFound
+  - expected 为预计的 key 数量，fpRate 为期望误判率（默认 0.01），误判的 key 仍会正常回源
+*/
+func WithBloomFilter(loader KeyLoader, expected int, fpRate float64) GroupOption {
+	return func(o *groupOptions) {
+		o.keyLoader = loader
+		o.bloomExpected = expected
+		o.bloomFPRate = fpRate
+	}
+}
+
+// WithTTLJitter 写入时把 TTL（包括软 TTL）随机缩短到 [1-jitter, 1] 倍，避免大量条目同时过期造成缓存雪崩
+func WithTTLJitter(jitter float64) GroupOption {
+	return func(o *groupOptions) {
+		o.ttlJitter = math.Min(math.Max(jitter, 0), 1)
+	}
+}
+
+/*
+WithEarlyExpiration 开启概率提前过期（XFetch）
+  - 每次命中时按 now - delta·beta·ln(rand) >= expireAt 判断是否在后台提前重新加载，delta 为该条目上次回源的耗时
+  - 回源越慢、越接近过期时间，提前的概率越高；过期前通常已经有一个请求完成了重新加载，不会出现大量请求同时回源
+  - beta 通常取 1，越大越倾向于提前
+*/
+func WithEarlyExpiration(beta float64) GroupOption {
+	return func(o *groupOptions) {
+		o.earlyBeta = beta
+	}
+}
+
+/*
+WithFlightCache 设置 SingleFlight 缓存回源结果的时间和数量上限，默认 10 秒、1024 个
+  - 缓存期间同一个 key 的回源直接返回上一次的结果，ttl 为 0 时关闭
+  - ttl 超过条目的 TTL 时按条目的 TTL 缓存，否则条目过期后仍会拿到旧结果
+  - maxEntries 为 0 时不限制数量
+*/
+func WithFlightCache(ttl time.Duration, maxEntries int) GroupOption {
+	return func(o *groupOptions) {
+		o.flightTTL = ttl
+		o.flightEntries = maxEntries
+	}
+}
+
+/*
+WithLoadLease 开启集群范围的回源合并
+  - 查询数据源之前向 key 的负责节点申请租约，负责节点同一时刻只为同一个 key 发放一个租约
+  - 其他节点等待持有者释放租约并直接使用其结果，负责节点同时缓存该结果
+  - 持有者 ttl 内没有释放时租约过期，由等待者重新申请，ttl 应当大于一次回源的耗时
+  - 只有本地回源时才申请租约：负责节点自己回源，或者从负责节点取值失败后退回本地回源；
+    请求正常到达负责节点时由负责节点的 SingleFlight 合并，不需要租约
+  - 租约由请求方认为的负责节点发放：各节点的哈希环一致时整个集群只回源一次；
+    哈希环变化期间各节点的视图可能不一致，此时每个被认为是负责节点的节点各自发放租约，
+    回源次数不超过各视图中不同负责节点的个数，视图收敛后恢复为一次
+*/
+func WithLoadLease(ttl time.Duration) GroupOption {
+	return func(o *groupOptions) {
+		o.loadLease = ttl
+	}
+}
+
+/*
+WithBatching 把 window 内多次未命中的回源合并为一次批量查询，Retriever 需要实现 BatchRetriever（例如 RetrieveManyFunc）
+  - 第一次回源开启批次，window 之后或者攒够 maxSize 个 key 时调用一次 RetrieveMany，maxSize 为 0 时不限制
+  - 每次回源最多多等待 window，通常取几毫秒
+  - Retriever 不支持批量查询时该选项不生效
+*/
+func WithBatching(window time.Duration, maxSize int) GroupOption {
+	return func(o *groupOptions) {
+		o.batchWindow = window
+		o.batchSize = maxSize
+	}
+}
+
+/*
+WithBatchTimeout 一次 RetrieveMany 的超时，默认 5 秒，d <= 0 时不限制
+  - 批次由多个调用方共享，与单个 key 的回源一样不随调用方取消而中断，超时是批量查询唯一的上限
+*/
+func WithBatchTimeout(d time.Duration) GroupOption {
+	return func(o *groupOptions) {
+		o.batchTimeout = d
+	}
+}
+
+/*
+WithHotKeys 统计访问最多的 k 个 key，通过 Group.HotKeys、HotKeys RPC 和指标查看
+  - 每次 Get 都计入统计（包括命中），使用 count-min sketch 估计次数，内存只与 k 有关
+  - 每隔 decay 所有计数减半，反映最近一段时间的热点，decay 为 0 时不衰减
+*/
+func WithHotKeys(k int, decay time.Duration) GroupOption {
+	return func(o *groupOptions) {
+		o.hotKeys = k
+		o.hotKeyDecay = decay
+	}
+}
+
+/*
+WithHotKeyReplication 把从负责节点取回的热点 key 复制到本地，之后的读取不再访问负责节点
+  - 在 top-K 中且估计访问次数不少于 minCount 的 key 视为热点，未设置 WithHotKeys 时按默认的 100 个、1 分钟衰减统计
+  - 副本保存在容量为 maxBytes 的独立 LRU 缓存中，ttl 后过期（不超过条目的 TTL），不占用主缓存
+  - 其他节点上的 Set、Delete 不会通知副本，副本最多滞后 ttl，ttl 应当较短
+*/
+func WithHotKeyReplication(minCount int64, maxBytes int64, ttl time.Duration) GroupOption {
+	return func(o *groupOptions) {
+		o.replicaMinCount = minCount
+		o.replicaBytes = maxBytes
+		o.replicaTTL = ttl
+	}
+}
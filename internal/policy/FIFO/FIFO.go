@@ -4,80 +4,193 @@ import (
 	"container/list"
 	"gocache/internal/policy/interfaces"
 	"time"
+	"unsafe"
 )
 
+// EntryOverhead 每个条目的结构开销：链表节点、Entry、写入时间、过期时间、map 槽位和 Value 装箱
+var EntryOverhead = interfaces.AllocSize(int64(unsafe.Sizeof(list.Element{}))) +
+	interfaces.AllocSize(int64(unsafe.Sizeof(interfaces.Entry{}))) +
+	2*interfaces.AllocSize(int64(unsafe.Sizeof(time.Time{}))) +
+	interfaces.MapSlotOverhead + interfaces.ValueBoxOverhead
+
 type fifoCahce struct {
-	maxBytes  int64
-	usedBytes int64
-	ll        *list.List
-	cache     map[string]*list.Element
+	maxBytes   int64
+	usedBytes  int64
+	maxEntries int
+	ttl        time.Duration
+	sizer      interfaces.Sizer
+	ll         *list.List
+	cache      map[string]*list.Element
+	expirer    *interfaces.Expirer
 	// optional and executed when an entry is purged.
 	// 回调函数，采用依赖注入的方式，该函数用于处理从缓存中淘汰的数据
 	OnEvicted func(key string, value interfaces.Value)
 }
 
-func NewFIFOCache(maxBytes int64, onEvicted func(key string, value interfaces.Value)) *fifoCahce {
-	return &fifoCahce{
-		maxBytes:  maxBytes,
-		ll:        list.New(),
-		cache:     make(map[string]*list.Element),
-		OnEvicted: onEvicted,
+func NewFIFOCache(maxBytes int64, onEvicted func(key string, value interfaces.Value), opts ...interfaces.Option) *fifoCahce {
+	o := interfaces.NewOptions(opts...)
+	f := &fifoCahce{
+		maxBytes:   maxBytes,
+		maxEntries: o.MaxEntries,
+		ttl:        o.TTL,
+		sizer:      o.Sizer,
+		ll:         list.New(),
+		cache:      make(map[string]*list.Element),
+		OnEvicted:  onEvicted,
+	}
+	f.expirer = interfaces.NewExpirer(o, f.expire)
+	return f
+}
+
+// expire 时间轮触发的过期回调，条目在此期间被重新写入时不做处理
+func (f *fifoCahce) expire(key string) {
+	if elem, ok := f.cache[key]; ok && elem.Value.(*interfaces.Entry).Outdated() {
+		f.removeElement(elem)
+	}
+}
+
+// size 计算条目大小，未设置 Sizer 时只统计 key 和 value 的字节数
+func (f *fifoCahce) size(key string, value interfaces.Value) int64 {
+	if f.sizer == nil {
+		return interfaces.BytesSizer.Size(key, value)
+	}
+	return f.sizer.Size(key, value)
+}
+
+// overflow 判断是否超出容量或条目数上限
+func (f *fifoCahce) overflow() bool {
+	if f.ll.Len() == 0 {
+		return false
 	}
+	return (f.maxBytes != 0 && f.usedBytes > f.maxBytes) || (f.maxEntries != 0 && f.ll.Len() > f.maxEntries)
 }
 
 func (f *fifoCahce) Get(key string) (value interfaces.Value, updateAt *time.Time, ok bool) {
 	if elem, ok := f.cache[key]; ok {
 		e := elem.Value.(*interfaces.Entry)
+		if e.Outdated() {
+			f.removeElement(elem)
+			return nil, nil, false
+		}
+		e.Hits++
 		return e.Value, e.UpdateAt, ok
 	}
 	return
 }
 
-func (f *fifoCahce) Add(key string, value interfaces.Value) {
+func (f *fifoCahce) Peek(key string) (interfaces.Entry, bool) {
 	if elem, ok := f.cache[key]; ok {
-		//更新cache
-		f.usedBytes += int64(value.Len()) - int64(elem.Value.(*interfaces.Entry).Value.Len())
-		elem.Value.(*interfaces.Entry).Value = value
-	} else {
-		kv := &interfaces.Entry{Key: key, Value: value, UpdateAt: nil}
-		kv.Touch()
-		elem := f.ll.PushBack(kv)
-		f.cache[key] = elem
-		f.usedBytes += int64(value.Len()) + int64(kv.Value.Len())
+		if e := elem.Value.(*interfaces.Entry); !e.Outdated() {
+			return *e, true
+		}
 	}
+	return interfaces.Entry{}, false
+}
 
-	for f.maxBytes != 0 && f.usedBytes > f.maxBytes {
+func (f *fifoCahce) Add(key string, value interfaces.Value) {
+	kv := f.add(key, value)
+	kv.ExpireAfter(f.ttl)
+	f.expirer.Schedule(key, kv.ExpireAt)
+	for f.overflow() {
 		f.RemoveFront()
 	}
 }
 
+// add 写入新条目或更新已有条目的值，更新不改变条目在队列中的位置，过期时间由调用方设置
+func (f *fifoCahce) add(key string, value interfaces.Value) *interfaces.Entry {
+	if elem, ok := f.cache[key]; ok {
+		//更新cache
+		kv := elem.Value.(*interfaces.Entry)
+		f.usedBytes += f.size(key, value) - f.size(key, kv.Value)
+		kv.Value = value
+		kv.Hits++
+		return kv
+	}
+	kv := &interfaces.Entry{Key: key, Value: value, UpdateAt: nil, Hits: 1}
+	kv.Touch()
+	f.cache[key] = f.ll.PushBack(kv)
+	f.usedBytes += f.size(key, value)
+	return kv
+}
+
 func (f *fifoCahce) CleanUp(ttl time.Duration) {
-	for e := f.ll.Front(); e != nil; e = e.Next() {
+	// 条目按写入顺序排列，但绝对过期时间可能各不相同，需要遍历整个队列
+	for e := f.ll.Front(); e != nil; {
+		next := e.Next()
 		if e.Value.(*interfaces.Entry).Expired(ttl) {
-			kv := f.ll.Remove(e).(*interfaces.Entry)
-			delete(f.cache, kv.Key)
-			f.usedBytes -= int64(len(kv.Key)) + int64(kv.Value.Len())
-			if f.OnEvicted != nil {
-				f.OnEvicted(kv.Key, kv.Value)
-			}
-		} else {
-			break
+			f.removeElement(e)
 		}
-
+		e = next
 	}
 }
 func (f *fifoCahce) RemoveFront() {
-	elem := f.ll.Front()
-	if elem != nil {
-		kv := f.ll.Remove(elem).(*interfaces.Entry)
-		delete(f.cache, kv.Key)
-		f.usedBytes -= int64(len(kv.Key)) + int64(kv.Value.Len())
-		if f.OnEvicted != nil {
-			f.OnEvicted(kv.Key, kv.Value)
-		}
+	if elem := f.ll.Front(); elem != nil {
+		f.removeElement(elem)
 	}
 }
 
+// removeElement 移除节点，取消其过期任务并触发 OnEvicted
+func (f *fifoCahce) removeElement(elem *list.Element) {
+	kv := f.ll.Remove(elem).(*interfaces.Entry)
+	delete(f.cache, kv.Key)
+	f.expirer.Cancel(kv.Key)
+	f.usedBytes -= f.size(kv.Key, kv.Value)
+	if f.OnEvicted != nil {
+		f.OnEvicted(kv.Key, kv.Value)
+	}
+}
+
+// Delete 删除指定条目
+func (f *fifoCahce) Delete(key string) bool {
+	if elem, ok := f.cache[key]; ok {
+		f.removeElement(elem)
+		return true
+	}
+	return false
+}
+
+// AddEntry 写入条目并保留其写入时间、过期时间和访问次数，已经过期的条目直接丢弃
+func (f *fifoCahce) AddEntry(entry interfaces.Entry) {
+	if entry.Outdated() {
+		return
+	}
+	kv := f.add(entry.Key, entry.Value)
+	kv.Restore(entry.UpdateAt)
+	kv.RestoreExpire(entry.ExpireAt)
+	kv.RestoreHits(entry.Hits)
+	f.expirer.Schedule(kv.Key, kv.ExpireAt)
+	for f.overflow() {
+		f.RemoveFront()
+	}
+}
+
+func (f *fifoCahce) Purge() {
+	f.expirer.CancelAll()
+	f.ll.Init()
+	f.cache = make(map[string]*list.Element)
+	f.usedBytes = 0
+}
+
+// Entries 从最新写入到最早写入依次返回条目，最早写入的条目最先被淘汰
+func (f *fifoCahce) Entries() []interfaces.Entry {
+	entries := make([]interfaces.Entry, 0, f.ll.Len())
+	for e := f.ll.Back(); e != nil; e = e.Prev() {
+		entries = append(entries, *e.Value.(*interfaces.Entry))
+	}
+	return entries
+}
+
 func (f *fifoCahce) Len() int {
 	return f.ll.Len()
 }
+
+func (f *fifoCahce) UsedBytes() int64 {
+	return f.usedBytes
+}
+
+func (f *fifoCahce) SetMaxBytes(maxBytes int64) {
+	f.maxBytes = maxBytes
+	for f.overflow() {
+		f.RemoveFront()
+	}
+}
@@ -3,29 +3,73 @@ package LFU
 import (
 	"container/heap"
 	"gocache/internal/policy/interfaces"
+	"sort"
 	"time"
+	"unsafe"
 )
 
+// EntryOverhead 每个条目的结构开销：lfuEntry、更新时间、过期时间、map 槽位、堆数组槽位（含扩容余量）和 Value 装箱
+var EntryOverhead = interfaces.AllocSize(int64(unsafe.Sizeof(lfuEntry{}))) +
+	2*interfaces.AllocSize(int64(unsafe.Sizeof(time.Time{}))) +
+	interfaces.MapSlotOverhead + 2*int64(unsafe.Sizeof(uintptr(0))) + interfaces.ValueBoxOverhead
+
 type LFUCache struct {
-	maxBytes  int64 //允许使用的最大内存
-	usedBytes int64 //已经使用的内存
-	cache     map[string]*lfuEntry
-	pq        *priorityqueue
-	OnEvicted func(key string, value interfaces.Value)
+	maxBytes   int64 //允许使用的最大内存
+	usedBytes  int64 //已经使用的内存
+	maxEntries int   //允许的最大条目数，0 表示不限制
+	ttl        time.Duration
+	sizer      interfaces.Sizer
+	cache      map[string]*lfuEntry
+	pq         *priorityqueue
+	expirer    *interfaces.Expirer
+	OnEvicted  func(key string, value interfaces.Value)
 }
 
-func NewLFUCache(maxBytes int64, onEvicted func(string, interfaces.Value)) *LFUCache {
+func NewLFUCache(maxBytes int64, onEvicted func(string, interfaces.Value), opts ...interfaces.Option) *LFUCache {
+	o := interfaces.NewOptions(opts...)
 	queue := priorityqueue(make([]*lfuEntry, 0))
-	return &LFUCache{
-		maxBytes:  maxBytes,
-		pq:        &queue,
-		cache:     make(map[string]*lfuEntry),
-		OnEvicted: onEvicted,
+	lfu := &LFUCache{
+		maxBytes:   maxBytes,
+		maxEntries: o.MaxEntries,
+		ttl:        o.TTL,
+		sizer:      o.Sizer,
+		pq:         &queue,
+		cache:      make(map[string]*lfuEntry),
+		OnEvicted:  onEvicted,
+	}
+	lfu.expirer = interfaces.NewExpirer(o, lfu.expire)
+	return lfu
+}
+
+// expire 时间轮触发的过期回调，条目在此期间被重新写入时不做处理
+func (p *LFUCache) expire(key string) {
+	if e, ok := p.cache[key]; ok && e.entry.Outdated() {
+		p.remove(e)
+	}
+}
+
+// size 计算条目大小，未设置 Sizer 时只统计 key 和 value 的字节数
+func (p *LFUCache) size(key string, value interfaces.Value) int64 {
+	if p.sizer == nil {
+		return interfaces.BytesSizer.Size(key, value)
+	}
+	return p.sizer.Size(key, value)
+}
+
+// overflow 判断是否超出容量或条目数上限
+func (p *LFUCache) overflow() bool {
+	if p.pq.Len() == 0 {
+		return false
 	}
+	return (p.maxBytes != 0 && p.maxBytes < p.usedBytes) || (p.maxEntries != 0 && p.maxEntries < p.pq.Len())
 }
 
 func (p *LFUCache) Get(key string) (value interfaces.Value, updateAt *time.Time, ok bool) {
 	if e, ok := p.cache[key]; ok {
+		if e.entry.Outdated() {
+			p.remove(e)
+			return nil, nil, false
+		}
 		e.Referenced()
 		heap.Fix(p.pq, e.index)
 		return e.entry.Value, e.entry.UpdateAt, ok
@@ -33,47 +77,130 @@ func (p *LFUCache) Get(key string) (value interfaces.Value, updateAt *time.Time,
 	return
 }
 
+func (p *LFUCache) Peek(key string) (interfaces.Entry, bool) {
+	if e, ok := p.cache[key]; ok && !e.entry.Outdated() {
+		return e.snapshot(), true
+	}
+	return interfaces.Entry{}, false
+}
+
 func (p *LFUCache) Add(key string, value interfaces.Value) {
+	e := p.add(key, value)
+	e.entry.ExpireAfter(p.ttl)
+	p.expirer.Schedule(key, e.entry.ExpireAt)
+	for p.overflow() {
+		p.Remove()
+	}
+}
+
+// add 写入新条目或更新已有条目的值，两种情况都计一次访问，过期时间由调用方设置
+func (p *LFUCache) add(key string, value interfaces.Value) *lfuEntry {
 	if e, ok := p.cache[key]; ok {
-		p.usedBytes += int64(value.Len()) - int64(e.entry.Value.Len())
+		p.usedBytes += p.size(key, value) - p.size(key, e.entry.Value)
 		e.entry.Value = value
 		e.Referenced()
 		heap.Fix(p.pq, e.index)
-	} else {
-		e := &lfuEntry{0, interfaces.Entry{Key: key, Value: value, UpdateAt: nil}, 0}
-		e.Referenced()
-		heap.Push(p.pq, e)
-		p.cache[key] = e
-		p.usedBytes += int64(len(e.entry.Key)) + int64(e.entry.Value.Len())
-	}
-
-	for p.maxBytes != 0 && p.maxBytes < p.usedBytes {
-		p.Remove()
+		return e
 	}
+	e := &lfuEntry{0, interfaces.Entry{Key: key, Value: value, UpdateAt: nil}, 0}
+	e.Referenced()
+	heap.Push(p.pq, e)
+	p.cache[key] = e
+	p.usedBytes += p.size(key, value)
+	return e
 }
 
 func (p *LFUCache) CleanUp(ttl time.Duration) {
+	// heap.Remove 会调整堆内元素的位置，不能边遍历边删除，先收集过期条目
+	expired := make([]*lfuEntry, 0)
 	for _, e := range *p.pq {
 		if e.entry.Expired(ttl) {
-			kv := heap.Remove(p.pq, e.index).(*lfuEntry).entry
-			delete(p.cache, kv.Key)
-			p.usedBytes -= int64(len(kv.Key)) + int64(kv.Value.Len())
-			if p.OnEvicted != nil {
-				p.OnEvicted(kv.Key, kv.Value)
-			}
+			expired = append(expired, e)
 		}
 	}
+	for _, e := range expired {
+		p.remove(e)
+	}
 }
 
+// Remove 淘汰访问次数最少的条目
 func (p *LFUCache) Remove() {
-	e := heap.Pop(p.pq).(*lfuEntry)
+	p.remove((*p.pq)[0])
+}
+
+// remove 从堆中移除条目，取消其过期任务并触发 OnEvicted
+func (p *LFUCache) remove(e *lfuEntry) {
+	heap.Remove(p.pq, e.index)
 	delete(p.cache, e.entry.Key)
-	p.usedBytes -= int64(len(e.entry.Key)) + int64(e.entry.Value.Len())
+	p.expirer.Cancel(e.entry.Key)
+	p.usedBytes -= p.size(e.entry.Key, e.entry.Value)
 	if p.OnEvicted != nil {
 		p.OnEvicted(e.entry.Key, e.entry.Value)
 	}
 }
 
+// Delete 删除指定条目
+func (p *LFUCache) Delete(key string) bool {
+	if e, ok := p.cache[key]; ok {
+		p.remove(e)
+		return true
+	}
+	return false
+}
+
+/*
+AddEntry 写入条目并保留其更新时间、过期时间和访问次数，已经过期的条目直接丢弃
+  - 访问次数取 entry.Hits 和本次写入后的次数中较大的一个，从其他策略切换过来时保留已经统计的访问频率
+*/
+func (p *LFUCache) AddEntry(entry interfaces.Entry) {
+	if entry.Outdated() {
+		return
+	}
+	e := p.add(entry.Key, entry.Value)
+	e.entry.Restore(entry.UpdateAt)
+	e.count = max(e.count, entry.Hits)
+	heap.Fix(p.pq, e.index)
+	e.entry.RestoreExpire(entry.ExpireAt)
+	p.expirer.Schedule(entry.Key, e.entry.ExpireAt)
+	for p.overflow() {
+		p.Remove()
+	}
+}
+
+func (p *LFUCache) Purge() {
+	p.expirer.CancelAll()
+	queue := priorityqueue(make([]*lfuEntry, 0))
+	p.pq = &queue
+	p.cache = make(map[string]*lfuEntry)
+	p.usedBytes = 0
+}
+
+// Entries 按访问次数从多到少返回条目，次数相同时最近访问的在前，与淘汰顺序相反
+func (p *LFUCache) Entries() []interfaces.Entry {
+	sorted := make([]*lfuEntry, len(*p.pq))
+	copy(sorted, *p.pq)
+	sort.Slice(sorted, func(i, j int) bool {
+		return priorityqueue(sorted).Less(j, i)
+	})
+
+	entries := make([]interfaces.Entry, 0, len(sorted))
+	for _, e := range sorted {
+		entries = append(entries, e.snapshot())
+	}
+	return entries
+}
+
 func (p *LFUCache) Len() int {
 	return p.pq.Len()
 }
+
+func (p *LFUCache) UsedBytes() int64 {
+	return p.usedBytes
+}
+
+func (p *LFUCache) SetMaxBytes(maxBytes int64) {
+	p.maxBytes = maxBytes
+	for p.overflow() {
+		p.Remove()
+	}
+}
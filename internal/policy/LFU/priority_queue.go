@@ -15,6 +15,13 @@ func (l *lfuEntry) Referenced() {
 	l.entry.Touch()
 }
 
+// snapshot 返回条目的拷贝，Hits 为当前的访问次数
+func (l *lfuEntry) snapshot() interfaces.Entry {
+	e := l.entry
+	e.Hits = l.count
+	return e
+}
+
 func (pq priorityqueue) Less(i, j int) bool {
 	if pq[i].count == pq[j].count {
 		return pq[i].entry.UpdateAt.Before(*pq[j].entry.UpdateAt)
@@ -39,12 +46,8 @@ func (pq *priorityqueue) Pop() interface{} {
 	//避免内存泄露
 	oldpq[n-1] = nil
 
-	newpq := oldpq[:n-1]
-
-	for i := 0; i < len(newpq); i++ {
-		newpq[i].index = i
-	}
-	*pq = newpq
+	// 其余元素的下标已经在 Swap 中维护，无需重新编号
+	*pq = oldpq[:n-1]
 	return entry
 }
 
@@ -2,63 +2,83 @@ package LRU
 
 import (
 	"container/list"
-	"gocache/config"
 	"gocache/internal/policy/interfaces"
-	"gocache/utils/logger"
-	"log"
-	"sync"
 	"time"
+	"unsafe"
 )
 
+// EntryOverhead 每个条目的结构开销：链表节点、Entry、更新时间、过期时间、map 槽位和 Value 装箱
+var EntryOverhead = interfaces.AllocSize(int64(unsafe.Sizeof(list.Element{}))) +
+	interfaces.AllocSize(int64(unsafe.Sizeof(interfaces.Entry{}))) +
+	2*interfaces.AllocSize(int64(unsafe.Sizeof(time.Time{}))) +
+	interfaces.MapSlotOverhead + interfaces.ValueBoxOverhead
+
 /*
 LRUCache
   - map:存储键值映射关系，根据key查找value
   - 队列：双向链表实现，将所有值放入双向链表，访问某值，将其移动到队尾
+  - 过期：条目的过期时间登记在共享的时间轮上，到期后主动淘汰，不再定期遍历整个链表
 */
 type LRUCache struct {
-	maxBytes  int64      //允许使用的最大内存
-	usedBytes int64      //已经使用的内存
-	ll        *list.List //双向链表
-	mu        sync.RWMutex
-	cache     map[string]*list.Element
+	maxBytes   int64 //允许使用的最大内存
+	usedBytes  int64 //已经使用的内存
+	maxEntries int   //允许的最大条目数，0 表示不限制
+	ttl        time.Duration
+	sizer      interfaces.Sizer
+	ll         *list.List //双向链表
+	cache      map[string]*list.Element
+	expirer    *interfaces.Expirer
 
 	// 回调函数，采用依赖注入的方式，该函数用于处理从缓存中淘汰的数据
 	OnEvicted func(key string, value interfaces.Value)
 }
 
 func (c *LRUCache) usedLen(kv *interfaces.Entry) int64 {
-	return int64(len(kv.Key)) + int64(kv.Value.Len())
+	return c.size(kv.Key, kv.Value)
+}
+
+// size 计算条目大小，未设置 Sizer 时只统计 key 和 value 的字节数
+func (c *LRUCache) size(key string, value interfaces.Value) int64 {
+	if c.sizer == nil {
+		return interfaces.BytesSizer.Size(key, value)
+	}
+	return c.sizer.Size(key, value)
+}
+
+// overflow 判断是否超出容量或条目数上限
+func (c *LRUCache) overflow() bool {
+	if c.ll.Len() == 0 {
+		return false
+	}
+	return (c.maxBytes != 0 && c.maxBytes < c.usedBytes) || (c.maxEntries != 0 && c.maxEntries < c.ll.Len())
 }
 
 /*
 NewLRUCache
   - Cache的构造函数
 */
-func NewLRUCache(maxBytes int64, onEvicted func(string, interfaces.Value)) *LRUCache {
+func NewLRUCache(maxBytes int64, onEvicted func(string, interfaces.Value), opts ...interfaces.Option) *LRUCache {
+	o := interfaces.NewOptions(opts...)
 	lru := &LRUCache{
-		maxBytes:  maxBytes,
-		ll:        list.New(),
-		cache:     make(map[string]*list.Element),
-		OnEvicted: onEvicted,
-	}
-	ttl := time.Duration(config.Conf.Services["groupcache"].TTL)
-	//ttl := time.Duration(30)
-	log.Printf("set ttl is %d s", ttl)
-
-	go func() {
-		ticker := time.NewTicker(time.Minute * 2)
-		defer ticker.Stop()
-
-		for {
-			<-ticker.C
-			lru.CleanUp(ttl)
-			logger.LogrusObj.Warnf("触发过期缓存，清理后台任务......")
-		}
-	}()
-
+		maxBytes:   maxBytes,
+		maxEntries: o.MaxEntries,
+		ttl:        o.TTL,
+		sizer:      o.Sizer,
+		ll:         list.New(),
+		cache:      make(map[string]*list.Element),
+		OnEvicted:  onEvicted,
+	}
+	lru.expirer = interfaces.NewExpirer(o, lru.expire)
 	return lru
 }
 
+// expire 时间轮触发的过期回调，条目在此期间被重新写入时不做处理
+func (c *LRUCache) expire(key string) {
+	if element, ok := c.cache[key]; ok && element.Value.(*interfaces.Entry).Outdated() {
+		c.removeElement(element)
+	}
+}
+
 /*
 Get
 
@@ -67,88 +87,153 @@ Get
 */
 func (c *LRUCache) Get(key string) (value interfaces.Value, updateAt *time.Time, ok bool) {
 	if element, ok := c.cache[key]; ok {
-		c.ll.MoveToFront(element)
 		kv := element.Value.(*interfaces.Entry)
+		// 时间轮按 tick 触发，Get 时再精确判断一次
+		if kv.Outdated() {
+			c.removeElement(element)
+			return nil, nil, false
+		}
+		c.ll.MoveToFront(element)
 		kv.Touch()
+		kv.Hits++
 		return kv.Value, kv.UpdateAt, ok
 	}
 	return
 }
 
+func (c *LRUCache) Peek(key string) (interfaces.Entry, bool) {
+	if element, ok := c.cache[key]; ok {
+		if kv := element.Value.(*interfaces.Entry); !kv.Outdated() {
+			return *kv, true
+		}
+	}
+	return interfaces.Entry{}, false
+}
+
 /*
 RemoveOldest
   移除最近、最少被访问的节点（队首）
 */
 
 func (c *LRUCache) RemoveOldest() {
-	element := c.ll.Back()
-	if element != nil {
-		c.mu.Lock()
-		//还有 CleanUp 并发 goroutine 的过期淘汰策略，
-		//因此需要进行并发安全双检，否则对 nil interface 进行断言直接触发
-		//panic
-		if element == nil {
-			c.mu.Unlock()
-			return
-		}
-		//c.ll.Remove(element)
-		if kv, ok := element.Value.(*interfaces.Entry); ok {
-			delete(c.cache, kv.Key)
-			//c.usedBytes -= int64(len(kv.key)) + int64(kv.value.Len())
-			c.usedBytes -= c.usedLen(kv)
-			if c.OnEvicted != nil {
-				c.OnEvicted(kv.Key, kv.Value)
-			}
-		}
-		c.mu.Unlock()
+	if element := c.ll.Back(); element != nil {
+		c.removeElement(element)
+	}
+}
+
+// removeElement 移除节点，取消其过期任务并触发 OnEvicted
+func (c *LRUCache) removeElement(element *list.Element) {
+	c.ll.Remove(element)
+	kv := element.Value.(*interfaces.Entry)
+	delete(c.cache, kv.Key)
+	c.expirer.Cancel(kv.Key)
+	c.usedBytes -= c.usedLen(kv)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.Key, kv.Value)
+	}
+}
+
+// Delete 删除指定条目
+func (c *LRUCache) Delete(key string) bool {
+	if element, ok := c.cache[key]; ok {
+		c.removeElement(element)
+		return true
 	}
+	return false
 }
 
 /*
 Add
 
-	向Cache中添加value
+	向Cache中添加value，条目在 ttl 之后过期
 */
 func (c *LRUCache) Add(key string, value interfaces.Value) {
+	kv := c.add(key, value)
+	kv.ExpireAfter(c.ttl)
+	c.expirer.Schedule(key, kv.ExpireAt)
+	for c.overflow() {
+		c.RemoveOldest()
+	}
+}
+
+// add 写入或更新条目并移动到队首，过期时间由调用方设置
+func (c *LRUCache) add(key string, value interfaces.Value) *interfaces.Entry {
 	if element, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(element)
-		if kv, isOK := element.Value.(*interfaces.Entry); isOK {
-			kv.Touch()
-			c.usedBytes += int64(value.Len()) - int64(kv.Value.Len())
-			//c.usedBytes += c.usedLen(kv)
-			kv.Value = value
-		}
-	} else {
-		kv := &interfaces.Entry{Key: key, Value: value}
+		kv := element.Value.(*interfaces.Entry)
 		kv.Touch()
-		element := c.ll.PushFront(kv)
-		c.cache[key] = element
-		c.usedBytes += int64(len(key)) + int64(value.Len())
+		kv.Hits++
+		c.usedBytes += c.size(key, value) - c.usedLen(kv)
+		kv.Value = value
+		return kv
+	}
+	kv := &interfaces.Entry{Key: key, Value: value, Hits: 1}
+	kv.Touch()
+	c.cache[key] = c.ll.PushFront(kv)
+	c.usedBytes += c.usedLen(kv)
+	return kv
+}
+
+/*
+AddEntry
+
+	写入条目并保留其更新时间、过期时间和访问次数，新条目位于队首，已经过期的条目直接丢弃
+*/
+func (c *LRUCache) AddEntry(entry interfaces.Entry) {
+	if entry.Outdated() {
+		return
 	}
-	for c.maxBytes != 0 && c.maxBytes < c.usedBytes {
+	kv := c.add(entry.Key, entry.Value)
+	kv.Restore(entry.UpdateAt)
+	kv.RestoreExpire(entry.ExpireAt)
+	kv.RestoreHits(entry.Hits)
+	c.expirer.Schedule(kv.Key, kv.ExpireAt)
+	for c.overflow() {
 		c.RemoveOldest()
 	}
 }
 
+/*
+Entries
+
+	从队首（最近访问）到队尾（最久未访问）依次返回条目
+*/
+func (c *LRUCache) Entries() []interfaces.Entry {
+	entries := make([]interfaces.Entry, 0, c.ll.Len())
+	for e := c.ll.Front(); e != nil; e = e.Next() {
+		entries = append(entries, *e.Value.(*interfaces.Entry))
+	}
+	return entries
+}
+
 func (c *LRUCache) Len() int {
 	return c.ll.Len()
 }
 
+func (c *LRUCache) UsedBytes() int64 {
+	return c.usedBytes
+}
+
 func (c *LRUCache) CleanUp(ttl time.Duration) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
 	for e := c.ll.Back(); e != nil; {
 		next := e.Prev()
-		if entry, ok := e.Value.(*interfaces.Entry); ok && entry != nil {
-			if entry.Expired(ttl) {
-				c.ll.Remove(e)
-				delete(c.cache, entry.Key)
-				c.usedBytes -= c.usedLen(entry)
-				if c.OnEvicted != nil {
-					c.OnEvicted(entry.Key, entry.Value)
-				}
-			}
+		if e.Value.(*interfaces.Entry).Expired(ttl) {
+			c.removeElement(e)
 		}
 		e = next
 	}
 }
+
+func (c *LRUCache) Purge() {
+	c.expirer.CancelAll()
+	c.ll.Init()
+	c.cache = make(map[string]*list.Element)
+	c.usedBytes = 0
+}
+
+func (c *LRUCache) SetMaxBytes(maxBytes int64) {
+	c.maxBytes = maxBytes
+	for c.overflow() {
+		c.RemoveOldest()
+	}
+}
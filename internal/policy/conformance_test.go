@@ -0,0 +1,447 @@
+package policy
+
+import (
+	"fmt"
+	"gocache/internal/policy/interfaces"
+	"gocache/internal/timingwheel"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (s String) Len() int {
+	return len(s)
+}
+
+type Bytes []byte
+
+func (b Bytes) Len() int {
+	return len(b)
+}
+
+/*
+conformance 对 New 中注册的每一种淘汰策略运行同一组用例，保证各策略对外行为一致：
+  - 字节统计：新增、更新、淘汰后 UsedBytes 与条目实际大小一致
+  - 淘汰回调：超出容量时按条目回调 OnEvicted，被淘汰的 key 不可再读到
+  - 过期清理：CleanUp 移除过期条目、回调并归还字节
+  - 原地更新：重复 Add 同一个 key 只更新值，不新增条目
+  - 删除：Delete 移除指定条目、回调并归还字节
+  - 查看：Peek 返回条目但不改变条目的价值排序
+  - 迁移：Entries、AddEntry 保留更新时间和访问次数，切换到 LFU 后按迁移前的访问频率淘汰
+  - TTL：过期条目在 Get 时不可见；登记到时间轮后到期主动淘汰，重新写入会推迟过期
+*/
+func conformance(t *testing.T, run func(t *testing.T, name string)) {
+	for _, name := range Names() {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			run(t, name)
+		})
+	}
+}
+
+func TestConformanceRegistered(t *testing.T) {
+	conformance(t, func(t *testing.T, name string) {
+		if New(name, 0, nil) == nil {
+			t.Fatalf("policy %s registered but New returns nil", name)
+		}
+		if New(strings.ToUpper(name), 0, nil) == nil {
+			t.Fatalf("policy name %s should be case insensitive", name)
+		}
+	})
+	if New("unknown", 0, nil) != nil {
+		t.Fatal("unknown policy should return nil")
+	}
+}
+
+func TestConformanceByteAccounting(t *testing.T) {
+	conformance(t, func(t *testing.T, name string) {
+		c := New(name, 0, nil)
+		c.Add("k1", String("1234"))
+		c.Add("key2", String("123456"))
+		if want := int64(len("k1"+"1234") + len("key2"+"123456")); c.UsedBytes() != want {
+			t.Fatalf("used bytes = %d, want %d", c.UsedBytes(), want)
+		}
+
+		c.Add("k1", String("1"))
+		if want := int64(len("k1"+"1") + len("key2"+"123456")); c.UsedBytes() != want {
+			t.Fatalf("used bytes after update = %d, want %d", c.UsedBytes(), want)
+		}
+	})
+}
+
+func TestConformanceEviction(t *testing.T) {
+	conformance(t, func(t *testing.T, name string) {
+		evicted := make(map[string]bool)
+		maxBytes := int64(30)
+		c := New(name, maxBytes, func(key string, value interfaces.Value) {
+			if evicted[key] {
+				t.Fatalf("key %s evicted twice", key)
+			}
+			evicted[key] = true
+		})
+
+		for i := 0; i < 10; i++ {
+			c.Add(fmt.Sprintf("key%d", i), String("value"))
+			if c.UsedBytes() > maxBytes {
+				t.Fatalf("used bytes %d exceed max bytes %d", c.UsedBytes(), maxBytes)
+			}
+		}
+
+		if len(evicted)+c.Len() != 10 {
+			t.Fatalf("evicted %d + len %d, want 10 entries in total", len(evicted), c.Len())
+		}
+		if want := int64(c.Len() * len("key0value")); c.UsedBytes() != want {
+			t.Fatalf("used bytes = %d, want %d", c.UsedBytes(), want)
+		}
+		for key := range evicted {
+			if _, _, ok := c.Get(key); ok {
+				t.Fatalf("evicted key %s still readable", key)
+			}
+		}
+	})
+}
+
+func TestConformanceCleanUp(t *testing.T) {
+	conformance(t, func(t *testing.T, name string) {
+		evicted := make([]string, 0)
+		c := New(name, 0, func(key string, value interfaces.Value) {
+			evicted = append(evicted, key)
+		})
+		c.Add("k1", String("v1"))
+		c.Add("k2", String("v2"))
+		c.Add("k3", String("v3"))
+
+		c.CleanUp(time.Hour)
+		if c.Len() != 3 || len(evicted) != 0 {
+			t.Fatalf("CleanUp removed unexpired entries, len = %d", c.Len())
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		c.CleanUp(time.Millisecond)
+		if c.Len() != 0 || c.UsedBytes() != 0 || len(evicted) != 3 {
+			t.Fatalf("CleanUp left len = %d, used bytes = %d, evicted = %v", c.Len(), c.UsedBytes(), evicted)
+		}
+		if _, _, ok := c.Get("k1"); ok {
+			t.Fatal("expired key k1 still readable")
+		}
+	})
+}
+
+func TestConformanceUpdateInPlace(t *testing.T) {
+	conformance(t, func(t *testing.T, name string) {
+		evicted := 0
+		c := New(name, 0, func(string, interfaces.Value) { evicted++ })
+		c.Add("k1", String("old"))
+		c.Add("k1", String("new"))
+
+		if c.Len() != 1 || evicted != 0 {
+			t.Fatalf("update in place changed len to %d, evicted %d", c.Len(), evicted)
+		}
+		if v, updateAt, ok := c.Get("k1"); !ok || v.(String) != "new" || updateAt == nil {
+			t.Fatalf("get k1 = %v, %v, %v", v, updateAt, ok)
+		}
+	})
+}
+
+func TestConformanceDelete(t *testing.T) {
+	conformance(t, func(t *testing.T, name string) {
+		var evicted []string
+		c := New(name, 0, func(key string, _ interfaces.Value) {
+			evicted = append(evicted, key)
+		})
+		c.Add("k1", String("v1"))
+		c.Add("k2", String("v2"))
+		used := c.UsedBytes()
+
+		if !c.Delete("k1") {
+			t.Fatal("Delete should report existing key")
+		}
+		if c.Delete("k1") || c.Delete("missing") {
+			t.Fatal("Delete should report missing key")
+		}
+		if _, _, ok := c.Get("k1"); ok {
+			t.Fatal("deleted key should not be readable")
+		}
+		if _, _, ok := c.Get("k2"); !ok || c.Len() != 1 {
+			t.Fatalf("other keys should be kept, len = %d", c.Len())
+		}
+		if c.UsedBytes() >= used || len(evicted) != 1 || evicted[0] != "k1" {
+			t.Fatalf("used bytes = %d (was %d), evicted = %v", c.UsedBytes(), used, evicted)
+		}
+	})
+}
+
+func TestConformancePeek(t *testing.T) {
+	conformance(t, func(t *testing.T, name string) {
+		c := New(name, 0, nil)
+		for i := 0; i < 3; i++ {
+			c.Add(fmt.Sprintf("key%d", i), String("value"))
+		}
+		c.Get("key2")
+		before := c.Entries()
+
+		for i := 0; i < 3; i++ {
+			e, ok := c.Peek("key0")
+			if !ok || e.Key != "key0" || e.Value.(String) != "value" {
+				t.Fatalf("Peek(key0) = %v, %v", e, ok)
+			}
+		}
+		if _, ok := c.Peek("missing"); ok {
+			t.Fatal("Peek should report missing key")
+		}
+		after := c.Entries()
+		for i := range before {
+			if before[i].Key != after[i].Key {
+				t.Fatalf("Peek changed the order: %v -> %v", keysOf(before), keysOf(after))
+			}
+		}
+	})
+}
+
+func keysOf(entries []interfaces.Entry) []string {
+	keys := make([]string, len(entries))
+	for i, e := range entries {
+		keys[i] = e.Key
+	}
+	return keys
+}
+
+func TestConformanceMigrate(t *testing.T) {
+	conformance(t, func(t *testing.T, src string) {
+		for _, dst := range Names() {
+			from := New(src, 0, nil)
+			for i := 0; i < 5; i++ {
+				from.Add(fmt.Sprintf("key%d", i), String("value"))
+			}
+			// 访问 key4 使其成为各策略下价值最高的条目
+			from.Get("key4")
+			entries := from.Entries()
+			if len(entries) != 5 || entries[0].Key != "key4" {
+				t.Fatalf("%s entries should start with the most valuable key4, got %v", src, entries)
+			}
+
+			// 目标容量只够放两个条目
+			to := New(dst, int64(2*len("key0value")), nil)
+			Migrate(to, from)
+			if to.Len() != 2 || to.UsedBytes() != int64(2*len("key0value")) {
+				t.Fatalf("%s -> %s: len = %d, used bytes = %d", src, dst, to.Len(), to.UsedBytes())
+			}
+			migrated := to.Entries()
+			if migrated[0].Key != "key4" || !migrated[0].UpdateAt.Equal(*entries[0].UpdateAt) {
+				t.Fatalf("%s -> %s: most valuable key4 lost or update time changed, got %v", src, dst, migrated)
+			}
+		}
+	})
+}
+
+func TestConformanceMigrateHits(t *testing.T) {
+	conformance(t, func(t *testing.T, src string) {
+		from := New(src, 0, nil)
+		for i := 0; i < 3; i++ {
+			from.Add(fmt.Sprintf("key%d", i), String("value"))
+		}
+		for i := 0; i < 4; i++ {
+			from.Get("key0")
+		}
+		if e, _ := from.Peek("key0"); e.Hits != 5 {
+			t.Fatalf("%s: key0 hits = %d, expect 5 (1 add + 4 gets)", src, e.Hits)
+		}
+
+		// 切换到 LFU 后保留访问次数，新写入的条目先淘汰访问少的 key1、key2，而不是 key0
+		to := New("lfu", int64(3*len("key0value")), nil)
+		Migrate(to, from)
+		if e, ok := to.Peek("key0"); !ok || e.Hits != 5 {
+			t.Fatalf("%s -> lfu: key0 = %+v, %v, expect 5 hits", src, e, ok)
+		}
+		to.Add("key3", String("value"))
+		to.Add("key4", String("value"))
+		if _, ok := to.Peek("key0"); !ok {
+			t.Fatalf("%s -> lfu: the most frequently used key0 was evicted, left %v", src, keysOf(to.Entries()))
+		}
+	})
+}
+
+func TestConformanceSetMaxBytes(t *testing.T) {
+	conformance(t, func(t *testing.T, name string) {
+		evicted := 0
+		c := New(name, 0, func(string, interfaces.Value) { evicted++ })
+		for i := 0; i < 5; i++ {
+			c.Add(fmt.Sprintf("key%d", i), String("value"))
+		}
+
+		c.SetMaxBytes(int64(2 * len("key0value")))
+		if c.Len() != 2 || evicted != 3 || c.UsedBytes() != int64(2*len("key0value")) {
+			t.Fatalf("shrink: len = %d, evicted = %d, used bytes = %d", c.Len(), evicted, c.UsedBytes())
+		}
+
+		c.SetMaxBytes(0)
+		c.Add("key5", String("value"))
+		if c.Len() != 3 || evicted != 3 {
+			t.Fatalf("grow: len = %d, evicted = %d", c.Len(), evicted)
+		}
+	})
+}
+
+func TestConformanceMaxEntries(t *testing.T) {
+	conformance(t, func(t *testing.T, name string) {
+		evicted := 0
+		c := New(name, 0, func(string, interfaces.Value) { evicted++ }, interfaces.WithMaxEntries(3))
+		for i := 0; i < 5; i++ {
+			c.Add(fmt.Sprintf("key%d", i), String("value"))
+		}
+		if c.Len() != 3 || evicted != 2 {
+			t.Fatalf("len = %d, evicted = %d, expect 3 and 2", c.Len(), evicted)
+		}
+	})
+}
+
+func TestConformanceTTL(t *testing.T) {
+	conformance(t, func(t *testing.T, name string) {
+		c := New(name, 0, nil, interfaces.WithTTL(time.Millisecond*20))
+		c.Add("key", String("value"))
+		if _, _, ok := c.Get("key"); !ok {
+			t.Fatal("key should be readable before expiration")
+		}
+		if entries := c.Entries(); len(entries) != 1 || entries[0].ExpireAt == nil {
+			t.Fatalf("entry should carry its expiration, got %v", entries)
+		}
+
+		time.Sleep(time.Millisecond * 30)
+		if _, _, ok := c.Get("key"); ok {
+			t.Fatal("expired key should not be readable")
+		}
+		if c.Len() != 0 || c.UsedBytes() != 0 {
+			t.Fatalf("expired key should be removed on Get, len = %d, used bytes = %d", c.Len(), c.UsedBytes())
+		}
+
+		// 迁移时保留过期时间，已经过期的条目直接丢弃
+		past, future := time.Now().Add(-time.Second), time.Now().Add(time.Hour)
+		c.AddEntry(interfaces.Entry{Key: "past", Value: String("value"), ExpireAt: &past})
+		c.AddEntry(interfaces.Entry{Key: "future", Value: String("value"), ExpireAt: &future})
+		if entries := c.Entries(); len(entries) != 1 || !entries[0].ExpireAt.Equal(future) {
+			t.Fatalf("AddEntry should keep expiration and drop expired entries, got %v", entries)
+		}
+	})
+}
+
+func TestConformanceTimingWheel(t *testing.T) {
+	tw := timingwheel.New(time.Millisecond*5, 8)
+	defer tw.Stop()
+
+	conformance(t, func(t *testing.T, name string) {
+		var mu sync.Mutex
+		evicted := make(map[string]bool)
+		c := New(name, 0, func(key string, value interfaces.Value) { evicted[key] = true },
+			interfaces.WithTTL(time.Millisecond*100), interfaces.WithTimingWheel(tw, &mu))
+
+		mu.Lock()
+		c.Add("expire", String("value"))
+		c.Add("renew", String("value"))
+		c.Add("purge", String("value"))
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond * 50)
+		mu.Lock()
+		c.Add("renew", String("value2"))
+		mu.Unlock()
+
+		// 不调用 Get，由时间轮主动淘汰；renew 在 150ms 时才过期
+		time.Sleep(time.Millisecond * 70)
+		mu.Lock()
+		if !evicted["expire"] || !evicted["purge"] || evicted["renew"] || c.Len() != 1 {
+			t.Fatalf("evicted = %v, len = %d, expect only renew left", evicted, c.Len())
+		}
+		c.Purge()
+		if c.Len() != 0 || c.UsedBytes() != 0 {
+			t.Fatalf("purge: len = %d, used bytes = %d", c.Len(), c.UsedBytes())
+		}
+		mu.Unlock()
+
+		// Purge 取消了 renew 的过期任务，到期后不再回调
+		time.Sleep(time.Millisecond * 60)
+		mu.Lock()
+		defer mu.Unlock()
+		if evicted["renew"] {
+			t.Fatal("purged entries should not be evicted by the timing wheel")
+		}
+	})
+}
+
+// heapInUse 触发 GC 后返回堆上存活对象占用的字节数
+func heapInUse() int64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return int64(m.HeapAlloc)
+}
+
+/*
+TestConformanceMemoryBudget 使用 OverheadSizer 时，写入远超容量的小条目触发大量淘汰后，
+UsedBytes 不超过 maxBytes、与上限相差不到一个条目，并且等于存活条目按 Sizer 计算的大小之和；
+实际占用的堆内存见 TestConformanceMemoryHeap
+*/
+func TestConformanceMemoryBudget(t *testing.T) {
+	conformance(t, func(t *testing.T, name string) {
+		const maxBytes = 1 << 20
+		sizer := OverheadSizer(name)
+		c := New(name, maxBytes, nil, interfaces.WithSizer(sizer))
+		for i := 0; i < 100000; i++ {
+			c.Add(fmt.Sprintf("key%06d", i), Bytes(make([]byte, 32)))
+		}
+
+		// key 等长，每个条目的大小相同
+		entry := sizer.Size("key000000", Bytes(make([]byte, 32)))
+		used := c.UsedBytes()
+		if used > maxBytes || used <= maxBytes-entry {
+			t.Fatalf("used bytes = %d, expect within one entry (%d bytes) of max bytes %d", used, entry, maxBytes)
+		}
+		if want := int64(c.Len()) * entry; used != want {
+			t.Fatalf("used bytes = %d, expect %d entries × %d bytes = %d", used, c.Len(), entry, want)
+		}
+	})
+}
+
+// heapRatio 写入远超容量的小条目触发大量淘汰后，返回缓存实际占用的堆内存与 maxBytes 的比值
+func heapRatio(name string, maxBytes int64) float64 {
+	before := heapInUse()
+	c := New(name, maxBytes, nil, interfaces.WithSizer(OverheadSizer(name)))
+	for i := 0; i < 200000; i++ {
+		c.Add(fmt.Sprintf("key%d", i), Bytes(make([]byte, 32)))
+	}
+	ratio := float64(heapInUse()-before) / float64(maxBytes)
+	runtime.KeepAlive(c)
+	return ratio
+}
+
+/*
+TestConformanceMemoryHeap 使用 OverheadSizer 时，强制 GC 之后缓存实际占用的堆内存不超过 maxBytes 的 1.5 倍，
+Sizer 低估条目的结构开销时失败；堆的测量受运行时影响，-short 时跳过
+*/
+func TestConformanceMemoryHeap(t *testing.T) {
+	if testing.Short() {
+		t.Skip("heap measurement is skipped in short mode")
+	}
+	conformance(t, func(t *testing.T, name string) {
+		const maxBytes = 4 << 20
+		if ratio := heapRatio(name, maxBytes); ratio >= 1.5 {
+			t.Fatalf("heap = %.2f × max bytes, expect the sizer to account for the real memory", ratio)
+		}
+	})
+}
+
+// BenchmarkMemoryBudget 报告 heapRatio，heap/max 应当接近 1
+func BenchmarkMemoryBudget(b *testing.B) {
+	for _, name := range Names() {
+		b.Run(name, func(b *testing.B) {
+			var ratio float64
+			for n := 0; n < b.N; n++ {
+				ratio += heapRatio(name, 4<<20)
+			}
+			b.ReportMetric(ratio/float64(b.N), "heap/max")
+		})
+	}
+}
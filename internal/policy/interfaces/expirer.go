@@ -0,0 +1,70 @@
+package interfaces
+
+import (
+	"gocache/internal/timingwheel"
+	"sync"
+	"time"
+)
+
+/*
+Expirer 为策略实例管理登记在时间轮上的过期任务，每个 key 最多一个任务
+  - 所有方法都应在持有 Options.Locker 时调用，任务触发时同样先获取该锁再回调 expire
+  - 任务触发和重新登记之间存在竞争，expire 回调需要自行确认条目确实已经过期
+  - 未设置时间轮时 NewExpirer 返回 nil，nil 的 Expirer 上所有方法都是空操作
+*/
+type Expirer struct {
+	wheel  *timingwheel.TimingWheel
+	locker sync.Locker
+	expire func(key string)
+	timers map[string]*timingwheel.Timer
+}
+
+func NewExpirer(o Options, expire func(key string)) *Expirer {
+	if o.Wheel == nil || o.Locker == nil {
+		return nil
+	}
+	return &Expirer{
+		wheel:  o.Wheel,
+		locker: o.Locker,
+		expire: expire,
+		timers: make(map[string]*timingwheel.Timer),
+	}
+}
+
+// Schedule 为 key 登记新的过期时间，取消之前的任务，expireAt 为 nil 时只取消
+func (e *Expirer) Schedule(key string, expireAt *time.Time) {
+	if e == nil {
+		return
+	}
+	e.Cancel(key)
+	if expireAt == nil {
+		return
+	}
+	e.timers[key] = e.wheel.AfterFunc(time.Until(*expireAt), func() {
+		e.locker.Lock()
+		defer e.locker.Unlock()
+		e.expire(key)
+	})
+}
+
+// Cancel 取消 key 的过期任务
+func (e *Expirer) Cancel(key string) {
+	if e == nil {
+		return
+	}
+	if t, ok := e.timers[key]; ok {
+		t.Stop()
+		delete(e.timers, key)
+	}
+}
+
+// CancelAll 取消所有过期任务
+func (e *Expirer) CancelAll() {
+	if e == nil {
+		return
+	}
+	for key, t := range e.timers {
+		t.Stop()
+		delete(e.timers, key)
+	}
+}
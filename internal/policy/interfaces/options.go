@@ -0,0 +1,123 @@
+package interfaces
+
+import (
+	"gocache/internal/timingwheel"
+	"sync"
+	"time"
+)
+
+// Sizer 计算一个条目计入 usedBytes 的字节数
+type Sizer interface {
+	Size(key string, value Value) int64
+}
+
+// SizerFunc 将函数适配为 Sizer
+type SizerFunc func(key string, value Value) int64
+
+func (f SizerFunc) Size(key string, value Value) int64 {
+	return f(key, value)
+}
+
+// BytesSizer 只统计 key 和 value 本身的字节数，不包含任何结构开销
+var BytesSizer Sizer = SizerFunc(func(key string, value Value) int64 {
+	return int64(len(key)) + int64(value.Len())
+})
+
+/*
+OverheadSizer 在 key 和 value 字节数的基础上，为每个条目加上固定的结构开销
+  - overhead 由各策略根据自身的数据结构（链表节点、Entry、map 槽位等）给出
+  - key、value 的数据部分同样按内存分配规格向上取整
+*/
+func OverheadSizer(overhead int64) Sizer {
+	return SizerFunc(func(key string, value Value) int64 {
+		return overhead + AllocSize(int64(len(key))) + AllocSize(int64(value.Len()))
+	})
+}
+
+const (
+	// MapSlotOverhead map[string]*T 中每个条目的近似开销：字符串头 16 + 指针 8 + 控制字节，
+	// 按装载因子和扩容时新旧数组并存的余量放大
+	MapSlotOverhead = 48
+	// ValueBoxOverhead Value 接口装箱时在堆上分配的值（例如 ByteView 的切片头）
+	ValueBoxOverhead = 24
+)
+
+// sizeClasses runtime 小对象的内存分配规格（字节），超过最大规格时按页对齐
+var sizeClasses = []int64{8, 16, 24, 32, 48, 64, 80, 96, 112, 128, 144, 160, 176, 192, 208, 224, 240, 256,
+	288, 320, 352, 384, 416, 448, 480, 512, 576, 640, 704, 768, 896, 1024, 1152, 1280, 1408, 1536, 1792,
+	2048, 2304, 2688, 3072, 3200, 3456, 4096, 4864, 5376, 6144, 6528, 6784, 6912, 8192, 9472, 9728, 10240,
+	10880, 12288, 13568, 14336, 16384, 18432, 19072, 20480, 21760, 24576, 27264, 28672, 32768}
+
+// AllocSize 返回申请 n 字节时 runtime 实际分配的字节数
+func AllocSize(n int64) int64 {
+	if n <= 0 {
+		return 0
+	}
+	for _, class := range sizeClasses {
+		if n <= class {
+			return class
+		}
+	}
+	const pageSize = 8192
+	return (n + pageSize - 1) / pageSize * pageSize
+}
+
+/*
+Options 策略的可选配置
+  - Sizer：条目大小的计算方式，默认 BytesSizer
+  - MaxEntries：条目数量上限，与 maxBytes 同时生效，0 表示不限制
+  - TTL：Add 写入的条目的存活时间，0 表示永不过期
+  - Wheel、Locker：登记过期任务的时间轮，以及保护策略实例的锁；
+    未设置时过期条目只在 Get 和 CleanUp 时惰性清理
+*/
+type Options struct {
+	Sizer      Sizer
+	MaxEntries int
+	TTL        time.Duration
+	Wheel      *timingwheel.TimingWheel
+	Locker     sync.Locker
+}
+
+type Option func(*Options)
+
+func WithSizer(sizer Sizer) Option {
+	return func(o *Options) {
+		o.Sizer = sizer
+	}
+}
+
+func WithMaxEntries(maxEntries int) Option {
+	return func(o *Options) {
+		o.MaxEntries = maxEntries
+	}
+}
+
+func WithTTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.TTL = ttl
+	}
+}
+
+/*
+WithTimingWheel 让策略把条目的过期时间登记到时间轮上，到期后主动淘汰
+  - 过期任务在时间轮的 goroutine 中执行，会先获取 locker，
+    因此 locker 必须是调用方访问该策略实例时持有的同一把锁
+*/
+func WithTimingWheel(wheel *timingwheel.TimingWheel, locker sync.Locker) Option {
+	return func(o *Options) {
+		o.Wheel = wheel
+		o.Locker = locker
+	}
+}
+
+// NewOptions 应用可选配置并补全默认值
+func NewOptions(opts ...Option) Options {
+	o := Options{Sizer: BytesSizer}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Sizer == nil {
+		o.Sizer = BytesSizer
+	}
+	return o
+}
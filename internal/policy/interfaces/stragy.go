@@ -4,22 +4,47 @@ import "time"
 
 type CacheStrategy interface {
 	Get(string) (Value, *time.Time, bool)
+	// Peek 返回条目的拷贝，不更新访问顺序和频率，也不删除已经过期的条目，供检查缓存内容使用
+	Peek(key string) (Entry, bool)
 	Add(string, Value)
+	// AddEntry 写入条目并保留其 UpdateAt（为 nil 时视为刚刚写入），用于在策略实例之间迁移数据
+	AddEntry(Entry)
+	// Entries 返回所有条目的拷贝，按价值从高到低排列（越靠前越不应该被淘汰）
+	Entries() []Entry
 	CleanUp(ttl time.Duration)
+	// Delete 删除指定条目并取消其过期任务，与淘汰一样触发 OnEvicted，条目不存在时返回 false
+	Delete(key string) bool
+	// Purge 清空所有条目并取消登记在时间轮上的过期任务，不触发 OnEvicted
+	Purge()
 	Len() int
+	UsedBytes() int64
+	// SetMaxBytes 原地调整容量，容量缩小时立即淘汰超出部分，0 表示不限制
+	SetMaxBytes(int64)
 }
 
 type Value interface {
 	Len() int
 }
+
+/*
+Entry 缓存条目
+  - UpdateAt：最近一次写入（LRU 为最近一次访问）的时间
+  - ExpireAt：绝对过期时间，为 nil 时永不过期
+  - Hits：写入和命中的次数，LFU 按它淘汰；迁移时保留，切换到 LFU 后不会丢失已经统计的访问频率
+*/
 type Entry struct {
 	Key      string
 	Value    Value
 	UpdateAt *time.Time
+	ExpireAt *time.Time
+	Hits     int
 }
 
+// Expired 判断条目是否超过 duration 没有更新，或者已经到达过期时间
 func (ele *Entry) Expired(duration time.Duration) (ok bool) {
-	if ele.UpdateAt == nil {
+	if ele.Outdated() {
+		ok = true
+	} else if ele.UpdateAt == nil {
 		ok = false
 	} else {
 		//上次更新时间加上duration在当前时间之前，说明已经过期，ok为true
@@ -32,3 +57,44 @@ func (ele *Entry) Touch() {
 	nowTime := time.Now()
 	ele.UpdateAt = &nowTime
 }
+
+// Outdated 判断条目是否已经到达过期时间
+func (ele *Entry) Outdated() bool {
+	return ele.ExpireAt != nil && !time.Now().Before(*ele.ExpireAt)
+}
+
+// ExpireAfter 设置过期时间为 ttl 之后，ttl <= 0 时永不过期
+func (ele *Entry) ExpireAfter(ttl time.Duration) {
+	if ttl <= 0 {
+		ele.ExpireAt = nil
+		return
+	}
+	expireAt := time.Now().Add(ttl)
+	ele.ExpireAt = &expireAt
+}
+
+// Restore 使用 src 的更新时间覆盖当前条目的更新时间，src 为 nil 时保持不变
+func (ele *Entry) Restore(src *time.Time) {
+	if src == nil {
+		return
+	}
+	updateAt := *src
+	ele.UpdateAt = &updateAt
+}
+
+// RestoreHits 使用 src 的访问次数覆盖当前条目的访问次数，src 不大于当前次数时保持不变
+func (ele *Entry) RestoreHits(src int) {
+	if src > ele.Hits {
+		ele.Hits = src
+	}
+}
+
+// RestoreExpire 使用 src 的过期时间覆盖当前条目的过期时间，src 为 nil 时永不过期
+func (ele *Entry) RestoreExpire(src *time.Time) {
+	if src == nil {
+		ele.ExpireAt = nil
+		return
+	}
+	expireAt := *src
+	ele.ExpireAt = &expireAt
+}
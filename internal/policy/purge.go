@@ -5,18 +5,76 @@ import (
 	"gocache/internal/policy/LFU"
 	"gocache/internal/policy/LRU"
 	"gocache/internal/policy/interfaces"
+	"sort"
 	"strings"
 )
 
-func New(name string, maxBytes int64, onEvicted func(string, interfaces.Value)) interfaces.CacheStrategy {
-	name = strings.ToLower(name)
-	switch name {
-	case "lru":
-		return LRU.NewLRUCache(maxBytes, onEvicted)
-	case "lfu":
-		return LFU.NewLFUCache(maxBytes, onEvicted)
-	case "fifo":
-		return FIFO.NewFIFOCache(maxBytes, onEvicted)
+// strategy 已注册的淘汰策略：构造函数和每个条目的结构开销
+type strategy struct {
+	new      func(int64, func(string, interfaces.Value), ...interfaces.Option) interfaces.CacheStrategy
+	overhead int64
+}
+
+// strategies 已注册的淘汰策略，key 为小写的策略名
+var strategies = map[string]strategy{
+	"lru": {
+		new: func(maxBytes int64, onEvicted func(string, interfaces.Value), opts ...interfaces.Option) interfaces.CacheStrategy {
+			return LRU.NewLRUCache(maxBytes, onEvicted, opts...)
+		},
+		overhead: LRU.EntryOverhead,
+	},
+	"lfu": {
+		new: func(maxBytes int64, onEvicted func(string, interfaces.Value), opts ...interfaces.Option) interfaces.CacheStrategy {
+			return LFU.NewLFUCache(maxBytes, onEvicted, opts...)
+		},
+		overhead: LFU.EntryOverhead,
+	},
+	"fifo": {
+		new: func(maxBytes int64, onEvicted func(string, interfaces.Value), opts ...interfaces.Option) interfaces.CacheStrategy {
+			return FIFO.NewFIFOCache(maxBytes, onEvicted, opts...)
+		},
+		overhead: FIFO.EntryOverhead,
+	},
+}
+
+// New 根据策略名创建淘汰策略实例，未注册的策略名返回 nil
+func New(name string, maxBytes int64, onEvicted func(string, interfaces.Value), opts ...interfaces.Option) interfaces.CacheStrategy {
+	if s, ok := strategies[strings.ToLower(name)]; ok {
+		return s.new(maxBytes, onEvicted, opts...)
 	}
 	return nil
 }
+
+/*
+OverheadSizer 返回计入该策略结构开销的 Sizer，使 maxBytes 接近真实的内存占用
+  - 未注册的策略名返回只统计 key 和 value 字节数的 BytesSizer
+*/
+func OverheadSizer(name string) interfaces.Sizer {
+	if s, ok := strategies[strings.ToLower(name)]; ok {
+		return interfaces.OverheadSizer(s.overhead)
+	}
+	return interfaces.BytesSizer
+}
+
+// Names 返回所有已注册的策略名（按字典序）
+func Names() []string {
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+Migrate 将 src 中的条目迁移到新的策略实例 dst
+  - 按价值从低到高写入 dst，价值最高的条目最后写入，在 dst 中也处于最不容易被淘汰的位置
+  - dst 容量不足时由其自身的淘汰逻辑丢弃价值最低的条目（会触发 dst 的 OnEvicted）
+  - 条目的更新时间保持不变，迁移不会延长条目的 TTL
+*/
+func Migrate(dst, src interfaces.CacheStrategy) {
+	entries := src.Entries()
+	for i := len(entries) - 1; i >= 0; i-- {
+		dst.AddEntry(entries[i])
+	}
+}
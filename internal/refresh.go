@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"gocache/internal/timingwheel"
+	"gocache/utils/logger"
+	"sync"
+	"time"
+)
+
+/*
+refresher 热点 key 的提前刷新调度器，每个 Group 一个
+  - 访问频率按 TTL 长度的窗口统计，只保留当前和上一个窗口，长期不访问的 key 随窗口轮换被丢弃
+  - 命中次数达到 minHits 的 key 在过期前 ahead 时登记到时间轮上，到期时若仍然是热点则重新加载
+  - 刷新通过 load 走 SingleFlight，与前台回源合并；信号量限制同时进行的刷新数量
+*/
+type refresher struct {
+	group   *Group
+	wheel   *timingwheel.TimingWheel
+	ahead   time.Duration
+	minHits int64
+	window  time.Duration
+	sem     chan struct{}
+
+	mu          sync.Mutex
+	windowStart time.Time
+	current     map[string]int64
+	previous    map[string]int64
+	scheduled   map[string]*timingwheel.Timer
+}
+
+// newRefresher 未设置 TTL 或提前量时返回 nil，nil 的 refresher 上所有方法都是空操作
+func newRefresher(g *Group, o groupOptions, wheel *timingwheel.TimingWheel) *refresher {
+	if o.ttl <= 0 || o.refreshAhead <= 0 || o.refreshAhead >= o.ttl {
+		return nil
+	}
+	minHits, concurrency := o.refreshHits, o.refreshConcurrency
+	if minHits <= 0 {
+		minHits = 1
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &refresher{
+		group:       g,
+		wheel:       wheel,
+		ahead:       o.refreshAhead,
+		minHits:     int64(minHits),
+		window:      o.ttl,
+		sem:         make(chan struct{}, concurrency),
+		windowStart: time.Now(),
+		current:     make(map[string]int64),
+		previous:    make(map[string]int64),
+		scheduled:   make(map[string]*timingwheel.Timer),
+	}
+}
+
+// rotate 窗口结束时轮换计数，超过两个窗口没有访问时全部清空，调用方需持有 r.mu
+func (r *refresher) rotate(now time.Time) {
+	elapsed := now.Sub(r.windowStart)
+	if elapsed < r.window {
+		return
+	}
+	if elapsed < 2*r.window {
+		r.previous = r.current
+	} else {
+		r.previous = make(map[string]int64)
+	}
+	r.current = make(map[string]int64)
+	r.windowStart = now
+}
+
+// hits 返回 key 在最近两个窗口内的命中次数，调用方需持有 r.mu
+func (r *refresher) hits(key string) int64 {
+	return r.current[key] + r.previous[key]
+}
+
+// touch 记录一次命中，key 成为热点且还没有登记刷新时，在过期前 ahead 登记刷新任务
+func (r *refresher) touch(key string, it item) {
+	if r == nil {
+		return
+	}
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rotate(now)
+	r.current[key]++
+	if it.expireAt.IsZero() || r.hits(key) < r.minHits {
+		return
+	}
+	if _, ok := r.scheduled[key]; ok {
+		return
+	}
+	r.scheduled[key] = r.wheel.AfterFunc(it.expireAt.Add(-r.ahead).Sub(now), func() {
+		r.fire(key)
+	})
+}
+
+// fire 在时间轮的 goroutine 中执行，只做判断，加载在单独的 goroutine 中进行
+func (r *refresher) fire(key string) {
+	r.mu.Lock()
+	delete(r.scheduled, key)
+	r.rotate(time.Now())
+	hot := r.hits(key) >= r.minHits
+	r.mu.Unlock()
+	if !hot {
+		return
+	}
+
+	select {
+	case r.sem <- struct{}{}:
+	default:
+		r.group.stats.refreshSkipped.Add(1)
+		return
+	}
+	r.group.stats.refreshes.Add(1)
+	go func() {
+		defer func() { <-r.sem }()
+		r.group.flight.Invalidate(key)
+		if _, err := r.group.load(context.Background(), key); err != nil {
+			logger.LogrusObj.Warnf("[GoCache] Group %s refresh hot key %s failed: %v", r.group.name, key, err)
+		}
+	}()
+}
@@ -1,7 +1,12 @@
 package service
 
 import (
+	"container/list"
+	"context"
+	"fmt"
+	"gocache/internal/timingwheel"
 	"gocache/utils/logger"
+	"runtime/debug"
 	"sync"
 	"time"
 )
@@ -18,91 +23,276 @@ import (
 */
 // Call 正在进行或已经结束的请求
 type Call struct {
-	wg    sync.WaitGroup
-	value interface{}
-	err   error
+	done      chan struct{} // fn 返回后关闭
+	value     interface{}
+	err       error
+	panicked  bool // fn 发生 panic，err 为 *PanicError
+	dups      int
+	chans     []chan<- Result
+	forgotten bool
+	// invalidated 请求进行期间数据被写入，结果不再缓存
+	invalidated bool
 }
 
+// Result DoChan 返回的结果，Shared 表示结果同时返回给了多个调用方（包括缓存的结果）
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool
+}
+
+// PanicError fn 中的 panic 会被恢复并包装成 PanicError，传递给所有等待者
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("singleflight: panic in fn: %v\n\n%s", p.Value, p.Stack)
+}
+
+/*
+SingleFlight 合并同一个 key 的并发请求，并在 ttl 内缓存成功的结果
+  - 结果的过期任务登记在共享的时间轮上，到期后单独删除，不再定期遍历整个 map
+  - 缓存的结果数量超过 maxEntries 时淘汰最早缓存的结果，所有结果的 ttl 相同，最早缓存的也最早过期
+  - 数据写入后应调用 Invalidate，否则 ttl 内仍可能读到写入前的结果
+  - 零值可以直接使用，此时不缓存结果
+*/
 type SingleFlight struct {
-	mu     sync.RWMutex
-	cache  map[string]*cachedValue
-	m      map[string]*Call
-	ttl    time.Duration
-	ticker *time.Ticker
+	mu         sync.Mutex
+	cache      map[string]*cachedValue
+	order      *list.List // 按缓存时间排列的 key，队首最早
+	m          map[string]*Call
+	ttl        time.Duration
+	maxEntries int
+	wheel      *timingwheel.TimingWheel
 }
 type cachedValue struct {
 	value   interface{}
 	expires time.Time
+	element *list.Element
+	timer   *timingwheel.Timer
 }
 
-func NewSingleFlight(ttl time.Duration) *SingleFlight {
-	sf := &SingleFlight{
-		m:     make(map[string]*Call),
-		cache: make(map[string]*cachedValue),
-		ttl:   ttl,
+// NewSingleFlight 创建 SingleFlight，ttl 为 0 时不缓存结果，maxEntries 为 0 时不限制缓存的结果数量
+func NewSingleFlight(ttl time.Duration, maxEntries int) *SingleFlight {
+	return &SingleFlight{
+		m:          make(map[string]*Call),
+		cache:      make(map[string]*cachedValue),
+		order:      list.New(),
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		wheel:      timingwheel.Default(),
 	}
-	sf.ticker = time.NewTicker(sf.ttl)
-	go sf.cacheCleaner()
-	return sf
 }
 
-// cacheCleaner 清理过期缓存
-func (sf *SingleFlight) cacheCleaner() {
-	for range sf.ticker.C {
+// remember 缓存成功的结果并登记过期任务，超出数量上限时淘汰最早的结果，调用方需持有 sf.mu
+func (sf *SingleFlight) remember(key string, value interface{}) {
+	if sf.ttl <= 0 || sf.wheel == nil {
+		return
+	}
+	if sf.cache == nil {
+		sf.cache = make(map[string]*cachedValue)
+		sf.order = list.New()
+	}
+	sf.forget(key)
+	for sf.maxEntries > 0 && len(sf.cache) >= sf.maxEntries {
+		sf.forget(sf.order.Front().Value.(string))
+	}
+	cv := &cachedValue{
+		value:   value,
+		expires: time.Now().Add(sf.ttl),
+		element: sf.order.PushBack(key),
+	}
+	sf.cache[key] = cv
+	cv.timer = sf.wheel.AfterFunc(sf.ttl, func() {
 		sf.mu.Lock()
-		for key, cv := range sf.cache {
-			if time.Now().After(cv.expires) {
-				delete(sf.cache, key)
-			}
+		defer sf.mu.Unlock()
+		// 期间同一个 key 可能已经缓存了新的结果
+		if sf.cache[key] == cv {
+			sf.forget(key)
 		}
-		sf.mu.Unlock()
+	})
+}
+
+// forget 删除 key 缓存的结果并取消其过期任务，调用方需持有 sf.mu
+func (sf *SingleFlight) forget(key string) {
+	cv, ok := sf.cache[key]
+	if !ok {
+		return
+	}
+	delete(sf.cache, key)
+	sf.order.Remove(cv.element)
+	if cv.timer != nil {
+		cv.timer.Stop()
 	}
 }
 
-// 使用 SingleFlight 对 Group 缓存未命中时的查询进行再封装，并发请求期间只有一个请求会以 goroutine 形式调用查询，
-// 并发查询期间的所有其他请求均阻塞等待，当然我们也可以配置是否允许阻塞，给调用者更多选择
-func (sf *SingleFlight) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
-	// 并发安全，加锁
-	sf.mu.RLock()
+// Len 返回缓存的结果数量
+func (sf *SingleFlight) Len() int {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return len(sf.cache)
+}
 
-	if cv, ok := sf.cache[key]; ok && time.Now().Before(cv.expires) {
-		sf.mu.RUnlock()
-		return cv.value, nil
+/*
+Invalidate 删除 key 缓存的结果，数据写入后调用
+  - 下一次 Do 会重新调用 fn
+  - 正在进行的请求可能读到的是写入前的数据，其结果仍然返回给已经在等待的调用方，但不再缓存
+*/
+func (sf *SingleFlight) Invalidate(key string) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.forget(key)
+	if c, ok := sf.m[key]; ok {
+		c.invalidated = true
 	}
+}
 
-	c, ok := sf.m[key]
-	sf.mu.RUnlock()
+// InvalidateAll 删除所有缓存的结果，正在进行的请求的结果不再缓存，清空缓存时调用
+func (sf *SingleFlight) InvalidateAll() {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	for key := range sf.cache {
+		sf.forget(key)
+	}
+	for _, c := range sf.m {
+		c.invalidated = true
+	}
+}
 
-	// 判断是否已经有 goroutine 在查询了
-	if ok {
+/*
+lookup 查找缓存的结果或正在进行的请求，都没有时登记新的请求，调用方需持有 sf.mu
+  - 返回 cached 为 true 时 value 是缓存的结果
+  - 返回 leader 为 true 时调用方负责执行 fn
+*/
+func (sf *SingleFlight) lookup(key string) (value interface{}, cached bool, c *Call, leader bool) {
+	if cv, ok := sf.cache[key]; ok && time.Now().Before(cv.expires) {
+		return cv.value, true, nil, false
+	}
+	if c, ok := sf.m[key]; ok {
+		c.dups++
 		// 直接可以释放锁了，让其他并发请求进来
-		logger.LogrusObj.Warnf("%s 已经在查询了，阻塞等待 goroutine 返回结果", key)
-		c.wg.Wait()
-		// 用于查询的 goroutine 已经返回，结果值已经存入 Call 结构体中
-		return c.value, c.err
+		logger.SampledDebugf("%s 已经在查询了，阻塞等待 goroutine 返回结果", key)
+		return nil, false, c, false
+	}
+	if sf.m == nil {
+		sf.m = make(map[string]*Call)
+	}
+	c = &Call{done: make(chan struct{})}
+	sf.m[key] = c
+	return nil, false, c, true
+}
+
+/*
+Do 使用 SingleFlight 对 Group 缓存未命中时的查询进行再封装，并发请求期间只有一个请求会调用 fn，其他请求阻塞等待
+  - shared 表示结果同时返回给了多个调用方
+  - fn 发生 panic 时，执行 fn 的调用方和所有等待者都会以 *PanicError 重新 panic
+*/
+func (sf *SingleFlight) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	sf.mu.Lock()
+	value, cached, c, leader := sf.lookup(key)
+	sf.mu.Unlock()
+
+	if cached {
+		return value, nil, true
+	}
+	if leader {
+		sf.doCall(c, key, fn)
+	} else {
+		<-c.done
 	}
+	if c.panicked {
+		panic(c.err)
+	}
+	return c.value, c.err, c.dups > 0
+}
 
-	c = new(Call)
-	c.wg.Add(1)
+/*
+DoChan 与 Do 相同，但不阻塞，结果通过返回的 channel 送达
+  - fn 在新的 goroutine 中执行，channel 有一个缓冲，调用方不读取也不会阻塞 fn
+  - fn 发生 panic 时不会重新 panic，Result.Err 为 *PanicError
+*/
+func (sf *SingleFlight) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
 
 	sf.mu.Lock()
-	sf.m[key] = c
+	value, cached, c, leader := sf.lookup(key)
+	if c != nil {
+		c.chans = append(c.chans, ch)
+	}
 	sf.mu.Unlock()
 
-	// 开启查询，c.value 和 c.err 接收返回值
-	c.value, c.err = fn()
-	c.wg.Done()
+	if cached {
+		ch <- Result{Val: value, Shared: true}
+	} else if leader {
+		go sf.doCall(c, key, fn)
+	}
+	return ch
+}
 
+/*
+DoContext 与 Do 相同，但等待可以随 ctx 取消
+  - ctx 取消时当前调用方立即返回 ctx.Err()，fn 继续执行，结果仍然送达其他等待者并缓存
+  - 发起请求的调用方取消时，fn 也不会被中断，因此 fn 总是在新的 goroutine 中执行
+*/
+func (sf *SingleFlight) DoContext(ctx context.Context, key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
 	sf.mu.Lock()
-	delete(sf.m, key)
-	// 缓存结果
-	if c.err == nil {
-		sf.cache[key] = &cachedValue{
-			value:   c.value,
-			expires: time.Now().Add(sf.ttl),
-		}
+	value, cached, c, leader := sf.lookup(key)
+	sf.mu.Unlock()
+
+	if cached {
+		return value, nil, true
+	}
+	if leader {
+		go sf.doCall(c, key, fn)
+	}
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return nil, ctx.Err(), false
+	}
+	if c.panicked {
+		panic(c.err)
+	}
+	return c.value, c.err, c.dups > 0
+}
+
+// Forget 丢弃 key 正在进行的请求和缓存的结果，之后的调用会重新执行 fn，已经在等待的调用方仍然得到原来的结果
+func (sf *SingleFlight) Forget(key string) {
+	sf.mu.Lock()
+	if c, ok := sf.m[key]; ok {
+		c.forgotten = true
+		delete(sf.m, key)
 	}
+	sf.forget(key)
 	sf.mu.Unlock()
+}
+
+// doCall 执行 fn 并把结果送达所有等待者，fn 中的 panic 被恢复为 *PanicError
+func (sf *SingleFlight) doCall(c *Call, key string, fn func() (interface{}, error)) {
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				c.value, c.err, c.panicked = nil, &PanicError{Value: r, Stack: debug.Stack()}, true
+			}
+		}()
+		// 开启查询，c.value 和 c.err 接收返回值
+		c.value, c.err = fn()
+	}()
 
-	return c.value, c.err
+	sf.mu.Lock()
+	// 被 Forget 的请求不再从 map 中删除（可能已经有新的请求），结果也不缓存
+	if !c.forgotten {
+		delete(sf.m, key)
+		if c.err == nil && !c.invalidated {
+			sf.remember(key, c.value)
+		}
+	}
+	close(c.done)
+	result := Result{Val: c.value, Err: c.err, Shared: c.dups > 0}
+	for _, ch := range c.chans {
+		ch <- result
+	}
+	sf.mu.Unlock()
 }
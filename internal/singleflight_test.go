@@ -1,10 +1,17 @@
 package service
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
 
 func TestDo(t *testing.T) {
 	var g SingleFlight
-	v, err := g.Do("key", func() (interface{}, error) {
+	v, err, _ := g.Do("key", func() (interface{}, error) {
 		return "bar", nil
 	})
 
@@ -12,3 +19,186 @@ func TestDo(t *testing.T) {
 		t.Errorf("Do v = %v, error = %v", v, err)
 	}
 }
+
+func TestDoDupSuppress(t *testing.T) {
+	var g SingleFlight
+	var calls int32
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "bar", nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	var shared int32
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err, s := g.Do("key", fn)
+			if v != "bar" || err != nil {
+				t.Errorf("Do v = %v, error = %v", v, err)
+			}
+			if s {
+				atomic.AddInt32(&shared, 1)
+			}
+		}()
+	}
+	time.Sleep(time.Millisecond * 50)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+	if shared != n {
+		t.Errorf("%d results marked shared, want %d", shared, n)
+	}
+}
+
+func TestDoChan(t *testing.T) {
+	var g SingleFlight
+	release := make(chan struct{})
+	first := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return "bar", nil
+	})
+	second := g.DoChan("key", func() (interface{}, error) {
+		t.Error("duplicate call should not run fn")
+		return nil, nil
+	})
+	close(release)
+
+	for _, ch := range []<-chan Result{first, second} {
+		res := <-ch
+		if res.Val != "bar" || res.Err != nil || !res.Shared {
+			t.Errorf("DoChan result = %+v", res)
+		}
+	}
+}
+
+func TestDoContextCancel(t *testing.T) {
+	var g SingleFlight
+	release := make(chan struct{})
+	result := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return "bar", nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	_, err, _ := g.DoContext(ctx, "key", func() (interface{}, error) {
+		t.Error("duplicate call should not run fn")
+		return nil, nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("DoContext error = %v, want deadline exceeded", err)
+	}
+
+	// 放弃等待的调用方不影响正在进行的请求
+	close(release)
+	if res := <-result; res.Val != "bar" || res.Err != nil {
+		t.Fatalf("DoChan result = %+v", res)
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g SingleFlight
+	release := make(chan struct{})
+	first := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+	g.Forget("key")
+
+	v, err, _ := g.Do("key", func() (interface{}, error) {
+		return 2, nil
+	})
+	if v != 2 || err != nil {
+		t.Fatalf("Do after Forget v = %v, error = %v, want fn called again", v, err)
+	}
+
+	close(release)
+	if res := <-first; res.Val != 1 {
+		t.Fatalf("forgotten call result = %+v, want original result", res)
+	}
+}
+
+func TestDoPanic(t *testing.T) {
+	var g SingleFlight
+	release := make(chan struct{})
+	waiter := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		panic("boom")
+	})
+
+	done := make(chan interface{})
+	go func() {
+		defer func() { done <- recover() }()
+		g.Do("key", func() (interface{}, error) { return nil, nil })
+	}()
+	time.Sleep(time.Millisecond * 20)
+	close(release)
+
+	var pe *PanicError
+	if r := <-done; r == nil {
+		t.Fatal("Do waiter should panic")
+	} else if err, ok := r.(error); !ok || !errors.As(err, &pe) || pe.Value != "boom" {
+		t.Fatalf("Do waiter panicked with %v, want *PanicError", r)
+	}
+	if res := <-waiter; !errors.As(res.Err, &pe) {
+		t.Fatalf("DoChan result error = %v, want *PanicError", res.Err)
+	}
+
+	// panic 之后 key 不再处于进行中，新的调用会重新执行 fn
+	v, err, _ := g.Do("key", func() (interface{}, error) { return "bar", nil })
+	if v != "bar" || err != nil {
+		t.Fatalf("Do after panic v = %v, error = %v", v, err)
+	}
+}
+
+func TestResultCacheBound(t *testing.T) {
+	g := NewSingleFlight(time.Minute, 2)
+	var calls int32
+	fn := func() (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		g.Do(key, fn)
+	}
+	if n := g.Len(); n != 2 {
+		t.Fatalf("cached %d results, want 2", n)
+	}
+	// 最早缓存的 a 被淘汰，b 仍然命中
+	if _, _, shared := g.Do("b", fn); !shared {
+		t.Error("b should be served from the result cache")
+	}
+	if v, _, _ := g.Do("a", fn); v != int32(4) {
+		t.Errorf("a = %v, want a fresh call", v)
+	}
+}
+
+func TestInvalidateInFlight(t *testing.T) {
+	g := NewSingleFlight(time.Minute, 0)
+	release := make(chan struct{})
+	result := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return "old", nil
+	})
+	g.Invalidate("key")
+	close(release)
+	if res := <-result; res.Val != "old" {
+		t.Fatalf("in-flight result = %+v", res)
+	}
+
+	// 请求进行期间数据被写入，结果不缓存，下一次调用重新执行 fn
+	v, _, _ := g.Do("key", func() (interface{}, error) { return "new", nil })
+	if v != "new" {
+		t.Fatalf("Do after Invalidate = %v, want new", v)
+	}
+	if v, _, _ := g.Do("key", func() (interface{}, error) { return "newer", nil }); v != "new" {
+		t.Fatalf("fresh result should be cached, got %v", v)
+	}
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/*
+快照文件格式：8 字节的 snapshotMagic，之后每个条目依次为
+  - uvarint 长度的 key、uvarint 长度的 value
+  - varint 的软过期时间、硬过期时间（UnixNano，0 表示没有）和回源耗时（纳秒）
+*/
+const snapshotMagic = "GOCACHE1"
+
+// maxSnapshotBytes 单个 key 或 value 的长度上限，超过时认为快照已经损坏
+const maxSnapshotBytes = 1 << 30
+
+/*
+snapshotReader 读取快照并记录剩余的字节数
+  - 长度超过剩余字节数的条目说明快照已经损坏，在分配内存之前返回错误
+  - 剩余字节数未知（left 为 -1）时按实际读到的数据逐步分配，不会按照长度一次分配
+*/
+type snapshotReader struct {
+	r    *bufio.Reader
+	left int64
+}
+
+func newSnapshotReader(r io.Reader) *snapshotReader {
+	return &snapshotReader{r: bufio.NewReader(r), left: readerSize(r)}
+}
+
+func (sr *snapshotReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	if sr.left >= 0 {
+		sr.left = max(sr.left-int64(n), 0)
+	}
+	return n, err
+}
+
+func (sr *snapshotReader) ReadByte() (byte, error) {
+	b, err := sr.r.ReadByte()
+	if err == nil && sr.left > 0 {
+		sr.left--
+	}
+	return b, err
+}
+
+// readerSize 返回 r 中剩余的字节数，文件从当前位置算起，无法得知时返回 -1
+func readerSize(r io.Reader) int64 {
+	switch v := r.(type) {
+	case interface{ Len() int }:
+		return int64(v.Len())
+	case *os.File:
+		fi, err := v.Stat()
+		if err != nil || !fi.Mode().IsRegular() {
+			return -1
+		}
+		off, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return max(fi.Size()-off, 0)
+	}
+	return -1
+}
+
+// snapshotFile 返回 group 在 dir 中的快照文件路径
+func snapshotFile(dir string, group string) string {
+	return filepath.Join(dir, group+".snapshot")
+}
+
+/*
+Snapshot 把本节点缓存中的条目写入 w，返回写入的条目数
+  - 负缓存条目和热点副本不写入；宽限期内的旧值保留，恢复后仍可在回源失败时返回
+  - 按价值从低到高写入，恢复时价值最高的条目最后写入，淘汰顺序与快照时一致
+*/
+func (g *Group) Snapshot(w io.Writer) (int, error) {
+	entries := g.mainCache.entries()
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(snapshotMagic); err != nil {
+		return 0, err
+	}
+	n := 0
+	var buf []byte
+	for i := len(entries) - 1; i >= 0; i-- {
+		it := entries[i].Value.(item)
+		if it.negative {
+			continue
+		}
+		buf = binary.AppendUvarint(buf[:0], uint64(len(entries[i].Key)))
+		buf = append(buf, entries[i].Key...)
+		buf = binary.AppendUvarint(buf, uint64(it.view.Len()))
+		buf = append(buf, it.view.b...)
+		buf = binary.AppendVarint(buf, unixNano(it.freshUntil))
+		buf = binary.AppendVarint(buf, unixNano(it.expireAt))
+		buf = binary.AppendVarint(buf, int64(it.delta))
+		if _, err := bw.Write(buf); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, bw.Flush()
+}
+
+/*
+Restore 把 Snapshot 写出的条目写入本节点的缓存，返回写入的条目数
+  - 条目保留快照中的过期时间，已经超过宽限期的条目跳过
+  - key 同时加入布隆过滤器
+*/
+func (g *Group) Restore(r io.Reader) (int, error) {
+	br := newSnapshotReader(r)
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != snapshotMagic {
+		return 0, fmt.Errorf("not a gocache snapshot")
+	}
+	n := 0
+	for {
+		key, err := readSnapshotBytes(br)
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		value, err := readSnapshotBytes(br)
+		if err != nil {
+			return n, unexpectedEOF(err)
+		}
+		var times [3]int64
+		for i := range times {
+			if times[i], err = binary.ReadVarint(br); err != nil {
+				return n, unexpectedEOF(err)
+			}
+		}
+		it := item{view: ByteView{b: value}, freshUntil: fromUnixNano(times[0]), expireAt: fromUnixNano(times[1]), delta: time.Duration(times[2])}
+		if deadline := g.mainCache.deadline(it); !deadline.IsZero() && !time.Now().Before(deadline) {
+			continue
+		}
+		g.keys.add(string(key))
+		g.mainCache.restore(string(key), it)
+		n++
+	}
+}
+
+/*
+SnapshotFile 把快照写入 dir 中的 <group>.snapshot，返回文件路径和条目数
+  - 先写入临时文件再重命名，写入失败时不会破坏上一次的快照
+*/
+func (g *Group) SnapshotFile(dir string) (path string, n int, err error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, err
+	}
+	path = snapshotFile(dir, g.name)
+	f, err := os.CreateTemp(dir, g.name+".snapshot.*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(f.Name())
+
+	n, err = g.Snapshot(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return path, n, os.Rename(f.Name(), path)
+}
+
+// RestoreFile 从 dir 中的 <group>.snapshot 恢复，快照不存在时返回 0
+func (g *Group) RestoreFile(dir string) (int, error) {
+	f, err := os.Open(snapshotFile(dir, g.name))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return g.Restore(f)
+}
+
+func readSnapshotBytes(r *snapshotReader) ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxSnapshotBytes || (r.left >= 0 && size > uint64(r.left)) {
+		return nil, fmt.Errorf("snapshot entry of %d bytes is corrupted", size)
+	}
+	if r.left < 0 {
+		// 不知道剩余的字节数，随读取的数据增长，截断的快照不会按照损坏的长度分配内存
+		b, err := io.ReadAll(io.LimitReader(r, int64(size)))
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(b)) < size {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return b, nil
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return b, nil
+}
+
+// unexpectedEOF 条目中途结束说明快照被截断
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
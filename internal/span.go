@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+/*
+tracer 创建 Server.Get、缓存查找、SingleFlight 等待、Client.Fetch 和数据源查询的 span
+  - 使用全局的 TracerProvider，未初始化时为空实现，几乎没有开销
+  - trace 上下文通过 gRPC metadata 在节点之间传递，一次 Get 在所有节点上的 span 属于同一个 trace
+*/
+var tracer = otel.Tracer("gocache")
+
+// endSpan 记录错误并结束 span，ErrNotFound 是正常的应答，不标记为错误
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+}
+
+// metadataCarrier 适配 gRPC metadata，供 TextMapPropagator 读写 trace 上下文
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key string, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// injectTrace 把 ctx 中的 trace 上下文写入发往远程节点的 metadata
+func injectTrace(ctx context.Context) context.Context {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// extractTrace 从收到的 metadata 中恢复调用方的 trace 上下文
+func extractTrace(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+}
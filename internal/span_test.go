@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	pb "gocache/api/groupcachepb"
+	"google.golang.org/grpc/metadata"
+	"testing"
+)
+
+// 全局 tracer 只会委托给第一次设置的 TracerProvider，整个包的测试共用同一个 recorder
+var recorder = func() *tracetest.SpanRecorder {
+	r := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(r)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return r
+}()
+
+func TestServerGetSpans(t *testing.T) {
+	NewGroup("trace-spans", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	}))
+	s := &Server{Addr: "localhost:9999"}
+
+	// 模拟远程调用方：把调用方的 trace 上下文放进 incoming metadata
+	parent, span := otel.Tracer("test").Start(context.Background(), "caller")
+	out, _ := metadata.FromOutgoingContext(injectTrace(parent))
+	span.End()
+	ctx := metadata.NewIncomingContext(context.Background(), out)
+	if _, err := s.Get(ctx, &pb.GetRequest{Group: "trace-spans", Key: "key"}); err != nil {
+		t.Fatal(err)
+	}
+
+	traceID := span.SpanContext().TraceID()
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		if s.SpanContext().TraceID() == traceID {
+			spans[s.Name()] = s
+		}
+	}
+	get, ok := spans["GroupCache/Get"]
+	if !ok {
+		t.Fatalf("GroupCache/Get span not in caller's trace, got %v", spans)
+	}
+	if get.Parent().SpanID() != span.SpanContext().SpanID() {
+		t.Fatalf("GroupCache/Get parent = %v, expect caller %v", get.Parent().SpanID(), span.SpanContext().SpanID())
+	}
+	for _, name := range []string{"cache.lookup", "singleflight.Do", "Retriever.retrieve"} {
+		if _, ok := spans[name]; !ok {
+			t.Fatalf("missing span %s, got %v", name, spans)
+		}
+	}
+	if spans["Retriever.retrieve"].Parent().SpanID() != spans["singleflight.Do"].SpanContext().SpanID() {
+		t.Fatal("Retriever.retrieve should be a child of singleflight.Do")
+	}
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// groupStats Group 运行期间累计的原子计数器
+type groupStats struct {
+	gets         atomic.Int64 // Get 调用次数
+	hits         atomic.Int64 // 本地缓存命中次数
+	staleHits    atomic.Int64 // 命中但已超过软 TTL、返回旧值的次数（包含在 hits 中）
+	earlyHits    atomic.Int64 // 命中并触发概率提前过期、在后台重新加载的次数（包含在 hits 中）
+	staleOnError atomic.Int64 // 回源失败、返回宽限期内已过期旧值的次数（包含在 misses 中）
+	negativeHits atomic.Int64 // 命中负缓存、直接返回 ErrNotFound 的次数（包含在 hits 中）
+	filtered     atomic.Int64 // 被布隆过滤器拦截、直接返回 ErrNotFound 的次数（包含在 misses 中）
+	misses       atomic.Int64 // 本地缓存未命中次数
+	loads        atomic.Int64 // 未命中后回源（远程节点或数据源）加载的次数
+	loadNanos    atomic.Int64 // 回源加载的累计耗时（纳秒）
+	leaseWaits   atomic.Int64 // 回源前等到其他节点持有租约加载的结果、省去一次数据源查询的次数
+	dedupes      atomic.Int64 // 回源时被 SingleFlight 合并、没有实际加载的次数（包含在 loads 中）
+	replicaHits  atomic.Int64 // 命中热点 key 本地副本的次数（包含在 hits 中）
+	replicated   atomic.Int64 // 从负责节点取回的热点 key 写入本地副本的次数
+
+	peerLoads       atomic.Int64 // 从负责节点获取的次数
+	peerErrors      atomic.Int64 // 从负责节点获取失败、改为本地回源的次数
+	localLoads      atomic.Int64 // 查询数据源的次数
+	localLoadErrors atomic.Int64 // 查询数据源失败的次数，不包括 ErrNotFound
+
+	refreshes      atomic.Int64 // 热点 key 提前刷新的次数
+	refreshSkipped atomic.Int64 // 因并发上限放弃的提前刷新次数
+}
+
+/*
+Stats Group 统计信息的快照，计数器从 Group 创建开始累计
+  - Hits 包含 StaleHits、EarlyHits、NegativeHits、ReplicaHits；Misses 包含 Filtered、StaleOnError
+  - Loads 为未命中后的回源次数，其中 Dedupes 次被 SingleFlight 合并，其余先尝试 PeerLoads 再 LocalLoads
+  - Evictions 为容量不足淘汰的条目数，Expirations 为到期删除的条目数，Group.Delete 不计入
+  - Bytes、Items 为快照时刻的缓存占用
+*/
+type Stats struct {
+	Gets         int64
+	Hits         int64
+	StaleHits    int64
+	EarlyHits    int64
+	NegativeHits int64
+	Misses       int64
+	Filtered     int64
+	StaleOnError int64
+	ReplicaHits  int64
+	Replicated   int64
+
+	Loads           int64
+	LoadTime        time.Duration
+	Dedupes         int64
+	PeerLoads       int64
+	PeerErrors      int64
+	LocalLoads      int64
+	LocalLoadErrors int64
+	LeaseWaits      int64
+
+	Refreshes      int64
+	RefreshSkipped int64
+
+	Evictions   int64
+	Expirations int64
+	Bytes       int64
+	Items       int64
+}
+
+// HitRatio 返回命中率，没有请求时返回 0
+func (s Stats) HitRatio() float64 {
+	if s.Gets == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Gets)
+}
+
+// Stats 返回 Group 的统计信息
+func (g *Group) Stats() Stats {
+	st := &g.stats
+	items, bytes := g.mainCache.usage()
+	return Stats{
+		Gets:         st.gets.Load(),
+		Hits:         st.hits.Load(),
+		StaleHits:    st.staleHits.Load(),
+		EarlyHits:    st.earlyHits.Load(),
+		NegativeHits: st.negativeHits.Load(),
+		Misses:       st.misses.Load(),
+		Filtered:     st.filtered.Load(),
+		StaleOnError: st.staleOnError.Load(),
+		ReplicaHits:  st.replicaHits.Load(),
+		Replicated:   st.replicated.Load(),
+
+		Loads:           st.loads.Load(),
+		LoadTime:        time.Duration(st.loadNanos.Load()),
+		Dedupes:         st.dedupes.Load(),
+		PeerLoads:       st.peerLoads.Load(),
+		PeerErrors:      st.peerErrors.Load(),
+		LocalLoads:      st.localLoads.Load(),
+		LocalLoadErrors: st.localLoadErrors.Load(),
+		LeaseWaits:      st.leaseWaits.Load(),
+
+		Refreshes:      st.refreshes.Load(),
+		RefreshSkipped: st.refreshSkipped.Load(),
+
+		Evictions:   g.mainCache.evictions.Load(),
+		Expirations: g.mainCache.expirations.Load(),
+		Bytes:       bytes,
+		Items:       int64(items),
+	}
+}
+
+// peerStats Client 访问远程节点的原子计数器
+type peerStats struct {
+	fetches    atomic.Int64
+	errors     atomic.Int64
+	totalNanos atomic.Int64
+	maxNanos   atomic.Int64
+}
+
+// observe 记录一次 Fetch 的耗时和结果
+func (s *peerStats) observe(latency time.Duration, err error) {
+	s.fetches.Add(1)
+	if err != nil {
+		s.errors.Add(1)
+	}
+	nanos := int64(latency)
+	s.totalNanos.Add(nanos)
+	for {
+		max := s.maxNanos.Load()
+		if nanos <= max || s.maxNanos.CompareAndSwap(max, nanos) {
+			return
+		}
+	}
+}
+
+/*
+PeerStats 访问一个远程节点的统计信息快照
+  - Fetches 包含 Errors，ErrNotFound 不算失败
+  - 节点留在哈希环上期间持续累计，移除后重新加入时从零开始
+*/
+type PeerStats struct {
+	Addr         string
+	Fetches      int64
+	Errors       int64
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+}
+
+// AvgLatency 返回平均耗时，没有请求时返回 0
+func (s PeerStats) AvgLatency() time.Duration {
+	if s.Fetches == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Fetches)
+}
+
+// PeerStats 返回当前哈希环上每个远程节点的统计信息，按地址排序
+func (s *Server) PeerStats() []PeerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make([]PeerStats, 0, len(s.clients))
+	for addr, c := range s.clients {
+		if addr == s.Addr {
+			continue
+		}
+		stats = append(stats, c.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Addr < stats[j].Addr
+	})
+	return stats
+}
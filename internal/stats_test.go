@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"errors"
+	pb "gocache/api/groupcachepb"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGroupStats(t *testing.T) {
+	release := make(chan struct{})
+	g := NewGroup("stats", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		switch key {
+		case "slow":
+			<-release
+		case "missing":
+			return nil, ErrNotFound
+		case "broken":
+			return nil, errors.New("db down")
+		}
+		return []byte("value"), nil
+	}), WithMaxEntries(2), WithTTL(time.Millisecond*50))
+
+	// 并发读取同一个 key，只有一次实际加载
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Get("slow")
+		}()
+	}
+	time.Sleep(time.Millisecond * 20)
+	close(release)
+	wg.Wait()
+
+	g.Get("slow")
+	g.Get("missing")
+	g.Get("broken")
+	g.Get("a")
+	g.Get("b") // 条目上限为 2，淘汰 slow
+
+	st := g.Stats()
+	if st.Gets != 10 || st.Hits != 1 || st.Misses != 9 {
+		t.Fatalf("gets = %d, hits = %d, misses = %d, expect 10, 1, 9", st.Gets, st.Hits, st.Misses)
+	}
+	if st.Loads != 9 || st.Dedupes != 4 || st.LocalLoads != 5 || st.LocalLoadErrors != 1 {
+		t.Fatalf("loads = %d, dedupes = %d, local loads = %d, local load errors = %d, expect 9, 4, 5, 1",
+			st.Loads, st.Dedupes, st.LocalLoads, st.LocalLoadErrors)
+	}
+	if st.Evictions != 1 || st.Items != 2 || st.Bytes <= 0 {
+		t.Fatalf("evictions = %d, items = %d, bytes = %d", st.Evictions, st.Items, st.Bytes)
+	}
+	if ratio := st.HitRatio(); ratio != 0.1 {
+		t.Fatalf("hit ratio = %v, expect 0.1", ratio)
+	}
+
+	// 到期删除与淘汰分开统计，Delete 都不计入
+	if !g.Delete("a") {
+		t.Fatal("a should be cached")
+	}
+	time.Sleep(time.Millisecond * 200)
+	if st := g.Stats(); st.Expirations != 1 || st.Evictions != 1 || st.Items != 0 {
+		t.Fatalf("expirations = %d, evictions = %d, items = %d, expect 1, 1, 0", st.Expirations, st.Evictions, st.Items)
+	}
+}
+
+func TestServerStats(t *testing.T) {
+	NewGroup("stats-rpc", "lru", 0, RetrieveFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	})).Get("key")
+
+	s := &Server{Addr: "127.0.0.1:9999"}
+	peer := NewClient("127.0.0.1:10000")
+	peer.stats.observe(time.Millisecond*10, nil)
+	peer.stats.observe(time.Millisecond*30, errors.New("timeout"))
+	s.clients = map[string]*Client{s.Addr: NewClient(s.Addr), peer.addr: peer}
+
+	resp, err := s.Stats(context.Background(), &pb.StatsRequest{Group: "stats-rpc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Groups) != 1 || resp.Groups[0].Gets != 1 || resp.Groups[0].Items != 1 {
+		t.Fatalf("group stats = %v", resp.Groups)
+	}
+	if len(resp.Peers) != 1 {
+		t.Fatalf("peer stats should skip the local node, got %v", resp.Peers)
+	}
+	p := resp.Peers[0]
+	if p.Addr != peer.addr || p.Fetches != 2 || p.Errors != 1 || p.MaxNanos != int64(time.Millisecond*30) {
+		t.Fatalf("peer stats = %v", p)
+	}
+	if avg := peer.Stats().AvgLatency(); avg != time.Millisecond*20 {
+		t.Fatalf("avg latency = %v, expect 20ms", avg)
+	}
+
+	if _, err := s.Stats(context.Background(), &pb.StatsRequest{Group: "no-such-group"}); err == nil {
+		t.Fatal("stats of a missing group should fail")
+	}
+}
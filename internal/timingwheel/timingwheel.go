@@ -0,0 +1,215 @@
+package timingwheel
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+/*
+TimingWheel 分层时间轮，所有缓存实例共享同一个时间轮登记过期任务
+
+  - 第 0 层有 wheelSize 个槽，每个槽跨度为一个 tick；第 i 层每个槽跨度为 wheelSize^i 个 tick
+  - 添加任务时按剩余 tick 数选择能容纳它的最低一层，插入和取消都是 O(1)
+  - 每推进一个 tick，先把高层中进入当前区间的槽降级（重新插入到低层），再执行第 0 层当前槽中的任务
+  - 超出最高层范围的任务放在最高层，降级时重新计算位置，因此不会提前也不会延迟触发
+  - 整个时间轮只有一个后台 goroutine，不会随缓存实例数量增加
+*/
+type TimingWheel struct {
+	tick      time.Duration
+	wheelSize int64
+	levels    [][]*list.List
+	start     time.Time
+
+	mu      sync.Mutex
+	current int64 // 已经推进到的 tick 序号
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// Timer 登记在时间轮上的任务
+type Timer struct {
+	expiration int64 // 到期的 tick 序号
+	task       func()
+	wheel      *TimingWheel
+	bucket     *list.List
+	element    *list.Element
+}
+
+const (
+	levelCount       = 4
+	DefaultTick      = time.Millisecond * 100
+	DefaultWheelSize = 64
+)
+
+var (
+	defaultWheel *TimingWheel
+	defaultMu    sync.Mutex
+)
+
+/*
+New 创建并启动时间轮
+  - tick：时间精度，任务最多延迟一个 tick 触发
+  - wheelSize：每层的槽数，4 层可覆盖 tick × wheelSize^4 的时间范围，更远的任务会在最高层循环降级
+*/
+func New(tick time.Duration, wheelSize int) *TimingWheel {
+	if tick <= 0 {
+		tick = DefaultTick
+	}
+	if wheelSize <= 1 {
+		wheelSize = DefaultWheelSize
+	}
+	tw := &TimingWheel{
+		tick:      tick,
+		wheelSize: int64(wheelSize),
+		levels:    make([][]*list.List, levelCount),
+		start:     time.Now(),
+		stop:      make(chan struct{}),
+	}
+	for i := range tw.levels {
+		tw.levels[i] = make([]*list.List, wheelSize)
+		for j := range tw.levels[i] {
+			tw.levels[i][j] = list.New()
+		}
+	}
+	go tw.run()
+	return tw
+}
+
+// Default 返回进程内共享的时间轮，首次调用时使用默认精度创建
+func Default() *TimingWheel {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultWheel == nil {
+		defaultWheel = New(DefaultTick, DefaultWheelSize)
+	}
+	return defaultWheel
+}
+
+// SetDefault 替换共享的时间轮（例如按配置调整精度），应当在创建任何缓存之前调用
+func SetDefault(tw *TimingWheel) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultWheel != nil && defaultWheel != tw {
+		defaultWheel.Stop()
+	}
+	defaultWheel = tw
+}
+
+// Tick 返回时间轮的精度
+func (tw *TimingWheel) Tick() time.Duration {
+	return tw.tick
+}
+
+/*
+AfterFunc 在 d 之后执行 f
+  - 到期时间向上取整到 tick，任务不会早于 d 触发，最多延迟一个 tick
+  - f 在时间轮的 goroutine 中执行，应当尽快返回，不能调用阻塞操作
+  - 返回的 Timer 可以用来取消任务
+*/
+func (tw *TimingWheel) AfterFunc(d time.Duration, f func()) *Timer {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	expiration := int64((time.Since(tw.start) + d + tw.tick - 1) / tw.tick)
+	if expiration <= tw.current {
+		expiration = tw.current + 1
+	}
+	t := &Timer{expiration: expiration, task: f, wheel: tw}
+	tw.add(t)
+	return t
+}
+
+// add 按剩余 tick 数把任务放入能容纳它的最低一层，调用方需持有 tw.mu
+func (tw *TimingWheel) add(t *Timer) {
+	delay := t.expiration - tw.current
+	span := int64(1)
+	for level := 0; level < levelCount; level++ {
+		if delay < span*tw.wheelSize || level == levelCount-1 {
+			bucket := tw.levels[level][(t.expiration/span)%tw.wheelSize]
+			t.bucket = bucket
+			t.element = bucket.PushBack(t)
+			return
+		}
+		span *= tw.wheelSize
+	}
+}
+
+// Stop 取消任务，任务已经触发或已经取消时返回 false
+func (t *Timer) Stop() bool {
+	tw := t.wheel
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if t.bucket == nil {
+		return false
+	}
+	t.bucket.Remove(t.element)
+	t.bucket, t.element = nil, nil
+	return true
+}
+
+// Stop 停止时间轮，未触发的任务不再执行
+func (tw *TimingWheel) Stop() {
+	tw.once.Do(func() {
+		close(tw.stop)
+	})
+}
+
+func (tw *TimingWheel) run() {
+	ticker := time.NewTicker(tw.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			tw.advance(int64(time.Since(tw.start) / tw.tick))
+		case <-tw.stop:
+			return
+		}
+	}
+}
+
+// advance 逐个 tick 推进到 target，执行到期的任务
+func (tw *TimingWheel) advance(target int64) {
+	for {
+		tw.mu.Lock()
+		if tw.current >= target {
+			tw.mu.Unlock()
+			return
+		}
+		tw.current++
+
+		/*
+			依次降级各层中到期区间的槽
+			  - 先用新链表替换该槽再重新插入，超出最高层范围的任务会落回同一个槽，
+			    直接遍历原链表会反复处理这些任务而无法结束
+		*/
+		span := tw.wheelSize
+		for level := 1; level < levelCount && tw.current%span == 0; level++ {
+			idx := (tw.current / span) % tw.wheelSize
+			bucket := tw.levels[level][idx]
+			tw.levels[level][idx] = list.New()
+			for e := bucket.Front(); e != nil; e = e.Next() {
+				tw.add(e.Value.(*Timer))
+			}
+			span *= tw.wheelSize
+		}
+
+		var due []*Timer
+		bucket := tw.levels[0][tw.current%tw.wheelSize]
+		for e := bucket.Front(); e != nil; {
+			next := e.Next()
+			t := e.Value.(*Timer)
+			if t.expiration <= tw.current {
+				bucket.Remove(e)
+				t.bucket, t.element = nil, nil
+				due = append(due, t)
+			}
+			e = next
+		}
+		tw.mu.Unlock()
+
+		for _, t := range due {
+			t.task()
+		}
+	}
+}
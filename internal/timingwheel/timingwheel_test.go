@@ -0,0 +1,89 @@
+package timingwheel
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAfterFunc(t *testing.T) {
+	tw := New(time.Millisecond, 4)
+	defer tw.Stop()
+
+	// 4 个槽、4 层，覆盖 256 个 tick，300ms 的任务需要在最高层循环降级
+	delays := []time.Duration{time.Millisecond, time.Millisecond * 3, time.Millisecond * 10,
+		time.Millisecond * 40, time.Millisecond * 100, time.Millisecond * 300}
+	var wg sync.WaitGroup
+	for _, d := range delays {
+		d := d
+		wg.Add(1)
+		start := time.Now()
+		tw.AfterFunc(d, func() {
+			defer wg.Done()
+			if elapsed := time.Since(start); elapsed < d {
+				t.Errorf("task after %v fired early at %v", d, elapsed)
+			} else if elapsed > d+time.Millisecond*50 {
+				t.Errorf("task after %v fired late at %v", d, elapsed)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func TestAfterFuncBeyondTopLevel(t *testing.T) {
+	tw := New(time.Millisecond, 2)
+	defer tw.Stop()
+
+	// 2 个槽、4 层只覆盖 16 个 tick，多个超出范围的任务每次降级都落回最高层的同一个槽
+	var wg sync.WaitGroup
+	for _, d := range []time.Duration{time.Millisecond * 40, time.Millisecond * 45, time.Millisecond * 50} {
+		wg.Add(1)
+		tw.AfterFunc(d, wg.Done)
+	}
+	// 降级不能阻塞时间轮，之后登记的任务照常触发；时间轮被阻塞时 AfterFunc 无法返回，所以在另一个 goroutine 中登记
+	time.Sleep(time.Millisecond * 20)
+	fired := make(chan struct{})
+	go tw.AfterFunc(time.Millisecond, func() { close(fired) })
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("timing wheel blocked by timers beyond the top level")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timers beyond the top level never fired")
+	}
+}
+
+func TestTimerStop(t *testing.T) {
+	tw := New(time.Millisecond, 8)
+	defer tw.Stop()
+
+	fired := make(chan struct{}, 1)
+	timer := tw.AfterFunc(time.Millisecond*20, func() { fired <- struct{}{} })
+	if !timer.Stop() {
+		t.Fatal("pending timer should be stopped")
+	}
+	if timer.Stop() {
+		t.Fatal("stopped timer should not be stopped again")
+	}
+
+	select {
+	case <-fired:
+		t.Fatal("stopped timer should not fire")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	done := tw.AfterFunc(time.Millisecond, func() { fired <- struct{}{} })
+	<-fired
+	if done.Stop() {
+		t.Fatal("fired timer should not be stopped")
+	}
+}
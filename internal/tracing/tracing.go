@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"io"
+	"os"
+)
+
+/*
+Options 链路追踪的导出配置
+  - Exporter：none（默认，不导出）、stdout、file（本地调试）、otlp（发送到 OTLP gRPC 收集器）
+  - Endpoint：otlp 收集器地址，例如 localhost:4317
+  - File：file 导出器写入的文件，追加写入，每个 span 一行 JSON
+  - SampleRatio：根 span 的采样比例（0~1），0 表示全部采样；远程节点跟随调用方的采样决定
+*/
+type Options struct {
+	Exporter    string
+	Endpoint    string
+	File        string
+	SampleRatio float64
+	ServiceName string
+	InstanceID  string
+}
+
+/*
+Init 按配置创建 TracerProvider 并设置为全局
+  - 无论是否导出，都设置 W3C trace context 传播器，未开启追踪的节点也能把调用方的上下文传下去
+  - 返回的 shutdown 在进程退出前调用，导出尚未发送的 span
+*/
+func Init(ctx context.Context, o Options) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var closer io.Closer
+	switch o.Exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "file":
+		var f *os.File
+		f, err = os.OpenFile(o.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		closer = f
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	case "otlp":
+		exporter, err = otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(o.Endpoint), otlptracegrpc.WithInsecure())
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q, expect none, stdout, file or otlp", o.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(o.ServiceName),
+		semconv.ServiceInstanceID(o.InstanceID),
+	))
+	if err != nil {
+		return nil, err
+	}
+	sampler := sdktrace.AlwaysSample()
+	if o.SampleRatio > 0 && o.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(o.SampleRatio)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+	)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closer != nil {
+			if cerr := closer.Close(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}, nil
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"gocache/config"
 	"gocache/discovery"
 	grpcservice "gocache/internal"
+	"gocache/internal/metrics"
+	"gocache/internal/timingwheel"
+	"gocache/internal/tracing"
 	"gocache/test/pkg/student/dao"
 	"gocache/utils/logger"
+	"time"
 )
 
 var (
@@ -16,21 +21,103 @@ var (
 
 func main() {
 	config.InitConfig()
+	if lc := config.Conf.Logger; lc != nil {
+		o := logger.Options{Level: lc.Level, Format: lc.Format, Output: lc.Output, Dir: lc.Dir, MaxAge: lc.MaxAge}
+		if s := lc.Sampling; s != nil {
+			o.Sampling = logger.Sampling{Tick: time.Duration(s.Tick) * time.Millisecond, Initial: s.Initial, Thereafter: s.Thereafter}
+		}
+		if err := logger.Init(o); err != nil {
+			logger.LogrusObj.Errorf("init logger failed, keep the default logger, %v", err)
+		}
+	}
 	dao.InitDB()
 	flag.Parse()
 
+	// 所有缓存共享同一个时间轮登记过期任务，需要在创建 group 之前设置
+	if tc := config.Conf.TimingWheel; tc != nil {
+		timingwheel.SetDefault(timingwheel.New(time.Duration(tc.Tick)*time.Millisecond, tc.WheelSize))
+	}
+
+	// 开启时在服务端口加偏移量的端口上导出 Prometheus 指标，需要在创建 group 之前设置 Observer
+	if mc := config.Conf.Metrics; mc != nil && mc.Enable {
+		m := metrics.New()
+		grpcservice.SetObserver(m)
+		go func() {
+			addr := fmt.Sprintf(":%d", *port+mc.PortOffset)
+			if err := m.Serve(addr); err != nil {
+				logger.LogrusObj.Errorf("serve metrics on %s failed, %v", addr, err)
+			}
+		}()
+	}
+
 	serviceAddr := fmt.Sprintf("localhost:%d", *port)
+
+	// 链路追踪：即使不导出也会设置传播器，把调用方的 trace context 继续传给其他节点
+	if tc := config.Conf.Tracing; tc != nil {
+		name := tc.ServiceName
+		if name == "" {
+			name = "gocache"
+		}
+		shutdown, err := tracing.Init(context.Background(), tracing.Options{
+			Exporter:    tc.Exporter,
+			Endpoint:    tc.Endpoint,
+			File:        tc.File,
+			SampleRatio: tc.SampleRatio,
+			ServiceName: name,
+			InstanceID:  serviceAddr,
+		})
+		if err != nil {
+			logger.LogrusObj.Errorf("init tracing failed, %v", err)
+		} else {
+			defer shutdown(context.Background())
+		}
+	}
+
 	gm := grpcservice.NewGroupManager([]string{"scores", "website"}, serviceAddr)
 
+	// 所有 group 共享进程级内存预算，按命中情况和回源代价周期性地重新分配
+	if mc := config.Conf.Memory; mc != nil && mc.Budget > 0 {
+		mm := grpcservice.NewMemoryManager(mc.Budget, time.Duration(mc.Interval)*time.Second)
+		mm.SetMinGroupBytes(mc.MinGroupBytes)
+		mm.FollowMemoryLimit(mc.MemoryLimitRatio)
+		for _, g := range gm {
+			mm.Register(g)
+		}
+		mm.Start()
+	}
+
+	// Admin 服务可以清空缓存，只在配置中开启时注册
+	var opts []grpcservice.ServerOption
+	if ac := config.Conf.Admin; ac != nil && ac.Enable {
+		if ac.Token == "" {
+			logger.LogrusObj.Warnf("admin service is enabled without a token")
+		}
+		opts = append(opts, grpcservice.WithAdmin(ac.Token))
+	}
+
 	//通过通信来共享内存而不是通过共享内存来通信
 	updateChan := make(chan struct{})
-	svr, err := grpcservice.NewServer(updateChan, serviceAddr)
+	svr, err := grpcservice.NewServer(updateChan, serviceAddr, opts...)
 	if err != nil {
 		logger.LogrusObj.Errorf("acquire grpc server instance failed, %v", err)
 		//logger.LogrusObj
 		return
 	}
 
+	// 快照由 Admin.Snapshot 写入，开启时启动前先从快照预热缓存
+	if sc := config.Conf.Snapshot; sc != nil && sc.Dir != "" {
+		svr.SetSnapshotDir(sc.Dir)
+		if sc.RestoreOnStart {
+			for name, g := range gm {
+				if n, err := g.RestoreFile(sc.Dir); err != nil {
+					logger.LogrusObj.Warnf("restore group %s from snapshot failed, %v", name, err)
+				} else if n > 0 {
+					logger.LogrusObj.Infof("restored %d entries of group %s from snapshot", n, name)
+				}
+			}
+		}
+	}
+
 	go discovery.DynamicServices(updateChan, config.Conf.Services["groupcache"].Name)
 
 	peers, err := discovery.ListServicePeers(config.Conf.Services["groupcache"].Name)
@@ -1,19 +0,0 @@
-#! /bin/bash
-
-echo  "start grpc test"
-
-sleep 2
-
-echo -e "\e[1;32m《《《《《《《《 START GoCache》》》》》》》\e[0m"
-echo
-echo -e "\e[1;33m:......:::::.......::::......:::..:::::..:::......:::..:::::..::........:::\e[0m"
-echo -e "\e[1;33m:'######:::::'#######:::'######:::::'###:::::'######::'##::::'##:'########:\e[0m"
-echo -e "\e[1;33m'##... ##:::'##.... ##:'##... ##:::'## ##:::'##... ##: ##:::: ##: ##.....::\e[0m"
-echo -e "\e[1;33m ##:::..:::: ##:::: ##: ##:::..:::'##:. ##:: ##:::..:: ##:::: ##: ##:::::::\e[0m"
-echo -e "\e[1;33m ##::'####:: ##:::: ##: ##:::::::'##:::. ##: ##::::::: #########: ######:::\e[0m"
-echo -e "\e[1;33m ##:::: ##:: ##:::: ##: ##::::::: #########: ##::::::: ##.... ##: ##...::::\e[0m"
-echo -e "\e[1;33m ##::: ##::: ##:::: ##: ##::: ##: ##.... ##: ##::: ##: ##:::: ##: ##:::::::\e[0m"
-echo -e "\e[1;33m. ######::::. #######::. ######:: ##:::: ##:. ######:: ##:::: ##: ########:\e[0m"
-echo -e "\e[1;33m:......:::::.......::::......:::..:::::..:::......:::..:::::..::........:::\e[0m"
-
-go run grpc_client.go
\ No newline at end of file
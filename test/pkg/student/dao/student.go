@@ -37,3 +37,28 @@ func (dao *StudentDao) CreateStudent(req *stuPb.StudentRequest) (err error) {
 	}
 	return
 }
+
+// ScanStudentNames 逐行读取所有学生的名字，用于构建缓存的布隆过滤器
+func (dao *StudentDao) ScanStudentNames(fn func(name string)) error {
+	rows, err := dao.Model(&model.Student{}).Select("name").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return err
+		}
+		fn(name)
+	}
+	return rows.Err()
+}
+
+// ShowStudentsByNames 一次查询多个学生，不存在的名字不出现在结果中，用于缓存的批量回源
+func (dao *StudentDao) ShowStudentsByNames(ctx context.Context, names []string) (r []*model.Student, err error) {
+	err = dao.WithContext(ctx).Model(&model.Student{}).Where("name IN ?", names).
+		Find(&r).Error
+	return
+}
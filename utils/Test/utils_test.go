@@ -1,10 +1,14 @@
 package Test
 
 import (
+	"bytes"
 	"fmt"
+	"gocache/utils/logger"
 	"gocache/utils/trace"
 	"gocache/utils/validate"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestTrace(t *testing.T) {
@@ -26,3 +30,36 @@ func TestValidate(t *testing.T) {
 		fmt.Printf("Is '%s' a valid peer address? %t\n", addr, validate.ValidPeerAddr(addr))
 	}
 }
+
+func TestSampledDebugf(t *testing.T) {
+	defer logger.Init(logger.Options{})
+
+	if err := logger.Init(logger.Options{Level: "debug", Sampling: logger.Sampling{Tick: time.Hour, Initial: 2, Thereafter: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	logger.LogrusObj.SetOutput(&buf)
+	for i := 1; i <= 10; i++ {
+		logger.SampledDebugf("hot %d", i)
+	}
+	logger.SampledDebugf("other")
+	// 前 2 条全部输出，之后每 3 条输出一条：1 2 5 8；其他消息单独计数
+	for _, want := range []string{"hot 1", "hot 2", "hot 5", "hot 8", "other"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("missing %q in output:\n%s", want, buf.String())
+		}
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 5 {
+		t.Fatalf("got %d lines, expect 5:\n%s", n, buf.String())
+	}
+
+	if err := logger.Init(logger.Options{Level: "info"}); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	logger.LogrusObj.SetOutput(&buf)
+	logger.SampledDebugf("hot")
+	if buf.Len() != 0 {
+		t.Fatalf("debug log printed at info level: %s", buf.String())
+	}
+}
@@ -25,7 +25,8 @@ func init() {
 	// outputFile, _ := setOutputFile()
 	// logger.Out = outputFile
 	logger.Out = os.Stdout
-	logger.SetLevel(logrus.DebugLevel)
+	// 默认 Info 级别，命中、选点、淘汰等热路径日志只在 Debug 级别按采样输出
+	logger.SetLevel(logrus.InfoLevel)
 	logger.SetFormatter(&logrus.TextFormatter{
 		TimestampFormat: "2006-01-02 15:04:05",
 	})
@@ -34,16 +35,21 @@ func init() {
 }
 
 func setOutputFile() (*os.File, error) {
-	//获取时间用于生产日志文件名
-	now := time.Now()
-	logFilePath := ""
+	return openLogFile("", time.Now())
+}
+
+// openLogFile 打开 dir 目录下当天的日志文件，dir 为空时使用工作目录下的 logs 目录
+func openLogFile(dir string, now time.Time) (*os.File, error) {
+	logFilePath := dir
 	//获取当前文件目录
-	if dir, err := os.Getwd(); err == nil {
-		logFilePath = dir + "/logs/"
+	if logFilePath == "" {
+		if dir, err := os.Getwd(); err == nil {
+			logFilePath = dir + "/logs/"
+		}
 	}
 	_, err := os.Stat(logFilePath)
 	if os.IsNotExist(err) {
-		if err := os.Mkdir(logFilePath, 0777); err != nil {
+		if err := os.MkdirAll(logFilePath, 0777); err != nil {
 			log.Println(err.Error())
 			return nil, err
 		}
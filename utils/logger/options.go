@@ -0,0 +1,181 @@
+package logger
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Options 日志配置
+  - Level：trace、debug、info、warn、error，默认 info
+  - Format：text 或 json，默认 text
+  - Output：stdout、file 或 both，默认 stdout；file 按天切分到 Dir 目录（默认工作目录下的 logs），保留 MaxAge 天
+  - Sampling：热路径日志的采样，每个 Tick 内同一条消息先输出 Initial 条，之后每 Thereafter 条输出一条
+*/
+type Options struct {
+	Level    string
+	Format   string
+	Output   string
+	Dir      string
+	MaxAge   int
+	Sampling Sampling
+}
+
+// Sampling 热路径日志采样配置，Initial 和 Thereafter 都为 0 时不采样，全部输出
+type Sampling struct {
+	Tick       time.Duration
+	Initial    int
+	Thereafter int
+}
+
+var hot atomic.Pointer[sampler]
+
+// Init 按配置重新设置 LogrusObj 的级别、格式和输出，需要在其他模块输出日志之前调用
+func Init(o Options) error {
+	level := logrus.InfoLevel
+	if o.Level != "" {
+		var err error
+		if level, err = logrus.ParseLevel(o.Level); err != nil {
+			return err
+		}
+	}
+
+	var formatter logrus.Formatter
+	switch strings.ToLower(o.Format) {
+	case "", "text":
+		formatter = &logrus.TextFormatter{TimestampFormat: "2006-01-02 15:04:05"}
+	case "json":
+		formatter = &logrus.JSONFormatter{TimestampFormat: "2006-01-02 15:04:05"}
+	default:
+		return fmt.Errorf("unknown log format %q, expect text or json", o.Format)
+	}
+
+	var out io.Writer
+	switch strings.ToLower(o.Output) {
+	case "", "stdout":
+		out = os.Stdout
+	case "file":
+		out = &dailyFile{dir: o.Dir, maxAge: o.MaxAge}
+	case "both":
+		out = io.MultiWriter(os.Stdout, &dailyFile{dir: o.Dir, maxAge: o.MaxAge})
+	default:
+		return fmt.Errorf("unknown log output %q, expect stdout, file or both", o.Output)
+	}
+
+	LogrusObj.SetLevel(level)
+	LogrusObj.SetFormatter(formatter)
+	LogrusObj.SetOutput(out)
+	if o.Sampling.Initial > 0 || o.Sampling.Thereafter > 0 {
+		hot.Store(newSampler(o.Sampling))
+	} else {
+		hot.Store(nil)
+	}
+	return nil
+}
+
+/*
+SampledDebugf 输出热路径上的 Debug 日志
+  - 未开启 Debug 级别时直接返回，不格式化参数
+  - 按 format 区分消息，开启采样时同一条消息在每个 Tick 内只输出一部分，避免高并发下日志占满 CPU
+*/
+func SampledDebugf(format string, args ...interface{}) {
+	if !LogrusObj.IsLevelEnabled(logrus.DebugLevel) {
+		return
+	}
+	if s := hot.Load(); s != nil && !s.allow(format) {
+		return
+	}
+	LogrusObj.Debugf(format, args...)
+}
+
+// sampler 按消息计数，每个 Tick 重新开始计数
+type sampler struct {
+	tick       int64
+	initial    int64
+	thereafter int64
+	counters   sync.Map // format -> *counter
+}
+
+type counter struct {
+	resetAt atomic.Int64
+	n       atomic.Int64
+}
+
+func newSampler(o Sampling) *sampler {
+	if o.Tick <= 0 {
+		o.Tick = time.Second
+	}
+	return &sampler{tick: int64(o.Tick), initial: int64(o.Initial), thereafter: int64(o.Thereafter)}
+}
+
+func (s *sampler) allow(key string) bool {
+	v, ok := s.counters.Load(key)
+	if !ok {
+		v, _ = s.counters.LoadOrStore(key, &counter{})
+	}
+	c := v.(*counter)
+
+	now := time.Now().UnixNano()
+	if resetAt := c.resetAt.Load(); now >= resetAt && c.resetAt.CompareAndSwap(resetAt, now+s.tick) {
+		c.n.Store(0)
+	}
+	n := c.n.Add(1)
+	if n <= s.initial {
+		return true
+	}
+	return s.thereafter > 0 && (n-s.initial)%s.thereafter == 0
+}
+
+/*
+dailyFile 按天切分的日志文件，沿用 setOutputFile 的 logs/2006-01-02.log 命名
+  - 写入时发现日期变化就关闭旧文件、打开当天的文件
+  - maxAge 大于 0 时切换文件后删除超过 maxAge 天的旧日志
+*/
+type dailyFile struct {
+	dir    string
+	maxAge int
+
+	mu   sync.Mutex
+	day  string
+	file *os.File
+}
+
+func (f *dailyFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if day := now.Format("2006-01-02"); f.file == nil || day != f.day {
+		file, err := openLogFile(f.dir, now)
+		if err != nil {
+			return 0, err
+		}
+		if f.file != nil {
+			f.file.Close()
+		}
+		f.file, f.day = file, day
+		f.removeExpired(now)
+	}
+	return f.file.Write(p)
+}
+
+func (f *dailyFile) removeExpired(now time.Time) {
+	if f.maxAge <= 0 {
+		return
+	}
+	dir := filepath.Dir(f.file.Name())
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	cutoff := now.AddDate(0, 0, -f.maxAge).Format("2006-01-02")
+	for _, name := range matches {
+		if day := strings.TrimSuffix(filepath.Base(name), ".log"); len(day) == len("2006-01-02") && day < cutoff {
+			os.Remove(name)
+		}
+	}
+}